@@ -0,0 +1,200 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	godror "github.com/godror/godror"
+	oracall "github.com/tgulacsi/oracall/lib"
+	errors "golang.org/x/xerrors"
+)
+
+// callMain is the "call" subcommand: calls a PL/SQL function with the arguments read live from the database,
+// printing the output as JSON, or as NDJSON for the REF CURSORs (the other outputs first, then one line for each row).
+func callMain(args []string) error {
+	fs := flag.NewFlagSet("call", flag.ExitOnError)
+	flagConnect := fs.String("connect", os.Getenv("ORACALL_DSN"), "database to connect to (default: $ORACALL_DSN)")
+	flagRollback := fs.Bool("rollback", false, "roll back the transaction instead of committing it")
+	flagExplain := fs.Bool("explain", false, "print the PL/SQL block and its bind variables, without calling it")
+	flagInput := fs.String("input", "", "read the input JSON from this file (- for stdin), instead of the argument")
+	flagVerbose := fs.Bool("v", false, "verbose logging")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage:\n\t%s call [flags] PKG.FUNC ['{\"p_arg\":1}']\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	name := fs.Arg(0)
+	if name == "" || fs.NArg() > 2 {
+		fs.Usage()
+		return errors.Errorf("PKG.FUNC is required: %w", oracall.ErrInvalidArgument)
+	}
+	if *flagConnect == "" {
+		return errors.Errorf("-connect is required: %w", oracall.ErrInvalidArgument)
+	}
+
+	var input []byte
+	var err error
+	switch {
+	case *flagInput == "-":
+		input, err = ioutil.ReadAll(os.Stdin)
+	case *flagInput != "":
+		input, err = ioutil.ReadFile(*flagInput)
+	default:
+		input = []byte(fs.Arg(1))
+	}
+	if err != nil {
+		return errors.Errorf("read input: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt)
+	go func() { <-sigCh; cancel() }()
+
+	cx, err := sql.Open("godror", *flagConnect)
+	if err != nil {
+		return errors.Errorf("connect to %s: %w", *flagConnect, err)
+	}
+	defer cx.Close()
+	if *flagVerbose {
+		godror.Log = log.With(logger, "lib", "godror").Log
+	}
+	if err = cx.PingContext(ctx); err != nil {
+		return errors.Errorf("ping %s: %w", *flagConnect, err)
+	}
+
+	fun, err := findFunction(ctx, cx, name)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+	if *flagExplain {
+		qry, binds, err := fun.InvokePlsql()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, qry)
+		for _, b := range binds {
+			fmt.Fprintln(w, b)
+		}
+		return nil
+	}
+
+	tx, err := cx.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var in map[string]interface{}
+	if s := strings.TrimSpace(string(input)); s != "" {
+		dec := json.NewDecoder(strings.NewReader(s))
+		dec.UseNumber()
+		if err = dec.Decode(&in); err != nil {
+			return errors.Errorf("decode input %q: %w", s, err)
+		}
+	}
+	output, err := fun.InvokeMap(ctx, tx, in)
+	if err != nil {
+		return err
+	}
+	if *flagRollback {
+		err = tx.Rollback()
+	} else {
+		err = tx.Commit()
+	}
+	if err != nil {
+		return err
+	}
+	return printOutput(w, *fun, output)
+}
+
+// findFunction reads the named function (PKG.FUNC) from the database, with its annotations applied.
+func findFunction(ctx context.Context, cx *sql.DB, name string) (*oracall.Function, error) {
+	functions, annotations, err := parseDB(ctx, cx, strings.ToUpper(name), "", func(string) bool { return true })
+	if err != nil {
+		return nil, errors.Errorf("read %s: %w", name, err)
+	}
+	functions = oracall.ApplyAnnotations(functions, annotations)
+	for i, f := range functions {
+		if strings.EqualFold(f.RealName(), name) {
+			return &functions[i], nil
+		}
+	}
+	return nil, errors.Errorf("%s: function not found", name)
+}
+
+// printOutput prints the output as JSON, or as NDJSON for the functions with REF CURSOR outputs:
+// the other outputs (if there are any) first, then each row - wrapped in an object keyed by the name of the cursor,
+// if there are more than one cursor.
+func printOutput(w io.Writer, fun oracall.Function, output map[string]interface{}) error {
+	enc := json.NewEncoder(w)
+	if !fun.HasCursorOut() {
+		enc.SetIndent("", "  ")
+		return enc.Encode(output)
+	}
+	args := fun.Args
+	if fun.Returns != nil {
+		args = append(append(make([]oracall.Argument, 0, len(args)+1), args...), *fun.Returns)
+	}
+	var cursors []string
+	for _, a := range args {
+		if a.Type == "REF CURSOR" {
+			cursors = append(cursors, a.Name)
+		}
+	}
+	rest := make(map[string]interface{}, len(output))
+	for k, v := range output {
+		rest[k] = v
+	}
+	for _, nm := range cursors {
+		delete(rest, nm)
+	}
+	if len(rest) != 0 {
+		if err := enc.Encode(rest); err != nil {
+			return err
+		}
+	}
+	for _, nm := range cursors {
+		rows, _ := output[nm].([]interface{})
+		for _, row := range rows {
+			if len(cursors) > 1 {
+				row = map[string]interface{}{nm: row}
+			}
+			if err := enc.Encode(row); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package conv converts the values read from the database to the fields of the generated structs.
+//
+// It does not depend on protobuf, so the plain Go API (oracall -go-out) can use it
+// instead of custom, whose DateTime is a Gogo protobuf custom type.
+package conv
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+
+	"github.com/godror/godror"
+	errors "golang.org/x/xerrors"
+)
+
+// NumbersFromStrings returns the strings as godror.Numbers, without copying.
+func NumbersFromStrings(s *[]string) *[]godror.Number {
+	if s == nil {
+		return nil
+	}
+	return (*[]godror.Number)(unsafe.Pointer(s))
+}
+
+const timeFormat = time.RFC3339
+
+// ParseTime parses s (RFC3339, or a prefix of it) into t, in the local time zone.
+func ParseTime(t *time.Time, s string) error {
+	if s == "" {
+		*t = time.Time{}
+		return nil
+	}
+	var i int
+	if i = strings.IndexByte(s, 'T'); i < 0 {
+		if i = strings.IndexByte(s, ' '); i < 0 {
+			s = s + "T00:00:00"
+		} else {
+			s = s[:i] + "T" + s[i+1:]
+		}
+	}
+
+	n := len(s)
+	if n > len(timeFormat) {
+		n = len(timeFormat)
+	}
+	var err error
+	*t, err = time.ParseInLocation(timeFormat[:n], s, time.Local) // TODO(tgulacsi): more robust parser
+	if err != nil {
+		return errors.Errorf("%s: %w", s, err)
+	}
+	return nil
+}
+
+func AsString(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	switch x := v.(type) {
+	case string:
+		return x
+	case godror.Number:
+		return string(x)
+	case sql.NullString:
+		return x.String
+	case fmt.Stringer:
+		return x.String()
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+func AsFloat64(v interface{}) float64 {
+	if v == nil {
+		return 0
+	}
+	switch x := v.(type) {
+	case float64:
+		return x
+	case float32:
+		return float64(x)
+	case int64:
+		return float64(x)
+	case int32:
+		return float64(x)
+	case sql.NullFloat64:
+		return x.Float64
+	case string, godror.Number:
+		var s string
+		switch x := x.(type) {
+		case string:
+			s = x
+		case godror.Number:
+			s = string(x)
+		}
+		if s == "" {
+			return 0
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			log.Printf("ERROR parsing %q as Float64: %v", s, err)
+		}
+		return f
+	default:
+		log.Printf("WARN: unknown Int64 type %T", v)
+	}
+	return 0
+}
+func AsInt32(v interface{}) int32 {
+	if v == nil {
+		return 0
+	}
+	switch x := v.(type) {
+	case int32:
+		return x
+	case int64:
+		return int32(x)
+	case float64:
+		return int32(x)
+	case float32:
+		return int32(x)
+	case sql.NullInt64:
+		return int32(x.Int64)
+	case string, godror.Number:
+		var s string
+		switch x := x.(type) {
+		case string:
+			s = x
+		case godror.Number:
+			s = string(x)
+		}
+		if s == "" {
+			return 0
+		}
+		i, err := strconv.ParseInt(s, 10, 32)
+		if err != nil {
+			log.Printf("ERROR parsing %q as Int32: %v", s, err)
+		}
+		return int32(i)
+	default:
+		log.Printf("WARN: unknown Int32 type %T", v)
+	}
+	return 0
+}
+func AsInt64(v interface{}) int64 {
+	switch x := v.(type) {
+	case int64:
+		return x
+	case int32:
+		return int64(x)
+	case float64:
+		return int64(x)
+	case float32:
+		return int64(x)
+	case sql.NullInt64:
+		return x.Int64
+	case string, godror.Number:
+		var s string
+		switch x := x.(type) {
+		case string:
+			s = x
+		case godror.Number:
+			s = string(x)
+		}
+		if s == "" {
+			return 0
+		}
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			log.Printf("ERROR parsing %q as Int64: %v", s, err)
+		}
+		return i
+	default:
+		log.Printf("WARN: unknown Int64 type %T", v)
+	}
+	return 0
+}
+
+func AsTime(v interface{}) time.Time {
+	var t time.Time
+	switch x := v.(type) {
+	case nil:
+	case time.Time:
+		t = x
+	case *time.Time:
+		if x != nil {
+			t = *x
+		}
+	case string:
+		_ = ParseTime(&t, x)
+	default:
+		log.Printf("WARN: unknown Date type %T", v)
+	}
+	return t
+}
@@ -25,7 +25,7 @@ import (
 	"unsafe"
 
 	"github.com/gogo/protobuf/types"
-	errors "golang.org/x/xerrors"
+	"github.com/tgulacsi/oracall/custom/timeparse"
 )
 
 var _ = xml.Unmarshaler((*DateTime)(nil))
@@ -97,30 +97,11 @@ func (dt DateTime) MarshalText() ([]byte, error) {
 }
 
 // UnmarshalText implements the encoding.TextUnmarshaler interface.
-// The time is expected to be in RFC 3339 format.
+// The time is expected to be in RFC 3339 format, as timeparse.Parse parses it.
 func (dt *DateTime) UnmarshalText(data []byte) error {
-	data = bytes.Trim(data, " \"")
-	n := len(data)
-	if n == 0 {
-		dt.Time = time.Time{}
-		//log.Println("time=")
-		return nil
-	}
-	if n > len(time.RFC3339) {
-		n = len(time.RFC3339)
-	} else if n < 4 {
-		n = 4
-	} else if n > 10 && data[10] != time.RFC3339[10] {
-		data[10] = time.RFC3339[10]
-	}
 	var err error
-	// Fractional seconds are handled implicitly by Parse.
-	dt.Time, err = time.ParseInLocation(time.RFC3339[:n], string(data), time.Local)
-	//log.Printf("s=%q time=%v err=%+v", data, dt.Time, err)
-	if err != nil {
-		return errors.Errorf("%s: %w", string(data), err)
-	}
-	return nil
+	dt.Time, err = timeparse.Parse(string(bytes.Trim(data, " \"")))
+	return err
 }
 
 func (dt DateTime) Timestamp() *types.Timestamp {
@@ -9,12 +9,11 @@ import (
 	"log"
 	"math"
 	"strconv"
-	"strings"
 	"time"
-	"unsafe"
 
 	errors "golang.org/x/xerrors"
 	"github.com/godror/godror"
+	"github.com/tgulacsi/oracall/custom/conv"
 )
 
 var ZeroIsAlmostZero bool
@@ -51,40 +50,9 @@ func (n *Number) Scan(src interface{}) error {
 	return nil
 }
 
-func NumbersFromStrings(s *[]string) *[]godror.Number {
-	if s == nil {
-		return nil
-	}
-	return (*[]godror.Number)(unsafe.Pointer(s))
-}
-
-const timeFormat = time.RFC3339
-
-func ParseTime(t *time.Time, s string) error {
-	if s == "" {
-		*t = time.Time{}
-		return nil
-	}
-	var i int
-	if i = strings.IndexByte(s, 'T'); i < 0 {
-		if i = strings.IndexByte(s, ' '); i < 0 {
-			s = s + "T00:00:00"
-		} else {
-			s = s[:i] + "T" + s[i+1:]
-		}
-	}
+func NumbersFromStrings(s *[]string) *[]godror.Number { return conv.NumbersFromStrings(s) }
 
-	n := len(s)
-	if n > len(timeFormat) {
-		n = len(timeFormat)
-	}
-	var err error
-	*t, err = time.ParseInLocation(timeFormat[:n], s, time.Local) // TODO(tgulacsi): more robust parser
-	if err != nil {
-		return errors.Errorf("%s: %w", s, err)
-	}
-	return nil
-}
+func ParseTime(t *time.Time, s string) error { return conv.ParseTime(t, s) }
 
 type Lob struct {
 	*godror.Lob
@@ -150,20 +118,10 @@ func (L *Lob) Scan(src interface{}) error {
 }
 
 func AsString(v interface{}) string {
-	if v == nil {
-		return ""
-	}
-	switch x := v.(type) {
-	case string:
-		return x
-	case Number:
+	if x, ok := v.(Number); ok {
 		return string(x)
-	case sql.NullString:
-		return x.String
-	case fmt.Stringer:
-		return x.String()
 	}
-	return fmt.Sprintf("%v", v)
+	return conv.AsString(v)
 }
 
 func AsFloat64(v interface{}) float64 {
@@ -208,75 +166,8 @@ func AsFloat64(v interface{}) float64 {
 	}
 	return result
 }
-func AsInt32(v interface{}) int32 {
-	if v == nil {
-		return 0
-	}
-	switch x := v.(type) {
-	case int32:
-		return x
-	case int64:
-		return int32(x)
-	case float64:
-		return int32(x)
-	case float32:
-		return int32(x)
-	case sql.NullInt64:
-		return int32(x.Int64)
-	case string, godror.Number:
-		var s string
-		switch x := x.(type) {
-		case string:
-			s = x
-		case godror.Number:
-			s = string(x)
-		}
-		if s == "" {
-			return 0
-		}
-		i, err := strconv.ParseInt(s, 10, 32)
-		if err != nil {
-			log.Printf("ERROR parsing %q as Int32: %v", s, err)
-		}
-		return int32(i)
-	default:
-		log.Printf("WARN: unknown Int32 type %T", v)
-	}
-	return 0
-}
-func AsInt64(v interface{}) int64 {
-	switch x := v.(type) {
-	case int64:
-		return x
-	case int32:
-		return int64(x)
-	case float64:
-		return int64(x)
-	case float32:
-		return int64(x)
-	case sql.NullInt64:
-		return x.Int64
-	case string, godror.Number:
-		var s string
-		switch x := x.(type) {
-		case string:
-			s = x
-		case godror.Number:
-			s = string(x)
-		}
-		if s == "" {
-			return 0
-		}
-		i, err := strconv.ParseInt(s, 10, 64)
-		if err != nil {
-			log.Printf("ERROR parsing %q as Int64: %v", s, err)
-		}
-		return i
-	default:
-		log.Printf("WARN: unknown Int64 type %T", v)
-	}
-	return 0
-}
+func AsInt32(v interface{}) int32 { return conv.AsInt32(v) }
+func AsInt64(v interface{}) int64 { return conv.AsInt64(v) }
 func AsDate(v interface{}) *DateTime {
 	//log.Printf("AsDate(%[1]v %[1]T)", v)
 	if v == nil {
@@ -0,0 +1,54 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package timeparse parses the dates as the generated structs (custom.DateTime)
+// and the dynamic calls (oracall.Invoke) accept them.
+//
+// It has no dependencies, so both the runtime types of the generated code (custom)
+// and the generator (lib, which must not depend on protobuf) can import it.
+package timeparse
+
+import (
+	"time"
+
+	errors "golang.org/x/xerrors"
+)
+
+// Parse parses RFC3339 (or its prefix, at least the year), with either 'T' or anything else between the date and the time,
+// in the local time zone if the zone is missing. The empty string is the zero time.
+func Parse(s string) (time.Time, error) {
+	n := len(s)
+	if n == 0 {
+		return time.Time{}, nil
+	}
+	if n > 10 && s[10] != time.RFC3339[10] {
+		s = s[:10] + time.RFC3339[10:11] + s[11:]
+	}
+	// Fractional seconds are handled implicitly by Parse.
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if n > len(time.RFC3339) {
+		n = len(time.RFC3339)
+	} else if n < 4 {
+		n = 4
+	}
+	t, err := time.ParseInLocation(time.RFC3339[:n], s, time.Local)
+	if err != nil {
+		return t, errors.Errorf("%s: %w", s, err)
+	}
+	return t, nil
+}
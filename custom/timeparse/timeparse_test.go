@@ -0,0 +1,46 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package timeparse
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	for _, tC := range []struct {
+		In   string
+		Want time.Time
+	}{
+		{In: ""},
+		{In: "2020", Want: time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local)},
+		{In: "2020-01-02", Want: time.Date(2020, 1, 2, 0, 0, 0, 0, time.Local)},
+		{In: "2020-01-02 03:04:05", Want: time.Date(2020, 1, 2, 3, 4, 5, 0, time.Local)},
+		{In: "2020-01-02T03:04:05Z", Want: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{In: "2020-01-02T03:04:05.5+01:00", Want: time.Date(2020, 1, 2, 2, 4, 5, 5e8, time.UTC)},
+	} {
+		got, err := Parse(tC.In)
+		if err != nil {
+			t.Errorf("%q: %+v", tC.In, err)
+		} else if !got.Equal(tC.Want) {
+			t.Errorf("%q: got %v, wanted %v", tC.In, got, tC.Want)
+		}
+	}
+	if _, err := Parse("tomorrow"); err == nil {
+		t.Error("wanted error for bad date")
+	}
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"time"
+
+	oracall "github.com/tgulacsi/oracall/lib"
+	errors "golang.org/x/xerrors"
+)
+
+// genInputsMain is the "gen-inputs" subcommand: prints random, but valid inputs of a PL/SQL function as NDJSON,
+// for smoke and fuzz testing (such as with "oracall call -input=-").
+func genInputsMain(args []string) error {
+	fs := flag.NewFlagSet("gen-inputs", flag.ExitOnError)
+	flagConnect := fs.String("connect", os.Getenv("ORACALL_DSN"), "database to connect to (default: $ORACALL_DSN)")
+	flagN := fs.Int("n", 10, "number of inputs")
+	flagBoundary := fs.Bool("boundary", false, "generate boundary values: maximum lengths and digits, empty tables")
+	flagSeed := fs.Int64("seed", 0, "random seed (default: the current time)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage:\n\t%s gen-inputs [flags] PKG.FUNC\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	name := fs.Arg(0)
+	if name == "" || fs.NArg() > 1 {
+		fs.Usage()
+		return errors.Errorf("PKG.FUNC is required: %w", oracall.ErrInvalidArgument)
+	}
+	if *flagConnect == "" {
+		return errors.Errorf("-connect is required: %w", oracall.ErrInvalidArgument)
+	}
+	if *flagSeed == 0 {
+		*flagSeed = time.Now().UnixNano()
+	}
+
+	ctx := context.Background()
+	cx, err := sql.Open("godror", *flagConnect)
+	if err != nil {
+		return errors.Errorf("connect to %s: %w", *flagConnect, err)
+	}
+	defer cx.Close()
+	fun, err := findFunction(ctx, cx, name)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+	enc := json.NewEncoder(w)
+	g := oracall.InputGenerator{Rand: rand.New(rand.NewSource(*flagSeed)), Boundary: *flagBoundary}
+	for i := 0; i < *flagN; i++ {
+		if err = enc.Encode(g.Input(*fun)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -5,11 +5,14 @@ go 1.12
 require (
 	github.com/antzucaro/matchr v0.0.0-20180616170659-cbc221335f3c
 	github.com/davecgh/go-spew v1.1.1
+	github.com/emicklei/proto v1.6.15
 	github.com/fatih/structs v1.1.0
 	github.com/go-kit/kit v0.9.0
+	github.com/go-logfmt/logfmt v0.4.0
 	github.com/go-stack/stack v1.8.0
 	github.com/godror/godror v0.16.1
 	github.com/gogo/protobuf v1.3.0
+	github.com/golang/protobuf v1.3.2
 	github.com/google/go-cmp v0.4.0
 	github.com/grpc-ecosystem/go-grpc-middleware v1.0.0
 	github.com/kylelemons/godebug v1.1.0
@@ -0,0 +1,101 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oracall
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// DBCharset and DBNCharset are the character sets of the database (NLS_CHARACTERSET and NLS_NCHAR_CHARACTERSET),
+// for the length checks of the strings.
+var DBCharset, DBNCharset = "AL32UTF8", "AL16UTF16"
+
+// FieldError is returned by the generated input checks for the invalid field of the input,
+// with the path of the field, like "p_rows[2].name".
+//
+// It is an ErrInvalidArgument, so orasrv returns it with the InvalidArgument code, and an oragrpc.FieldErrorDetail.
+type FieldError struct {
+	Field, Reason string
+}
+
+func (e *FieldError) Error() string { return e.Field + ": " + e.Reason }
+
+// Unwrap returns ErrInvalidArgument.
+func (e *FieldError) Unwrap() error { return ErrInvalidArgument }
+
+// CheckDate returns an error if t is out of the range of the valid dates (DefaultMinDate..DefaultMaxDate).
+func CheckDate(t time.Time) error {
+	if t.Before(DefaultMinDate) || t.After(DefaultMaxDate) {
+		return fmt.Errorf("%s is out of the range of the valid dates (%s..%s)",
+			t.Format(time.RFC3339), DefaultMinDate.Format(time.RFC3339), DefaultMaxDate.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// EncodedLen returns the length of s in bytes, encoded in the Oracle character set
+// (AL32UTF8, UTF8, AL16UTF16, or a single-byte one like EE8ISO8859P2),
+// or -1 for the other (multi-byte, like ZHS16GBK) character sets, as it cannot be counted without encoding s.
+func EncodedLen(s, charset string) int {
+	switch cs := strings.ToUpper(charset); cs {
+	case "AL32UTF8", "":
+		return len(s)
+	case "UTF8": // CESU-8: the supplementary characters are encoded as two 3-byte surrogates
+		return len(s) + 2*supplementaryCount(s)
+	case "AL16UTF16":
+		return 2 * (utf8.RuneCountInString(s) + supplementaryCount(s))
+	default:
+		if singleByteCharset(cs) {
+			return utf8.RuneCountInString(s)
+		}
+		return -1
+	}
+}
+
+// CharLen returns the length of s in characters, as Oracle counts them in the character set:
+// the UTF-16 code units for AL16UTF16 and UTF8, the runes for the others.
+func CharLen(s, charset string) int {
+	n := utf8.RuneCountInString(s)
+	switch strings.ToUpper(charset) {
+	case "AL16UTF16", "UTF8":
+		n += supplementaryCount(s)
+	}
+	return n
+}
+
+// supplementaryCount returns the number of runes in s outside of the Basic Multilingual Plane.
+func supplementaryCount(s string) int {
+	var n int
+	for _, r := range s {
+		if r > 0xffff {
+			n++
+		}
+	}
+	return n
+}
+
+// singleByteCharset reports whether the Oracle character set is a 7 or 8 bit one, by its name
+// (<language or region><bits><name>, like US7ASCII or EE8MSWIN1250).
+func singleByteCharset(cs string) bool {
+	i := strings.IndexAny(cs, "0123456789")
+	if i < 0 || i+1 >= len(cs) {
+		return false
+	}
+	return (cs[i] == '7' || cs[i] == '8') && (cs[i+1] < '0' || '9' < cs[i+1])
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oracall
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+	"time"
+
+	errors "golang.org/x/xerrors"
+)
+
+func TestFieldError(t *testing.T) {
+	err := errors.Errorf("check: %w", &FieldError{Field: "p_tab[1].name", Reason: "is required"})
+	if !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("%v is not an ErrInvalidArgument", err)
+	}
+	if err.Error() != "check: p_tab[1].name: is required" {
+		t.Errorf("got %q", err.Error())
+	}
+}
+
+func TestCheckDate(t *testing.T) {
+	for _, tc := range []struct {
+		T       time.Time
+		WantErr bool
+	}{
+		{T: time.Date(2020, 2, 29, 12, 0, 0, 0, time.Local)},
+		{T: DefaultMinDate},
+		{T: DefaultMaxDate},
+		{T: time.Date(-1, 1, 1, 0, 0, 0, 0, time.UTC), WantErr: true},
+		{T: time.Date(10000, 1, 1, 0, 0, 0, 0, time.UTC), WantErr: true},
+	} {
+		if err := CheckDate(tc.T); (err != nil) != tc.WantErr {
+			t.Errorf("%s: got %v, wanted error: %t", tc.T, err, tc.WantErr)
+		}
+	}
+}
+
+func TestEncodedLen(t *testing.T) {
+	const s = "árvíztűrő tükörfúrógép 😀"
+	for _, tc := range []struct {
+		Charset      string
+		Bytes, Chars int
+	}{
+		{Charset: "AL32UTF8", Bytes: 36, Chars: 24},
+		{Charset: "UTF8", Bytes: 38, Chars: 25},
+		{Charset: "AL16UTF16", Bytes: 50, Chars: 25},
+		{Charset: "EE8ISO8859P2", Bytes: 24, Chars: 24},
+		{Charset: "ee8mswin1250", Bytes: 24, Chars: 24},
+	} {
+		if got := EncodedLen(s, tc.Charset); got != tc.Bytes {
+			t.Errorf("%s: got %d bytes, wanted %d", tc.Charset, got, tc.Bytes)
+		}
+		if got := CharLen(s, tc.Charset); got != tc.Chars {
+			t.Errorf("%s: got %d characters, wanted %d", tc.Charset, got, tc.Chars)
+		}
+	}
+}
+
+func TestGenChecks(t *testing.T) {
+	fun := genInputFunction()
+	fun.Args[0].Required = true
+	note := NewArgument("p_note", "VARCHAR2", "VARCHAR2", "", "IN", 0, "CHAR_CS", 0, 0, 30)
+	note.CharUsed = "C"
+	fun.Args = append(fun.Args, note)
+	rec := NewArgument("p_recs", "PL/SQL TABLE", "PL/SQL TABLE", "DB_PKG.REC_TAB_TYP", "IN", 0, "", 0, 0, 0)
+	elt := NewArgument("", "PL/SQL RECORD", "PL/SQL RECORD", "DB_PKG.REC_TYP", "IN", 0, "", 0, 0, 0)
+	name := NewArgument("name", "VARCHAR2", "VARCHAR2", "", "IN", 0, "", 0, 0, 20)
+	text := NewArgument("text", "CLOB", "CLOB", "", "IN", 0, "", 0, 0, 4000)
+	elt.RecordOf = []NamedArgument{{Name: "name", Argument: &name}, {Name: "text", Argument: &text}}
+	rec.TableOf = &elt
+	fun.Args = append(fun.Args, rec)
+
+	var buf bytes.Buffer
+	nm, err := fun.GenChecks(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nm != "CheckGetX_Input" {
+		t.Errorf("got name %q", nm)
+	}
+	src := buf.String()
+	t.Log(src)
+	if _, err = parser.ParseFile(token.NewFileSet(), "checks.go", "package checks\n"+src, 0); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`func CheckGetX_Input(s *pb.GetX_Input) error {`,
+		`if s.PName == "" {`,
+		`return &oracall.FieldError{Field: "p_name", Reason: "is required"}`,
+		`if len(s.PName) > 10 {`,
+		`oracall.ParseDigits(s.PAmount, 5, 2)`,
+		`oracall.CheckDate(s.PDate.Time)`,
+		`if len(s.PTab) > 3 {`,
+		`for i0, v0 := range s.PTab {`,
+		`Field: fmt.Sprintf("p_tab[%d]", i0)`,
+		`if len(v0.Name) > 20 {`,
+		`Field: fmt.Sprintf("p_recs[%d].name", i0)`,
+		`if oracall.CharLen(s.PNote, "AL32UTF8") > 30 {`,
+		`Reason: "longer than accepted (30 characters)"`,
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("missing %q", want)
+		}
+	}
+	if strings.Contains(src, "v0.Text") {
+		t.Error("the length of the CLOB is checked")
+	}
+}
+
+func TestGenChecksUnknownCharset(t *testing.T) {
+	defer func(cs string) { DBCharset = cs }(DBCharset)
+	DBCharset = "ZHS16GBK"
+	var buf bytes.Buffer
+	if _, err := genInputFunction().GenChecks(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if src := buf.String(); strings.Contains(src, "s.PName)") {
+		t.Errorf("the byte length is checked in ZHS16GBK:\n%s", src)
+	}
+}
@@ -0,0 +1,360 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oracall
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	errors "golang.org/x/xerrors"
+)
+
+// SaveClient writes the client package (named pkg) of the gRPC service of the functions,
+// generated into the Protocol Buffers package pbPkg (imported from pbImport).
+//
+// The Client has a method for each function, with the deadline and retry defaults of its annotations,
+// returning the Oracle errors as *oragrpc.OraError. Only the idempotent functions are retried.
+// The methods take and return the client-side structs of the inputs and outputs (see clientTypes),
+// with the DATEs as time.Time and the NUMBERs as godror.Number, instead of the Protocol Buffers messages.
+// The functions with REF CURSOR outputs call a callback with each output message,
+// and those with only one REF CURSOR get a <Name>Rows method, too, calling the callback with each row.
+func SaveClient(dst io.Writer, functions []Function, pkg, pbImport, pbPkg string) error {
+	svc := CamelCase(pbPkg)
+	var methods, options, idempotent bytes.Buffer
+	types := make(clientTypes, 16)
+	seen := make(map[string]struct{}, 16)
+	for _, fun := range functions {
+		if err := fun.SaveProtobuf(ioutil.Discard, seen); err != nil {
+			if SkipMissingTableOf && (errors.Is(err, ErrMissingTableOf) || errors.Is(err, UnknownSimpleType)) {
+				Log("msg", "SKIP function, missing TableOf info", "function", fun.Name())
+				continue
+			}
+			return errors.Errorf("%s: %w", fun.Name(), err)
+		}
+		fn := fun.name
+		if fun.alias != "" {
+			fn = fun.alias
+		}
+		name := CamelCase(dot2D.Replace(strings.ToLower(fn)))
+		input, output := name+"Input", name+"Output"
+		var inArgs, outArgs []Argument
+		for _, arg := range fun.Args {
+			if arg.IsInput() && arg.Inject == "" {
+				inArgs = append(inArgs, arg)
+			}
+			if arg.IsOutput() {
+				outArgs = append(outArgs, arg)
+			}
+		}
+		outArgs = append(outArgs, returns(fun)...)
+		if err := types.add(input, CamelCase(fun.getStructName(false, false)), "the input of "+name, inArgs); err != nil {
+			return errors.Errorf("%s: %w", fun.Name(), err)
+		}
+		if err := types.add(output, CamelCase(fun.getStructName(true, false)), "the output of "+name, outArgs); err != nil {
+			return errors.Errorf("%s: %w", fun.Name(), err)
+		}
+
+		maxAttempts := fun.maxAttempts
+		if fun.idempotent {
+			fmt.Fprintf(&idempotent, "\t%q: true,\n", name)
+		} else if maxAttempts != 0 {
+			Log("msg", "retry of a not idempotent function is ignored", "function", fun.Name())
+			maxAttempts = 0
+		}
+		if fun.timeout != 0 || maxAttempts != 0 {
+			fmt.Fprintf(&options, "\t\t%q: {Timeout: %d * time.Millisecond, MaxAttempts: %d},\n",
+				name, int64(fun.timeout/time.Millisecond), maxAttempts)
+		}
+		doc := fmt.Sprintf("// %s calls %s.\n", name, fun.RealName())
+		if fun.Documentation != "" {
+			common, _, _ := splitDoc(fun.Documentation)
+			if common = strings.TrimSpace(common); common != "" {
+				doc += "//\n// " + strings.Replace(common, "\n", "\n// ", -1) + "\n"
+			}
+		}
+
+		if !fun.HasCursorOut() {
+			fmt.Fprintf(&methods, `
+%sfunc (c *Client) %s(ctx context.Context, input *%s, opts ...grpc.CallOption) (*%s, error) {
+	var output *%s
+	err := c.options(%q).Call(ctx, func(ctx context.Context) error {
+		out, err := c.cl.%s(ctx, input.pb(), opts...)
+		output = new%s(out)
+		return err
+	})
+	return output, err
+}
+`, doc, name, input, output, output, name, name, output)
+			continue
+		}
+
+		fmt.Fprintf(&methods, `
+%s//
+// It calls f with each output message - the rows of the REF CURSORs come in batches.
+func (c *Client) %s(ctx context.Context, input *%s, f func(*%s) error, opts ...grpc.CallOption) error {
+	return c.options(%q).Call(ctx, func(ctx context.Context) error {
+		stream, err := c.cl.%s(ctx, input.pb(), opts...)
+		if err != nil {
+			return err
+		}
+		for n := 0; ; n++ {
+			output, err := stream.Recv()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				if n != 0 {
+					err = oragrpc.NoRetry(err)
+				}
+				return err
+			}
+			if err = f(new%s(output)); err != nil {
+				return oragrpc.NoRetry(err)
+			}
+		}
+	})
+}
+`, doc, name, input, output, name, name, output)
+
+		var cursors []Argument
+		for _, arg := range outArgs {
+			if arg.Type == "REF CURSOR" && arg.TableOf != nil {
+				cursors = append(cursors, arg)
+			}
+		}
+		if len(cursors) != 1 {
+			continue
+		}
+		_, rec, err := cursors[0].plainType(false)
+		if err != nil {
+			return errors.Errorf("%s: %w", fun.Name(), err)
+		}
+		if rec == "" {
+			continue
+		}
+		fmt.Fprintf(&methods, `
+// %sRows calls %s, calling f with each row of %s.
+func (c *Client) %sRows(ctx context.Context, input *%s, f func(*%s) error, opts ...grpc.CallOption) error {
+	return c.%s(ctx, input, func(output *%s) error {
+		for _, row := range output.%s {
+			if err := f(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, opts...)
+}
+`, name, fun.RealName(), cursors[0].Name,
+			name, input, rec,
+			name, output, CamelCase(replHidden(cursors[0].Name)))
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `// Code generated by oracall, DO NOT EDIT.
+
+package %s
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/godror/godror"
+	"github.com/tgulacsi/oracall/custom"
+	"github.com/tgulacsi/oracall/oragrpc"
+	pb %q
+	"google.golang.org/grpc"
+)
+
+var _ = io.EOF
+var _ = time.Millisecond
+var _ godror.Number
+var _ = custom.AsDate
+
+// Client calls the functions through the %s gRPC service.
+type Client struct {
+	cl pb.%sClient
+	// Options are the deadline and retry defaults of the methods, by method name, from the annotations of the functions.
+	Options map[string]oragrpc.CallOptions
+	// Default are the options of the methods missing from Options.
+	Default oragrpc.CallOptions
+}
+
+// NewClient returns a new Client on the connection.
+func NewClient(cc *grpc.ClientConn) *Client {
+	return &Client{cl: pb.New%sClient(cc), Options: map[string]oragrpc.CallOptions{
+%s	}}
+}
+
+// idempotent are the methods of the functions annotated as idempotent.
+// Only these are retried, as retrying the others could call them twice.
+var idempotent = map[string]bool{
+%s}
+
+func (c *Client) options(method string) oragrpc.CallOptions {
+	o, ok := c.Options[method]
+	if !ok {
+		o = c.Default
+	}
+	if !idempotent[method] {
+		o.MaxAttempts = 1
+	}
+	return o
+}
+%s`, pkg, pbImport, svc, svc, svc, options.String(), idempotent.String(), methods.String())
+	if err := types.write(&buf); err != nil {
+		return err
+	}
+	b, err := format.Source(buf.Bytes())
+	if err != nil {
+		return errors.Errorf("%s: %w", buf.String(), err)
+	}
+	_, err = dst.Write(b)
+	return err
+}
+
+// clientTypes are the client-side structs of the inputs, the outputs and the records, by name,
+// with their conversions to (the pb method) and from (the new<Name> function) the Protocol Buffers messages.
+//
+// The simple fields have the Go types of the bind variables, and are converted as the generated server
+// converts the message fields to the bind variables and back (see simpleConvs).
+type clientTypes map[string]string
+
+// add adds the struct named name of the args, converted to and from the message pbName, and the structs of its records.
+func (types clientTypes) add(name, pbName, doc string, args []Argument) error {
+	if _, ok := types[name]; ok {
+		return nil
+	}
+	types[name] = ""
+	var fields, toPb, fromPb bytes.Buffer
+	for _, arg := range args {
+		if arg.Flavor == FLAVOR_TABLE && arg.TableOf == nil {
+			return errors.Errorf("no table of data for %s.%s (%v): %w", name, arg, arg, ErrMissingTableOf)
+		}
+		aName := CamelCase(replHidden(arg.Name))
+		got, rec, err := arg.plainType(false)
+		if err != nil {
+			return errors.Errorf("%s: %w", arg.Name, err)
+		}
+		repeated := strings.HasPrefix(got, "[]")
+		if rec != "" {
+			if err = types.addRecord(arg, rec); err != nil {
+				return errors.Errorf("%s: %w", arg.Name, err)
+			}
+			if repeated {
+				fmt.Fprintf(&fields, "\t%s []*%s\n", aName, rec)
+				fmt.Fprintf(&toPb, "\tfor _, v := range x.%s {\n\t\tp.%s = append(p.%s, v.pb())\n\t}\n", aName, aName, aName)
+				fmt.Fprintf(&fromPb, "\tfor _, v := range p.%s {\n\t\tx.%s = append(x.%s, new%s(v))\n\t}\n", aName, aName, aName, rec)
+			} else {
+				fmt.Fprintf(&fields, "\t%s *%s\n", aName, rec)
+				fmt.Fprintf(&toPb, "\tp.%s = x.%s.pb()\n", aName, aName)
+				fmt.Fprintf(&fromPb, "\tx.%s = new%s(p.%s)\n", aName, rec, aName)
+			}
+			continue
+		}
+		elem := arg
+		if arg.Flavor == FLAVOR_TABLE {
+			elem = *arg.TableOf
+		}
+		c, ok := simpleConvs[elem.Type]
+		if !ok {
+			return errors.Errorf("%s (%s): %w", arg.Name, elem.Type, UnknownSimpleType)
+		}
+		if repeated {
+			fmt.Fprintf(&fields, "\t%s []%s\n", aName, c.goType)
+			fmt.Fprintf(&toPb, "\tfor _, v := range x.%s {\n\t\tp.%s = append(p.%s, %s)\n\t}\n", aName, aName, aName, c.genFromBind("v"))
+			fmt.Fprintf(&fromPb, "\tfor _, v := range p.%s {\n\t\tx.%s = append(x.%s, %s)\n\t}\n", aName, aName, aName, c.genToBind("v"))
+		} else {
+			fmt.Fprintf(&fields, "\t%s %s\n", aName, c.goType)
+			fmt.Fprintf(&toPb, "\tp.%s = %s\n", aName, c.genFromBind("x."+aName))
+			fmt.Fprintf(&fromPb, "\tx.%s = %s\n", aName, c.genToBind("p."+aName))
+		}
+	}
+	types[name] = fmt.Sprintf(`
+// %s is %s.
+type %s struct {
+%s}
+
+func (x *%s) pb() *pb.%s {
+	if x == nil {
+		return nil
+	}
+	p := new(pb.%s)
+%s	return p
+}
+
+func new%s(p *pb.%s) *%s {
+	if p == nil {
+		return nil
+	}
+	x := new(%s)
+%s	return x
+}
+`, name, doc, name, fields.String(),
+		name, pbName, pbName, toPb.String(),
+		name, pbName, name, name, fromPb.String())
+	return nil
+}
+
+// addRecord adds the struct of the record (or table of records) argument, named rec (as its message).
+func (types clientTypes) addRecord(arg Argument, rec string) error {
+	var subArgs []Argument
+	if arg.TableOf == nil {
+		for _, v := range arg.RecordOf {
+			subArgs = append(subArgs, *v.Argument)
+		}
+	} else if arg.TableOf.RecordOf == nil {
+		subArgs = append(subArgs, *arg.TableOf)
+	} else {
+		for _, v := range arg.TableOf.RecordOf {
+			subArgs = append(subArgs, *v.Argument)
+		}
+	}
+	typeName := arg.TypeName
+	if arg.TableOf != nil && arg.TableOf.TypeName != "" {
+		typeName = arg.TableOf.TypeName
+	}
+	return types.add(rec, rec, "the "+typeName+" record", subArgs)
+}
+
+// write writes the types, sorted by name.
+func (types clientTypes) write(w io.Writer) error {
+	names := make([]string, 0, len(types))
+	for nm := range types {
+		names = append(names, nm)
+	}
+	sort.Strings(names)
+	for _, nm := range names {
+		if _, err := io.WriteString(w, types[nm]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func returns(fun Function) []Argument {
+	if fun.Returns == nil {
+		return nil
+	}
+	return []Argument{*fun.Returns}
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oracall
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSaveClient(t *testing.T) {
+	defer func(gogo bool) { Gogo = gogo }(Gogo)
+	Gogo = true
+	cur := NewArgument("p_rows", "REF CURSOR", "REF CURSOR", "", "OUT", 0, "", 0, 0, 0)
+	row := NewArgument("", "PL/SQL RECORD", "PL/SQL RECORD", "DB_PKG.ROW_RT", "OUT", 0, "", 0, 0, 0)
+	id := NewArgument("id", "NUMBER", "PLS_INTEGER", "", "OUT", 0, "", 9, 0, 0)
+	row.RecordOf = append(row.RecordOf, NamedArgument{Name: "id", Argument: &id})
+	cur.TableOf = &row
+	functions := []Function{
+		{Package: "DB_PKG", name: "get_x",
+			Documentation: "Get the x.",
+			timeout:       2 * time.Second, maxAttempts: 3, idempotent: true,
+			Args: []Argument{
+				NewArgument("p_name", "VARCHAR2", "VARCHAR2", "", "IN", 0, "", 0, 0, 50),
+				NewArgument("p_date", "DATE", "DATE", "", "IN", 0, "", 0, 0, 0),
+				NewArgument("p_id", "NUMBER", "PLS_INTEGER", "", "OUT", 0, "", 9, 0, 0),
+			}},
+		{Package: "DB_PKG", name: "put_x", maxAttempts: 3,
+			Args: []Argument{
+				NewArgument("p_amount", "NUMBER", "NUMBER", "", "IN", 0, "", 0, 0, 0),
+			}},
+		{Package: "DB_PKG", name: "list_x", Args: []Argument{cur}},
+	}
+	var buf bytes.Buffer
+	if err := SaveClient(&buf, functions, "client", "example.com/pb", "db_pkg"); err != nil {
+		t.Fatal(err)
+	}
+	t.Log(buf.String())
+	if _, err := parser.ParseFile(token.NewFileSet(), "client.go", buf.Bytes(), 0); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`"GetX": {Timeout: 2000 * time.Millisecond, MaxAttempts: 3}`,
+		`"GetX": true,`,
+		"func (c *Client) GetX(ctx context.Context, input *GetXInput, opts ...grpc.CallOption) (*GetXOutput, error)",
+		"func (c *Client) ListX(ctx context.Context, input *ListXInput, f func(*ListXOutput) error",
+		"func (c *Client) ListXRows(ctx context.Context, input *ListXInput, f func(*RowRt_DbPkg) error",
+		"PDate time.Time",
+		"p.PDate = &custom.DateTime{Time: x.PDate}",
+		"PId godror.Number",
+		"x.PId = godror.Number(p.PId)",
+		"PAmount godror.Number",
+		"p.PAmount = string(x.PAmount)",
+		"PRows []*RowRt_DbPkg",
+		"Id godror.Number",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("missing %q", want)
+		}
+	}
+	for _, notWant := range []string{`"PutX": {`, `"PutX": true`} {
+		if strings.Contains(buf.String(), notWant) {
+			t.Errorf("the not idempotent PutX is retried (%q)", notWant)
+		}
+	}
+}
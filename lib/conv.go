@@ -0,0 +1,146 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oracall
+
+import (
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/godror/godror"
+	"github.com/tgulacsi/oracall/custom/timeparse"
+	errors "golang.org/x/xerrors"
+)
+
+// simpleConv is the conversion of the values of a simple Oracle type,
+// between the field of the generated struct (and its JSON) and the bind variable.
+//
+// The code generator (goType, PlsType.ToOra and FromOra) and Invoke (bind.param and setOutput)
+// both use these, so the generated code and the dynamic calls convert the values the same way.
+type simpleConv struct {
+	// goType is the Go type of the bind variable.
+	goType string
+	typ    reflect.Type
+	// outPtr marks the types whose (not table) output is a pointer in the generated struct.
+	outPtr bool
+	// toBind and fromBind are the formats of the generated Go expressions converting
+	// the field to the bind value, and back - for the Gogo structs only, if gogo is set.
+	toBind, fromBind string
+	gogo             bool
+	// parse converts the string form of the JSON value to the bind value.
+	parse func(string) (interface{}, error)
+	// format converts the bind value to the JSON value of the field, nil for NULL.
+	format func(interface{}) interface{}
+}
+
+var (
+	stringConv = simpleConv{goType: "string", typ: reflect.TypeOf(""),
+		parse: func(s string) (interface{}, error) { return s, nil },
+	}
+	bytesConv = simpleConv{goType: "[]byte", typ: reflect.TypeOf([]byte(nil)),
+		parse: func(s string) (interface{}, error) { return base64.StdEncoding.DecodeString(s) },
+	}
+	numberConv = simpleConv{goType: "godror.Number", typ: reflect.TypeOf(godror.Number("")),
+		toBind: "godror.Number(%s)", fromBind: "string(%s)",
+		parse:  func(s string) (interface{}, error) { return godror.Number(s), nil },
+		format: func(v interface{}) interface{} { return string(v.(godror.Number)) },
+	}
+	int64Conv = simpleConv{goType: "int64", typ: reflect.TypeOf(int64(0)), outPtr: true,
+		parse: func(s string) (interface{}, error) { return strconv.ParseInt(s, 10, 64) },
+	}
+	int32Conv = simpleConv{goType: "int32", typ: reflect.TypeOf(int32(0)),
+		fromBind: "int32(%s)",
+		parse: func(s string) (interface{}, error) {
+			i, err := strconv.ParseInt(s, 10, 32)
+			return int32(i), err
+		},
+	}
+	boolConv = simpleConv{goType: "bool", typ: reflect.TypeOf(false), outPtr: true,
+		parse: func(s string) (interface{}, error) { return strconv.ParseBool(s) },
+	}
+	timeConv = simpleConv{goType: "time.Time", typ: reflect.TypeOf(time.Time{}),
+		toBind: "custom.AsDate(%s).Time", fromBind: "&custom.DateTime{Time:%s}", gogo: true,
+		parse: func(s string) (interface{}, error) { return timeparse.Parse(s) },
+		format: func(v interface{}) interface{} {
+			if t := v.(time.Time); !t.IsZero() {
+				return t.In(time.Local)
+			}
+			return nil
+		},
+	}
+)
+
+// simpleConvs are the conversions of the simple types, by their Oracle names.
+var simpleConvs = map[string]*simpleConv{
+	"CHAR": &stringConv, "VARCHAR2": &stringConv, "ROWID": &stringConv, "CLOB": &stringConv,
+	"RAW": &bytesConv, "BLOB": &bytesConv,
+	"NUMBER":      &numberConv,
+	"INTEGER":     &int64Conv,
+	"PLS_INTEGER": &int32Conv, "BINARY_INTEGER": &int32Conv,
+	"BOOLEAN": &boolConv, "PL/SQL BOOLEAN": &boolConv,
+	"DATE": &timeConv, "DATETIME": &timeConv, "TIME": &timeConv, "TIMESTAMP": &timeConv,
+}
+
+// typeConvs are the conversions by the types of the bind values.
+var typeConvs = make(map[reflect.Type]*simpleConv, 7)
+
+func init() {
+	for _, c := range simpleConvs {
+		typeConvs[c.typ] = c
+	}
+}
+
+// genToBind returns the generated expression converting src to the bind value.
+func (c *simpleConv) genToBind(src string) string { return c.genToBindOf(src, Gogo) }
+
+// genToBindOf is genToBind for the Gogo structs if gogo is set, for the plain ones otherwise.
+func (c *simpleConv) genToBindOf(src string, gogo bool) string {
+	if c == nil || c.toBind == "" || c.gogo && !gogo {
+		return src
+	}
+	return fmt.Sprintf(c.toBind, src)
+}
+
+// genFromBind returns the generated expression converting the bind value src to the field's value.
+func (c *simpleConv) genFromBind(src string) string { return c.genFromBindOf(src, Gogo) }
+
+// genFromBindOf is genFromBind for the Gogo structs if gogo is set, for the plain ones otherwise.
+func (c *simpleConv) genFromBindOf(src string, gogo bool) string {
+	if c == nil || c.fromBind == "" || c.gogo && !gogo {
+		return src
+	}
+	return fmt.Sprintf(c.fromBind, src)
+}
+
+// valueOf converts the JSON string to the bind value.
+func (c *simpleConv) valueOf(s string) (interface{}, error) {
+	v, err := c.parse(s)
+	if err != nil {
+		return nil, errors.Errorf("convert %q to %s: %v: %w", s, c.goType, err, ErrInvalidArgument)
+	}
+	return v, nil
+}
+
+// jsonOf returns the bind value as it is in the JSON of the generated structs.
+func (c *simpleConv) jsonOf(v interface{}) interface{} {
+	if c == nil || c.format == nil || v == nil {
+		return v
+	}
+	return c.format(v)
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oracall
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/godror/godror"
+)
+
+// TestConvGeneratedAndInvoke converts the arguments of the same Function by the generated code and by Invoke.
+func TestConvGeneratedAndInvoke(t *testing.T) {
+	defer func(gogo bool) { Gogo = gogo }(Gogo)
+	Gogo = true
+	fun := Function{Package: "DB_PKG", name: "conv", Args: []Argument{
+		NewArgument("p_name", "VARCHAR2", "VARCHAR2", "", "IN", 0, "", 0, 0, 10),
+		NewArgument("p_num", "NUMBER", "NUMBER", "", "IN", 0, "", 0, 0, 0),
+		NewArgument("p_int", "PLS_INTEGER", "PLS_INTEGER", "", "IN", 0, "", 0, 0, 0),
+		NewArgument("p_date", "DATE", "DATE", "", "IN", 0, "", 0, 0, 0),
+		NewArgument("p_raw", "RAW", "RAW", "", "IN", 0, "", 0, 0, 10),
+		NewArgument("p_onum", "NUMBER", "NUMBER", "", "OUT", 0, "", 0, 0, 0),
+		NewArgument("p_odate", "DATE", "DATE", "", "OUT", 0, "", 0, 0, 0),
+	}}
+	_, callFun := fun.PlsqlBlock("")
+	binds := make(map[string]bind)
+	if _, _, _, _, _, _, err := fun.prepareCallBinds(binds); err != nil {
+		t.Fatal(err)
+	}
+	input := map[string]interface{}{
+		"p_name": "x", "p_num": json.Number("3.14"), "p_int": json.Number("-2"),
+		"p_date": "2020-01-02 03:04:05", "p_raw": "AQI=",
+	}
+	ctx := context.Background()
+	for _, arg := range fun.Args {
+		c := simpleConvs[arg.Type]
+		got, err := arg.goType(true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c.goType {
+			t.Errorf("%s: generated type %q, conversion is for %q", arg.Name, got, c.goType)
+		}
+
+		p, err := binds[arg.Name].param(ctx, input)
+		if err != nil {
+			t.Fatalf("%s: %+v", arg.Name, err)
+		}
+		if arg.IsOutput() {
+			dest := p.(sql.Out).Dest
+			if typ := reflect.TypeOf(dest).Elem(); typ != c.typ {
+				t.Errorf("%s: Invoke binds %s, the generated code %s", arg.Name, typ, c.goType)
+			}
+			continue
+		}
+		if reflect.TypeOf(p) != c.typ {
+			t.Errorf("%s: Invoke binds %T, the generated code %s", arg.Name, p, c.goType)
+		}
+		want, err := c.valueOf(jsonString(input[arg.Name]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(p, want) {
+			t.Errorf("%s: Invoke binds %#v, wanted %#v", arg.Name, p, want)
+		}
+		if expr := c.genToBind("input." + CamelCase(arg.Name)); !strings.Contains(callFun, expr) {
+			t.Errorf("%s: the generated code does not convert with %q:\n%s", arg.Name, expr, callFun)
+		}
+	}
+	if p, _ := binds["p_date"].param(ctx, input); !p.(time.Time).Equal(time.Date(2020, 1, 2, 3, 4, 5, 0, time.Local)) {
+		t.Errorf("p_date: got %v", p)
+	}
+
+	// the outputs: the generated code reads the NUMBER as the string field, and sets the zero DATE to nil
+	if expr := "(*godror.Number)(unsafe.Pointer(&output.POnum))"; !strings.Contains(callFun, expr) {
+		t.Errorf("p_onum: the generated code does not bind %q:\n%s", expr, callFun)
+	}
+	if expr := "output.POdate.IsZero()"; !strings.Contains(callFun, expr) {
+		t.Errorf("p_odate: the generated code does not clear the zero date:\n%s", callFun)
+	}
+	output := make(map[string]interface{})
+	num, date := godror.Number("-1.5"), time.Time{}
+	if err := binds["p_onum"].setOutput(output, &num); err != nil {
+		t.Fatal(err)
+	}
+	if err := binds["p_odate"].setOutput(output, &date); err != nil {
+		t.Fatal(err)
+	}
+	if output["p_onum"] != "-1.5" || output["p_odate"] != nil {
+		t.Errorf("output: got %#v", output)
+	}
+}
+
+func jsonString(v interface{}) string {
+	if n, ok := v.(json.Number); ok {
+		return n.String()
+	}
+	return v.(string)
+}
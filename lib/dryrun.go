@@ -0,0 +1,57 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oracall
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+type dryRun struct {
+	rolledBack int32
+}
+
+const dryRunCtxKey = ctxKey("dryRun")
+
+// ContextWithDryRun returns a context which makes the generated calls
+// roll back their transaction instead of committing it.
+//
+// Note that this cannot prevent the COMMITs in the called PL/SQL code,
+// nor the autonomous transactions.
+func ContextWithDryRun(ctx context.Context) context.Context {
+	return context.WithValue(ctx, dryRunCtxKey, new(dryRun))
+}
+
+// IsDryRun reports whether the context is a dry-run one.
+func IsDryRun(ctx context.Context) bool {
+	_, ok := ctx.Value(dryRunCtxKey).(*dryRun)
+	return ok
+}
+
+// MarkRolledBack records that the transaction has been rolled back instead of committing it.
+func MarkRolledBack(ctx context.Context) {
+	if dr, ok := ctx.Value(dryRunCtxKey).(*dryRun); ok {
+		atomic.StoreInt32(&dr.rolledBack, 1)
+	}
+}
+
+// IsRolledBack reports whether the transaction of the dry-run call has been rolled back
+// (instead of committing it).
+func IsRolledBack(ctx context.Context) bool {
+	dr, ok := ctx.Value(dryRunCtxKey).(*dryRun)
+	return ok && atomic.LoadInt32(&dr.rolledBack) != 0
+}
@@ -0,0 +1,41 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oracall
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDryRun(t *testing.T) {
+	ctx := context.Background()
+	MarkRolledBack(ctx)
+	if IsDryRun(ctx) || IsRolledBack(ctx) {
+		t.Error("plain context is dry-run")
+	}
+	ctx = ContextWithDryRun(ctx)
+	if !IsDryRun(ctx) {
+		t.Error("not dry-run")
+	}
+	if IsRolledBack(ctx) {
+		t.Error("rolled back before MarkRolledBack")
+	}
+	MarkRolledBack(context.WithValue(ctx, ctxKey("other"), 1))
+	if !IsRolledBack(ctx) {
+		t.Error("not rolled back after MarkRolledBack")
+	}
+}
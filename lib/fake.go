@@ -0,0 +1,153 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oracall
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FakeMethod is a method of a generated FakeServer, programmed for the unit tests.
+//
+// The fields should be set before the calls.
+type FakeMethod struct {
+	// Outputs are the canned outputs: the unary methods return the first one (or an empty output),
+	// the streaming methods send all of them (each with a batch of rows).
+	Outputs []interface{}
+	// Err is returned by the calls - after the Outputs have been sent, for the streaming methods.
+	Err error
+	// Latency is waited for before returning (or sending) anything.
+	Latency time.Duration
+	// Func, if not nil, returns the outputs and the error of each call, instead of Outputs and Err.
+	Func func(ctx context.Context, input interface{}) ([]interface{}, error)
+
+	mu     sync.Mutex
+	inputs []interface{}
+}
+
+// Call records the input, waits the Latency, and returns the outputs and the error of the call.
+func (m *FakeMethod) Call(ctx context.Context, input interface{}) ([]interface{}, error) {
+	m.mu.Lock()
+	m.inputs = append(m.inputs, input)
+	m.mu.Unlock()
+	if m.Latency > 0 {
+		t := time.NewTimer(m.Latency)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		case <-t.C:
+		}
+	}
+	if m.Func != nil {
+		return m.Func(ctx, input)
+	}
+	return m.Outputs, m.Err
+}
+
+// Inputs returns the inputs of the calls so far.
+func (m *FakeMethod) Inputs() []interface{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]interface{}(nil), m.inputs...)
+}
+
+// FakeMethods are the FakeMethods of a generated FakeServer, by method name.
+type FakeMethods struct {
+	mu      sync.Mutex
+	methods map[string]*FakeMethod
+}
+
+// Method returns the FakeMethod of the named method, creating it on the first call.
+func (fm *FakeMethods) Method(name string) *FakeMethod {
+	fm.mu.Lock()
+	defer fm.mu.Unlock()
+	if m := fm.methods[name]; m != nil {
+		return m
+	}
+	if fm.methods == nil {
+		fm.methods = make(map[string]*FakeMethod)
+	}
+	m := new(FakeMethod)
+	fm.methods[name] = m
+	return m
+}
+
+// saveFakes writes the Server interface of the methods of the generated server,
+// and the FakeServer implementing it.
+func saveFakes(w io.Writer, functions []Function) error {
+	var iface, fakes bytes.Buffer
+	for _, fun := range functions {
+		fn := fun.name
+		if fun.alias != "" {
+			fn = fun.alias
+		}
+		fn = strings.Replace(fn, ".", "__", -1)
+		name := CamelCase(fn)
+		input, output := "pb."+CamelCase(fun.getStructName(false, false)), "pb."+CamelCase(fun.getStructName(true, false))
+		if !fun.HasCursorOut() {
+			fmt.Fprintf(&iface, "\t%s(ctx context.Context, input *%s) (*%s, error)\n", name, input, output)
+			fmt.Fprintf(&fakes, `
+func (s *FakeServer) %s(ctx context.Context, input *%s) (*%s, error) {
+	outputs, err := s.Method(%q).Call(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	if len(outputs) == 0 {
+		return new(%s), nil
+	}
+	return outputs[0].(*%s), nil
+}
+`, name, input, output, name, output, output)
+			continue
+		}
+		stream := fmt.Sprintf("pb.%s_%sServer", CamelCase(fun.Package), name)
+		fmt.Fprintf(&iface, "\t%s(input *%s, stream %s) error\n", name, input, stream)
+		fmt.Fprintf(&fakes, `
+func (s *FakeServer) %s(input *%s, stream %s) error {
+	outputs, err := s.Method(%q).Call(stream.Context(), input)
+	for _, output := range outputs {
+		if sendErr := stream.Send(output.(*%s)); sendErr != nil {
+			return sendErr
+		}
+	}
+	return err
+}
+`, name, input, stream, name, output)
+	}
+	_, err := fmt.Fprintf(w, `
+// Server is the interface of the methods of the generated server, implemented by FakeServer, too.
+type Server interface {
+%s}
+
+var _ = Server((*oracallServer)(nil))
+var _ = Server((*FakeServer)(nil))
+
+// FakeServer is a fake Server for unit tests, without a database:
+// each method returns what its oracall.FakeMethod (see Method) is programmed with,
+// and records the inputs.
+type FakeServer struct {
+	oracall.FakeMethods
+}
+%s`, iface.String(), fakes.String())
+	return err
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oracall
+
+import (
+	"bytes"
+	"context"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+	"time"
+
+	errors "golang.org/x/xerrors"
+)
+
+func TestFakeMethod(t *testing.T) {
+	var fm FakeMethods
+	m := fm.Method("GetX")
+	if fm.Method("GetX") != m {
+		t.Fatal("Method returned a new FakeMethod")
+	}
+	m.Outputs = []interface{}{"a", "b"}
+	outputs, err := m.Call(context.Background(), 1)
+	if err != nil || len(outputs) != 2 {
+		t.Errorf("got %v, %v", outputs, err)
+	}
+
+	m.Err, m.Latency = errors.New("boom"), time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err = m.Call(ctx, 2); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, wanted DeadlineExceeded", err)
+	}
+	m.Latency = 0
+	if _, err = m.Call(context.Background(), 3); err == nil || err.Error() != "boom" {
+		t.Errorf("got %v, wanted boom", err)
+	}
+
+	if got := m.Inputs(); len(got) != 3 || got[0] != 1 || got[2] != 3 {
+		t.Errorf("got inputs %v", got)
+	}
+}
+
+func TestSaveFakes(t *testing.T) {
+	functions := []Function{
+		{Package: "DB_PKG", name: "get_x"},
+		{Package: "DB_PKG", name: "list_x", Args: []Argument{{Name: "p_cur", Type: "REF CURSOR", Direction: DIR_OUT}}},
+	}
+	var buf bytes.Buffer
+	if err := saveFakes(&buf, functions); err != nil {
+		t.Fatal(err)
+	}
+	src := buf.String()
+	t.Log(src)
+	if _, err := parser.ParseFile(token.NewFileSet(), "fakes.go", "package x\n"+src, 0); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"GetX(ctx context.Context, input *pb.GetX_Input) (*pb.GetX_Output, error)",
+		"ListX(input *pb.ListX_Input, stream pb.DbPkg_ListXServer) error",
+		"func (s *FakeServer) ListX(input *pb.ListX_Input, stream pb.DbPkg_ListXServer) error",
+		"stream.Send(output.(*pb.ListX_Output))",
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("missing %q", want)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oracall
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"strings"
+	"sync"
+
+	errors "golang.org/x/xerrors"
+)
+
+// ErrNoDB is returned by the connections of NoDB.
+var ErrNoDB = errors.New("no database")
+
+var noDBOnce sync.Once
+
+// NoDB returns a *sql.DB without a database: each call fails with ErrNoDB at the beginning of the transaction
+// - after the input has been checked and converted, for the fuzz targets.
+func NoDB() *sql.DB {
+	noDBOnce.Do(func() { sql.Register("oracall-nodb", noDBDriver{}) })
+	db, _ := sql.Open("oracall-nodb", "")
+	return db
+}
+
+type noDBDriver struct{}
+
+func (noDBDriver) Open(string) (driver.Conn, error) { return nil, ErrNoDB }
+
+// SaveFunctionFuzz writes the Go fuzz targets (built only with Go 1.18 and later) of the functions:
+// each checks and converts the fuzzed inputs (seeded with inputs generated by InputGenerator),
+// calling the server with NoDB.
+func SaveFunctionFuzz(dst io.Writer, functions []Function, pkg, pbImport string) error {
+	var err error
+	w := errWriter{Writer: dst, err: &err}
+	if pbImport != "" {
+		pbImport = `pb "` + pbImport + `"`
+	}
+	fmt.Fprintf(w, `//go:build go1.18
+// +build go1.18
+
+// Code generated by oracall, DO NOT EDIT.
+
+package %s
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	errors "golang.org/x/xerrors"
+
+	oracall "github.com/tgulacsi/oracall/lib"
+	"github.com/tgulacsi/oracall/oragrpc"
+	%s
+)
+
+var _ oragrpc.SendStream // against "unused import" error
+
+var fuzzServer = NewServer(oracall.NoDB(), nil)
+
+// fuzzError reports the errors other than the expected ones: ErrNoDB (or ErrNoSession), and the invalid input.
+func fuzzError(t *testing.T, err error) {
+	if err != nil && !errors.Is(err, oracall.ErrNoDB) && !errors.Is(err, oracall.ErrNoSession) &&
+		!errors.Is(err, oracall.ErrInvalidArgument) {
+		t.Error(err)
+	}
+}
+`, pkg, pbImport)
+
+	rnd := rand.New(rand.NewSource(1))
+	seen := make(map[string]struct{}, 16)
+	for _, fun := range functions {
+		if err := fun.SaveProtobuf(ioutil.Discard, seen); err != nil {
+			if SkipMissingTableOf && (errors.Is(err, ErrMissingTableOf) || errors.Is(err, UnknownSimpleType)) {
+				continue
+			}
+			return errors.Errorf("%s: %w", fun.Name(), err)
+		}
+		fn := fun.name
+		if fun.alias != "" {
+			fn = fun.alias
+		}
+		name := CamelCase(strings.Replace(fn, ".", "__", -1))
+		input := "pb." + CamelCase(fun.getStructName(false, false))
+
+		seeds := make([]string, 0, 3)
+		for _, boundary := range []bool{false, false, true} {
+			b, err := json.Marshal(InputGenerator{Rand: rnd, Boundary: boundary}.Input(fun))
+			if err != nil {
+				return errors.Errorf("%s: %w", fun.Name(), err)
+			}
+			seeds = append(seeds, fmt.Sprintf("%q", b))
+		}
+		call := fmt.Sprintf("_, err := fuzzServer.%s(ctx, &input)", name)
+		if fun.HasCursorOut() {
+			call = fmt.Sprintf(`err := fuzzServer.%s(&input, sendStream%s{oragrpc.SendStream{Ctx: ctx, SendFunc: func(interface{}) error { return nil }}})`,
+				name, name)
+		}
+		fmt.Fprintf(w, `
+func Fuzz%s(f *testing.F) {
+	for _, seed := range []string{
+		%s,
+	} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var input %s
+		if json.Unmarshal(data, &input) != nil {
+			return
+		}
+		ctx := context.Background()
+		%s
+		fuzzError(t, err)
+	})
+}
+`, name, strings.Join(seeds, ",\n\t\t"), input, call)
+	}
+	return err
+}
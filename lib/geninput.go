@@ -0,0 +1,239 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oracall
+
+import (
+	"math/rand"
+	"strings"
+	"time"
+)
+
+var (
+	// DefaultMinDate and DefaultMaxDate are the range of the valid dates (see CheckDate),
+	// and the default range of the dates generated by InputGenerator
+	// - the first second of year 1 would be the zero time, which means NULL.
+	DefaultMinDate = time.Date(1, 1, 1, 0, 0, 1, 0, time.UTC)
+	DefaultMaxDate = time.Date(9999, 12, 31, 23, 59, 59, 0, time.UTC)
+)
+
+// maxGenLength is the maximum length of the random (not boundary) strings.
+const maxGenLength = 64
+
+// InputGenerator generates random, but valid inputs of the functions:
+// the strings are not longer than the Charlength (as Oracle counts it), the numbers have at most Precision digits (Scale after the point),
+// the dates are in the MinDate..MaxDate range, and the tables are not longer than the max-table-size of the function
+// (and the required strings and tables are not empty).
+type InputGenerator struct {
+	Rand *rand.Rand
+	// Boundary generates the boundary values: the strings of the maximum length, the numbers with the maximum digits,
+	// the dates at the ends of the range, and empty (the required ones full) tables.
+	Boundary bool
+	// MinDate and MaxDate are the range of the dates - DefaultMinDate and DefaultMaxDate if zero.
+	MinDate, MaxDate time.Time
+}
+
+// Input returns a new input of the function, as its JSON representation (keyed by the lowercase argument names),
+// without the injected arguments.
+func (g InputGenerator) Input(fun Function) map[string]interface{} {
+	if g.Rand == nil {
+		g.Rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	if g.MinDate.IsZero() {
+		g.MinDate = DefaultMinDate
+	}
+	if g.MaxDate.IsZero() {
+		g.MaxDate = DefaultMaxDate
+	}
+	tableSize := fun.maxTableSize
+	if tableSize <= 0 {
+		tableSize = MaxTableSize
+	}
+	input := make(map[string]interface{}, len(fun.Args))
+	for _, arg := range fun.Args {
+		if !arg.IsInput() || arg.Inject != "" {
+			continue
+		}
+		if v := g.value(arg, tableSize); v != nil {
+			input[strings.ToLower(replHidden(arg.Name))] = v
+		}
+	}
+	return input
+}
+
+func (g InputGenerator) value(arg Argument, tableSize int) interface{} {
+	switch arg.Flavor {
+	case FLAVOR_RECORD:
+		m := make(map[string]interface{}, len(arg.RecordOf))
+		for _, sub := range arg.RecordOf {
+			if v := g.value(*sub.Argument, tableSize); v != nil {
+				m[strings.ToLower(replHidden(sub.Name))] = v
+			}
+		}
+		return m
+	case FLAVOR_TABLE:
+		if arg.TableOf == nil || arg.Type == "REF CURSOR" {
+			return nil
+		}
+		n := 0
+		if !g.Boundary {
+			n = 1 + g.Rand.Intn(tableSize)
+		} else if arg.Required {
+			n = tableSize
+		}
+		vs := make([]interface{}, 0, n)
+		for i := 0; i < n; i++ {
+			vs = append(vs, g.value(*arg.TableOf, tableSize))
+		}
+		return vs
+	}
+
+	switch arg.Type {
+	case "CHAR", "NCHAR", "VARCHAR", "NVARCHAR", "VARCHAR2", "NVARCHAR2", "ROWID", "CLOB":
+		n := int(arg.Charlength)
+		if n <= 0 || arg.Type == "CLOB" {
+			n = DefaultMaxVARCHARLength
+		}
+		if g.Boundary {
+			return g.str(n)
+		}
+		max := n
+		if n > maxGenLength {
+			n = maxGenLength
+		}
+		if n = g.Rand.Intn(n + 1); n == 0 && arg.Required {
+			n = 1
+		}
+		// with accented letters, too, but not longer than Oracle accepts
+		s := []rune(g.accented(n))
+		for len(s) > 1 && arg.strLen(string(s)) > max {
+			s = s[:len(s)-1]
+		}
+		if arg.strLen(string(s)) > max {
+			return g.str(len(s))
+		}
+		return string(s)
+	case "RAW", "BLOB":
+		n := int(arg.Charlength)
+		if n <= 0 {
+			n = maxGenLength
+		}
+		if !g.Boundary {
+			n = g.Rand.Intn(n + 1)
+		}
+		b := make([]byte, n)
+		g.Rand.Read(b)
+		return b
+	case "NUMBER":
+		return g.number(int(arg.Precision), int(arg.Scale))
+	case "INTEGER":
+		if g.Boundary {
+			return int64(1<<63 - 1)
+		}
+		return g.Rand.Int63()
+	case "PLS_INTEGER", "BINARY_INTEGER":
+		if g.Boundary {
+			return int32(1<<31 - 1)
+		}
+		return g.Rand.Int31()
+	case "BOOLEAN", "PL/SQL BOOLEAN":
+		return g.Rand.Intn(2) == 1
+	case "DATE", "DATETIME", "TIME", "TIMESTAMP":
+		t := g.MaxDate
+		if g.Boundary {
+			if g.Rand.Intn(2) == 0 {
+				t = g.MinDate
+			}
+		} else {
+			min := g.MinDate.Unix()
+			t = time.Unix(min+g.Rand.Int63n(g.MaxDate.Unix()-min+1), 0)
+		}
+		return t.UTC().Format(time.RFC3339)
+	}
+	return nil
+}
+
+const genLetters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789 "
+
+// genAccented are the (Hungarian) accented letters, for the random strings.
+const genAccented = "áéíóöőúüűÁÉÍÓÖŐÚÜŰ"
+
+func (g InputGenerator) str(n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = genLetters[g.Rand.Intn(len(genLetters))]
+	}
+	return string(b)
+}
+
+// accented returns a string of n letters, some of them accented.
+func (g InputGenerator) accented(n int) string {
+	accented := []rune(genAccented)
+	b := make([]rune, n)
+	for i := range b {
+		if g.Rand.Intn(4) == 0 {
+			b[i] = accented[g.Rand.Intn(len(accented))]
+		} else {
+			b[i] = rune(genLetters[g.Rand.Intn(len(genLetters))])
+		}
+	}
+	return string(b)
+}
+
+// number returns a number with at most precision-scale digits before, and scale digits after the decimal point,
+// as a string (godror.Number).
+func (g InputGenerator) number(precision, scale int) string {
+	intDigits := precision - scale
+	if intDigits < 0 {
+		intDigits = 0
+	}
+	if precision == 0 {
+		intDigits = 38 - scale
+		if !g.Boundary {
+			intDigits = 18
+		}
+	}
+	digits := func(n int) string {
+		if g.Boundary {
+			return strings.Repeat("9", n)
+		}
+		n = g.Rand.Intn(n + 1)
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = byte('0' + g.Rand.Intn(10))
+		}
+		return strings.TrimLeft(string(b), "0")
+	}
+	var buf strings.Builder
+	if g.Rand.Intn(2) == 0 {
+		buf.WriteByte('-')
+	}
+	s := digits(intDigits)
+	if s == "" {
+		s = "0"
+	}
+	buf.WriteString(s)
+	if scale > 0 {
+		if f := strings.TrimRight(digits(scale), "0"); f != "" {
+			buf.WriteByte('.')
+			buf.WriteString(f)
+		}
+	}
+	if s := buf.String(); s != "-0" {
+		return s
+	}
+	return "0"
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oracall
+
+import (
+	"bytes"
+	"context"
+	"go/parser"
+	"go/token"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	errors "golang.org/x/xerrors"
+)
+
+func genInputFunction() Function {
+	tab := NewArgument("p_tab", "PL/SQL TABLE", "PL/SQL TABLE", "DB_PKG.NUM_TAB_TYP", "IN", 0, "", 0, 0, 0)
+	elt := NewArgument("", "NUMBER", "NUMBER", "", "IN", 0, "", 5, 2, 0)
+	tab.TableOf = &elt
+	return Function{Package: "DB_PKG", name: "get_x", maxTableSize: 3,
+		Args: []Argument{
+			NewArgument("p_name", "VARCHAR2", "VARCHAR2", "", "IN", 0, "", 0, 0, 10),
+			NewArgument("p_amount", "NUMBER", "NUMBER", "", "IN", 0, "", 5, 2, 0),
+			NewArgument("p_date", "DATE", "DATE", "", "IN", 0, "", 0, 0, 0),
+			NewArgument("p_id", "BINARY_INTEGER", "PLS_INTEGER", "", "OUT", 0, "", 0, 0, 0),
+			tab,
+		}}
+}
+
+func TestInputGenerator(t *testing.T) {
+	fun := genInputFunction()
+	g := InputGenerator{Rand: rand.New(rand.NewSource(1))}
+	for i := 0; i < 100; i++ {
+		input := g.Input(fun)
+		if _, ok := input["p_id"]; ok {
+			t.Fatalf("%d. output in the input: %v", i, input)
+		}
+		if s := input["p_name"].(string); len(s) > 10 {
+			t.Errorf("%d. too long: %q", i, s)
+		}
+		if s := input["p_amount"].(string); ParseDigits(s, 3, 2) != nil {
+			t.Errorf("%d. %q is not NUMBER(5,2)", i, s)
+		}
+		if _, err := time.Parse(time.RFC3339, input["p_date"].(string)); err != nil {
+			t.Errorf("%d. %v", i, err)
+		}
+		if tab := input["p_tab"].([]interface{}); len(tab) == 0 || len(tab) > 3 {
+			t.Errorf("%d. table of %d", i, len(tab))
+		}
+	}
+
+	g.Boundary = true
+	input := g.Input(fun)
+	if s := input["p_name"].(string); len(s) != 10 {
+		t.Errorf("got %q, wanted 10 characters", s)
+	}
+	if s := strings.TrimPrefix(input["p_amount"].(string), "-"); s != "999.99" {
+		t.Errorf("got %q, wanted 999.99", s)
+	}
+	if tab := input["p_tab"].([]interface{}); len(tab) != 0 {
+		t.Errorf("got %v, wanted an empty table", tab)
+	}
+}
+
+func TestSaveFunctionFuzz(t *testing.T) {
+	var buf bytes.Buffer
+	if err := SaveFunctionFuzz(&buf, []Function{genInputFunction()}, "db", "example.com/pb"); err != nil {
+		t.Fatal(err)
+	}
+	src := buf.String()
+	t.Log(src)
+	if !strings.HasPrefix(src, "//go:build go1.18\n") {
+		t.Error("missing the build constraint")
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "fuzz_test.go", src, 0); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(src, "func FuzzGetX(f *testing.F) {") {
+		t.Error("missing FuzzGetX")
+	}
+
+	if _, err := NoDB().BeginTx(context.Background(), nil); !errors.Is(err, ErrNoDB) {
+		t.Errorf("got %v, wanted ErrNoDB", err)
+	}
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oracall
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	errors "golang.org/x/xerrors"
+)
+
+// apiNames are the names in the generated calls which differ between the gRPC server and the plain Go API:
+// the qualifier of the input and output types, and the type of the receiver of the calls, with its constructor,
+// and the qualifier of the conversion functions (the plain Go API uses custom/conv, which does not depend on protobuf).
+type apiNames struct {
+	Pb, Server, New, Conv string
+}
+
+var (
+	grpcAPI  = apiNames{Pb: "pb.", Server: "oracallServer", New: "NewServer", Conv: "custom."}
+	plainAPI = apiNames{Server: "DB", New: "NewDB", Conv: "conv."}
+)
+
+// gogo reports whether the dates of the api are the custom.DateTime of the Gogo structs.
+// The plain Go API has time.Time dates.
+func (api apiNames) gogo() bool { return Gogo && api.Pb != "" }
+
+// SaveGoAPI writes the plain Go API of the functions, as package pkg:
+// the structs of the inputs and outputs (with the same fields as the ones generated from the .proto file),
+// and a DB with a method for each function,
+//
+//	func (s *DB) PkgFunc(ctx context.Context, input *PkgFunc_Input) (*PkgFunc_Output, error)
+//
+// with the same calling and conversion code as the server written by SaveFunctions,
+// but without the Protocol Buffers package and gRPC: the dates are time.Time, not custom.DateTime.
+//
+// The functions with REF CURSOR outputs send their outputs to a <Package>_<Name>Server,
+// and get a <Name>Func method, too, calling a callback with each output.
+func SaveGoAPI(dst io.Writer, functions []Function, pkg string) error {
+	if pkg == "" {
+		return errors.Errorf("empty package name: %w", ErrInvalidArgument)
+	}
+	return saveFunctions(dst, functions, pkg, nil, true, plainAPI)
+}
+
+// saveStreams writes the stream interfaces of the plain Go API functions with REF CURSOR outputs,
+// and their <Name>Func methods.
+func saveStreams(w io.Writer, functions []Function) error {
+	for _, fun := range functions {
+		if !fun.HasCursorOut() {
+			continue
+		}
+		fn := fun.name
+		if fun.alias != "" {
+			fn = fun.alias
+		}
+		fn = CamelCase(strings.Replace(fn, ".", "__", -1))
+		input, output := CamelCase(fun.getStructName(false, false)), CamelCase(fun.getStructName(true, false))
+		server, adapter := CamelCase(fun.Package)+"_"+fn+"Server", "sendFunc"+fn
+		if _, err := fmt.Fprintf(w, `
+// %s receives the outputs of %s.
+type %s interface {
+	Context() context.Context
+	Send(*%s) error
+}
+
+// %sFunc calls %s, calling f with each output.
+func (s *%s) %sFunc(ctx context.Context, input *%s, f func(*%s) error) error {
+	return s.%s(input, %s{ctx: ctx, f: f})
+}
+
+type %s struct {
+	ctx context.Context
+	f   func(*%s) error
+}
+
+func (s %s) Context() context.Context { return s.ctx }
+func (s %s) Send(output *%s) error { return s.f(output) }
+`, server, fn, server, output,
+			fn, fn, plainAPI.Server, fn, input, output, fn, adapter,
+			adapter, output,
+			adapter, adapter, output); err != nil {
+			return err
+		}
+	}
+	return nil
+}
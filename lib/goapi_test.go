@@ -0,0 +1,155 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oracall
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestPlainType(t *testing.T) {
+	for i, tc := range []struct {
+		Arg   Argument
+		Plain bool
+		Want  string
+	}{
+		{NewArgument("p_name", "VARCHAR2", "VARCHAR2", "", "IN", 0, "", 0, 0, 50), true, "string"},
+		{NewArgument("p_id", "BINARY_INTEGER", "PLS_INTEGER", "", "OUT", 0, "", 0, 0, 0), true, "int32"},
+		{NewArgument("p_amount", "NUMBER", "NUMBER", "", "IN", 0, "", 12, 2, 0), true, "string"},
+		{NewArgument("p_date", "DATE", "DATE", "", "IN", 0, "", 0, 0, 0), true, "time.Time"},
+		{NewArgument("p_date", "DATE", "DATE", "", "IN", 0, "", 0, 0, 0), false, "*custom.DateTime"},
+	} {
+		got, rec, err := tc.Arg.plainType(tc.Plain)
+		if err != nil {
+			t.Fatalf("%d. %v", i, err)
+		}
+		if got != tc.Want || rec != "" {
+			t.Errorf("%d. got %q (%q), wanted %q", i, got, rec, tc.Want)
+		}
+	}
+}
+
+func TestSaveGoAPI(t *testing.T) {
+	// the plain Go API does not use the Gogo types, even if the server does
+	defer func(gogo bool) { Gogo = gogo }(Gogo)
+	Gogo = true
+	functions := testCases[0].ParseCsv(t, 0)
+	var buf bytes.Buffer
+	if err := SaveGoAPI(&buf, functions, "db"); err != nil {
+		t.Fatal(err)
+	}
+	src := buf.String()
+	t.Log(src)
+	f, err := parser.ParseFile(token.NewFileSet(), "db.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imports := make([]string, 0, len(f.Imports))
+	for _, imp := range f.Imports {
+		path, _ := strconv.Unquote(imp.Path.Value)
+		if isGRPCImport(path) || imp.Name != nil && imp.Name.Name == "pb" {
+			t.Errorf("imports %s", imp.Path.Value)
+		}
+		imports = append(imports, path)
+	}
+	// and not through the imported packages
+	cmd := exec.Command("go", append([]string{"list", "-deps"}, imports...)...)
+	var errBuf bytes.Buffer
+	cmd.Stderr = &errBuf
+	deps, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("go list -deps %q: %v\n%s", imports, err, errBuf.String())
+	}
+	for _, path := range strings.Fields(string(deps)) {
+		if isGRPCImport(path) {
+			t.Errorf("depends on %s", path)
+		}
+	}
+	for _, want := range []string{
+		"type Sendpreoffer_31101_Input struct",
+		"type Sendpreoffer_31101_Output struct",
+		"func NewDB(",
+		"func (s *DB) Sendpreoffer_31101(ctx context.Context, input *Sendpreoffer_31101_Input) (output *Sendpreoffer_31101_Output, err error)",
+		"output = new(Sendpreoffer_31101_Output)",
+		"oracall.CheckDate(s.Szerkot)",
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("missing %q", want)
+		}
+	}
+	for _, bad := range []string{"pb.", "oracallServer", "{{", "custom."} {
+		if strings.Contains(src, bad) {
+			t.Errorf("found %q", bad)
+		}
+	}
+}
+
+func TestSaveStreams(t *testing.T) {
+	functions := []Function{
+		{Package: "DB_PKG", name: "list_x", Args: []Argument{{Name: "p_cur", Type: "REF CURSOR", Direction: DIR_OUT}}},
+	}
+	var buf bytes.Buffer
+	if err := saveStreams(&buf, functions); err != nil {
+		t.Fatal(err)
+	}
+	src := buf.String()
+	t.Log(src)
+	if _, err := parser.ParseFile(token.NewFileSet(), "streams.go", "package x\n"+src, 0); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"type DbPkg_ListXServer interface",
+		"func (s *DB) ListXFunc(ctx context.Context, input *ListX_Input, f func(*ListX_Output) error) error",
+		"return s.ListX(input, sendFuncListX{ctx: ctx, f: f})",
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("missing %q", want)
+		}
+	}
+}
+
+// TestLibImports checks that the generated plain Go API does not depend on gRPC and protobuf through this package.
+func TestLibImports(t *testing.T) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, ".", func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, parser.ImportsOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pkg := range pkgs {
+		for fn, f := range pkg.Files {
+			for _, imp := range f.Imports {
+				if path, _ := strconv.Unquote(imp.Path.Value); isGRPCImport(path) {
+					t.Errorf("%s imports %s", fn, path)
+				}
+			}
+		}
+	}
+}
+
+func isGRPCImport(path string) bool {
+	return strings.HasPrefix(path, "google.golang.org/grpc") || strings.HasPrefix(path, "google.golang.org/protobuf") ||
+		strings.HasPrefix(path, "github.com/gogo/protobuf") ||
+		strings.HasPrefix(path, "github.com/golang/protobuf") || path == "github.com/tgulacsi/oracall/oragrpc"
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oracall
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// CallInfo describes a generated call, for the BeforeCall and AfterCall hooks.
+type CallInfo struct {
+	// FunName is the name of the called function (package.function).
+	FunName string
+	// Input and Output are the input and output messages of the call.
+	Input, Output interface{}
+	// Tx is the transaction of the call.
+	Tx *sql.Tx
+	// Err is the error of the call - set for AfterCall.
+	Err error
+	// Duration is the duration of the call - set for AfterCall.
+	Duration time.Duration
+}
+
+// BeforeCall is called in the transaction of the call, before executing it.
+// A returned error vetoes the call.
+type BeforeCall func(context.Context, *CallInfo) error
+
+// AfterCall is called once after executing the call, after its transaction has been finished:
+// committed, or rolled back on error. Err is the final error of the call, including the error of the commit.
+// A returned error is returned by the call instead - but it cannot undo the commit.
+//
+// For streaming calls, AfterCall is called after all the rows have been sent,
+// so the modification of the Output is not seen by the client.
+type AfterCall func(context.Context, *CallInfo) error
+
+// RunBeforeCalls calls the hooks, till the first error.
+func RunBeforeCalls(ctx context.Context, ci *CallInfo, hooks []BeforeCall) error {
+	for _, f := range hooks {
+		if err := f(ctx, ci); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunAfterCalls calls all the hooks, returning the first error.
+func RunAfterCalls(ctx context.Context, ci *CallInfo, hooks []AfterCall) error {
+	var firstErr error
+	for _, f := range hooks {
+		if err := f(ctx, ci); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,51 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oracall
+
+import (
+	"context"
+	"testing"
+
+	errors "golang.org/x/xerrors"
+)
+
+func TestRunHooks(t *testing.T) {
+	ctx := context.Background()
+	ci := &CallInfo{FunName: "pkg.fun"}
+	errVeto := errors.New("veto")
+	var called []string
+	before := func(name string, err error) BeforeCall {
+		return func(context.Context, *CallInfo) error { called = append(called, name); return err }
+	}
+	if err := RunBeforeCalls(ctx, ci, []BeforeCall{before("a", nil), before("b", errVeto), before("c", nil)}); err != errVeto {
+		t.Errorf("got %v, wanted %v", err, errVeto)
+	}
+	if len(called) != 2 {
+		t.Errorf("BeforeCall hooks after the veto have been called: %v", called)
+	}
+
+	called = called[:0]
+	after := func(name string, err error) AfterCall {
+		return func(context.Context, *CallInfo) error { called = append(called, name); return err }
+	}
+	if err := RunAfterCalls(ctx, ci, []AfterCall{after("a", nil), after("b", errVeto), after("c", errors.New("other"))}); err != errVeto {
+		t.Errorf("got %v, wanted %v", err, errVeto)
+	}
+	if len(called) != 3 {
+		t.Errorf("not all AfterCall hooks have been called: %v", called)
+	}
+}
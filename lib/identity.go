@@ -0,0 +1,125 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oracall
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/godror/godror"
+	errors "golang.org/x/xerrors"
+)
+
+// Identity is the authenticated end user of a call.
+type Identity struct {
+	// User is the name of the end user.
+	User string
+	// Proxy requests a proxy authenticated session for User
+	// ("ALTER USER user GRANT CONNECT THROUGH pool_user").
+	// This needs a heterogeneous pool ("heterogeneousPool=1" in the DSN).
+	Proxy bool
+	// Attributes are arbitrary name-value pairs, to be set as application context.
+	Attributes map[string]string
+}
+
+const identityCtxKey = ctxKey("identity")
+
+// ContextWithIdentity returns a context with the identity.
+func ContextWithIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, identityCtxKey, id)
+}
+
+// ContextGetIdentity returns the identity of the context.
+func ContextGetIdentity(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityCtxKey).(Identity)
+	return id, ok && id.User != ""
+}
+
+// ContextWithProxyUser returns a context which acquires a proxy authenticated
+// session for the user of the Identity of ctx, if that requests it.
+func ContextWithProxyUser(ctx context.Context) context.Context {
+	if id, ok := ContextGetIdentity(ctx); ok && id.Proxy {
+		return godror.ContextWithUserPassw(ctx, id.User, "", "")
+	}
+	return ctx
+}
+
+// SetIdentityPlsql returns a function usable as the SetIdentity hook of the generated server,
+// which executes the given PL/SQL block with the user as the first,
+// and the Attributes (in sorted "name=value" lines) as the second parameter,
+// such as
+//
+//	BEGIN my_ctx_pkg.set_user(:1, :2); END;
+//
+// in the transaction of the call, before the call.
+//
+// The calls without an Identity execute the block with the empty user and no attributes
+// (see ApplyIdentity), so the block must clear the application context then,
+// as the session may have been used by another user before.
+//
+// The attributes with "=" or newline in their name or value are rejected with ErrInvalidArgument.
+func SetIdentityPlsql(plsql string) func(context.Context, *sql.Tx, Identity) error {
+	return func(ctx context.Context, tx *sql.Tx, id Identity) error {
+		buf := Buffers.Get()
+		defer Buffers.Put(buf)
+		if err := writeAttributes(buf, id.Attributes); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, plsql, id.User, buf.String()); err != nil {
+			return errors.Errorf("%s [%q]: %w", plsql, id.User, err)
+		}
+		return nil
+	}
+}
+
+// writeAttributes writes the attributes as sorted "name=value" lines.
+// The names and values come from tokens and headers, so they must not contain "=" or "\n",
+// which would inject other attributes.
+func writeAttributes(w io.Writer, attrs map[string]string) error {
+	keys := make([]string, 0, len(attrs))
+	for k, v := range attrs {
+		if strings.ContainsAny(k, "=\n") || strings.ContainsAny(v, "=\n") {
+			return errors.Errorf("attribute %q=%q contains \"=\" or newline: %w", k, v, ErrInvalidArgument)
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if _, err := fmt.Fprintf(w, "%s=%s\n", k, attrs[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ApplyIdentity calls setIdentity (if not nil) in tx with the Identity of ctx,
+// or with the empty Identity if ctx has none - to clear the identity set
+// by a previous call on the same (pooled) session.
+func ApplyIdentity(ctx context.Context, tx *sql.Tx, setIdentity func(context.Context, *sql.Tx, Identity) error) error {
+	if setIdentity == nil {
+		return nil
+	}
+	id, ok := ContextGetIdentity(ctx)
+	if !ok {
+		id = Identity{}
+	}
+	return setIdentity(ctx, tx, id)
+}
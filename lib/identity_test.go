@@ -0,0 +1,91 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oracall
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+
+	errors "golang.org/x/xerrors"
+)
+
+func TestContextIdentity(t *testing.T) {
+	ctx := context.Background()
+	if _, ok := ContextGetIdentity(ctx); ok {
+		t.Error("got identity from empty context")
+	}
+	if got := ContextWithProxyUser(ctx); got != ctx {
+		t.Error("ContextWithProxyUser changed a context without identity")
+	}
+	ctx = ContextWithIdentity(ctx, Identity{User: "scott"})
+	if id, ok := ContextGetIdentity(ctx); !ok || id.User != "scott" {
+		t.Errorf("got %+v, %t", id, ok)
+	}
+	if got := ContextWithProxyUser(ctx); got != ctx {
+		t.Error("ContextWithProxyUser changed a context without Proxy")
+	}
+	if got := ContextWithProxyUser(ContextWithIdentity(ctx, Identity{User: "scott", Proxy: true})); got == ctx {
+		t.Error("ContextWithProxyUser didn't change a context with Proxy")
+	}
+}
+
+func TestApplyIdentity(t *testing.T) {
+	if err := ApplyIdentity(context.Background(), nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	var got []Identity
+	setIdentity := func(_ context.Context, _ *sql.Tx, id Identity) error {
+		got = append(got, id)
+		return nil
+	}
+	// the same pooled session: a call as scott, then a call without an identity
+	ctx := ContextWithIdentity(context.Background(), Identity{User: "scott", Attributes: map[string]string{"role": "admin"}})
+	if err := ApplyIdentity(ctx, nil, setIdentity); err != nil {
+		t.Fatal(err)
+	}
+	if err := ApplyIdentity(context.Background(), nil, setIdentity); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].User != "scott" {
+		t.Fatalf("got %+v", got)
+	}
+	if got[1].User != "" || len(got[1].Attributes) != 0 {
+		t.Errorf("the second call inherited %+v", got[1])
+	}
+}
+
+func TestIdentityAttributes(t *testing.T) {
+	var buf strings.Builder
+	if err := writeAttributes(&buf, map[string]string{"role": "user", "dept": "10"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "dept=10\nrole=user\n"; got != want {
+		t.Errorf("got %q, wanted %q", got, want)
+	}
+	for _, attrs := range []map[string]string{
+		{"dept": "10\nrole=admin"},
+		{"role=admin\ndept": "10"},
+		{"dept": "10=role"},
+	} {
+		buf.Reset()
+		if err := writeAttributes(&buf, attrs); !errors.Is(err, ErrInvalidArgument) {
+			t.Errorf("%q: got %v (%q), wanted ErrInvalidArgument", attrs, err, buf.String())
+		}
+	}
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oracall
+
+import "context"
+
+// The sources of the injectable values, usable in the
+//
+//	--oracall:inject p_user = auth.subject
+//
+// annotation.
+const (
+	// InjectAuthSubject is the User of the Identity of the context.
+	InjectAuthSubject = "auth.subject"
+	// InjectRequestID is the request ID of the context.
+	InjectRequestID = "request.id"
+	// InjectClientIP is the address of the client.
+	InjectClientIP = "client.ip"
+	// InjectLocale is the locale requested by the client.
+	InjectLocale = "locale"
+)
+
+// IsInjectSource reports whether src is a known inject source.
+func IsInjectSource(src string) bool {
+	switch src {
+	case InjectAuthSubject, InjectRequestID, InjectClientIP, InjectLocale:
+		return true
+	}
+	return false
+}
+
+const (
+	clientIPCtxKey = ctxKey("clientIP")
+	localeCtxKey   = ctxKey("locale")
+)
+
+// ContextWithClientIP returns a context with the client's address.
+func ContextWithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPCtxKey, ip)
+}
+
+// ContextWithLocale returns a context with the client's locale.
+func ContextWithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, localeCtxKey, locale)
+}
+
+// InjectValue returns the value of the inject source from the context,
+// or the empty string (NULL) if the context does not have it.
+func InjectValue(ctx context.Context, src string) string {
+	switch src {
+	case InjectAuthSubject:
+		id, _ := ContextGetIdentity(ctx)
+		return id.User
+	case InjectRequestID:
+		return ContextGetReqID(ctx)
+	case InjectClientIP:
+		s, _ := ctx.Value(clientIPCtxKey).(string)
+		return s
+	case InjectLocale:
+		s, _ := ctx.Value(localeCtxKey).(string)
+		return s
+	}
+	return ""
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oracall
+
+import (
+	"context"
+	"testing"
+)
+
+func TestInjectValue(t *testing.T) {
+	ctx := context.Background()
+	for _, src := range []string{InjectAuthSubject, InjectRequestID, InjectClientIP, InjectLocale, "unknown"} {
+		if got := InjectValue(ctx, src); got != "" {
+			t.Errorf("%s: got %q from empty context", src, got)
+		}
+	}
+	ctx = ContextWithIdentity(ctx, Identity{User: "scott"})
+	ctx = ContextWithReqID(ctx, "req-1")
+	ctx = ContextWithClientIP(ctx, "10.0.0.1")
+	ctx = ContextWithLocale(ctx, "hu-HU")
+	for src, want := range map[string]string{
+		InjectAuthSubject: "scott",
+		InjectRequestID:   "req-1",
+		InjectClientIP:    "10.0.0.1",
+		InjectLocale:      "hu-HU",
+		"unknown":         "",
+	} {
+		if got := InjectValue(ctx, src); got != want {
+			t.Errorf("%s: got %q, wanted %q", src, got, want)
+		}
+	}
+}
+
+func TestApplyInjectAnnotation(t *testing.T) {
+	functions := []Function{{
+		Package: "pkg", name: "fun",
+		Args: []Argument{
+			{Name: "p_user", Direction: DIR_IN},
+			{Name: "p_data", Direction: DIR_IN},
+			{Name: "p_out", Direction: DIR_OUT},
+		},
+	}}
+	functions = ApplyAnnotations(functions, []Annotation{
+		{Package: "pkg", Type: "inject", Name: "p_user", Other: InjectAuthSubject},
+		{Package: "pkg", Type: "inject", Name: "fun.p_out", Other: InjectLocale},
+		{Package: "pkg", Type: "inject", Name: "p_data", Other: "no.such.source"},
+	})
+	for _, a := range functions[0].Args {
+		want := map[string]string{"p_user": InjectAuthSubject}[a.Name]
+		if a.Inject != want {
+			t.Errorf("%s: got %q, wanted %q", a.Name, a.Inject, want)
+		}
+	}
+}
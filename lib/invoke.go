@@ -0,0 +1,413 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oracall
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/godror/godror"
+	errors "golang.org/x/xerrors"
+)
+
+// Preparer prepares statements - such as *sql.Tx, *sql.Conn or *sql.DB.
+type Preparer interface {
+	PrepareContext(context.Context, string) (*sql.Stmt, error)
+}
+
+// bind is a bind variable of the PL/SQL block of a function, as recorded by prepareCallBinds.
+type bind struct {
+	// path is the JSON path of the value: the name of the argument, and the name of the record field.
+	path []string
+	// arg is the bound argument, or record field.
+	arg Argument
+	// dir is the direction of the argument (of the record, for the record fields).
+	dir direction
+	// table marks the field of a table of records, bound as an associative array of the field's values.
+	table        bool
+	maxTableSize int
+}
+
+// Invoke calls the function dynamically - without code generation - with the JSON object input,
+// returning the output as a JSON object. The REF CURSOR outputs are returned as arrays of all their rows.
+//
+// The PL/SQL block and its bind variables are the same as the generated code's,
+// and the values are converted according to the same Go types (see InvokeMap).
+func (fun Function) Invoke(ctx context.Context, db Preparer, input json.RawMessage) (json.RawMessage, error) {
+	var in map[string]interface{}
+	if len(bytes.TrimSpace(input)) != 0 {
+		dec := json.NewDecoder(bytes.NewReader(input))
+		dec.UseNumber()
+		if err := dec.Decode(&in); err != nil {
+			return nil, errors.Errorf("decode input: %v: %w", err, ErrInvalidArgument)
+		}
+	}
+	out, err := fun.InvokeMap(ctx, db, in)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(out)
+}
+
+// InvokeMap calls the function dynamically, with the input decoded from JSON (json.Number is accepted for the numbers),
+// keyed by the argument and record field names, returning the output the same way.
+//
+// The values are converted by the same rules as in the generated code (see simpleConvs):
+// the DATEs are RFC3339 strings (see timeparse.Parse), the RAWs and BLOBs are base64 strings, the NUMBERs are json.Numbers (or strings).
+func (fun Function) InvokeMap(ctx context.Context, db Preparer, input map[string]interface{}) (map[string]interface{}, error) {
+	binds := make(map[string]bind)
+	decls, pre, call, post, _, _, err := fun.prepareCallBinds(binds)
+	if err != nil {
+		return nil, err
+	}
+	qry, keys := godror.MapToSlice(fun.plsqlText(decls, pre, call, post), func(key string) interface{} { return key })
+	if fun.Replacement != nil {
+		return fun.invokeReplacement(ctx, db, qry, input)
+	}
+
+	params := make([]interface{}, len(keys), len(keys)+1)
+	dests := make(map[string]interface{}, len(binds))
+	for i, k := range keys {
+		key := k.(string)
+		b, ok := lookupBind(binds, key)
+		if !ok {
+			return nil, errors.Errorf("%s: unknown bind variable %q", fun.Name(), key)
+		}
+		// the repeated (IN OUT) variables share the destination, as in the generated code
+		if dest, ok := dests[key]; ok {
+			params[i] = sql.Out{Dest: dest}
+			continue
+		}
+		if params[i], err = b.param(ctx, input); err != nil {
+			return nil, errors.Errorf("%s: %s: %w", fun.Name(), strings.Join(b.path, "."), err)
+		}
+		if o, ok := params[i].(sql.Out); ok {
+			dests[key] = o.Dest
+		}
+	}
+
+	stmt, err := db.PrepareContext(ctx, qry)
+	if err != nil {
+		return nil, errors.Errorf("%s: %w", qry, err)
+	}
+	defer stmt.Close()
+	if _, err = stmt.ExecContext(ctx, append(params, godror.PlSQLArrays)...); err != nil {
+		return nil, errors.Errorf("%s: %w", fun.Name(), err)
+	}
+
+	output := make(map[string]interface{}, len(dests))
+	for key, dest := range dests {
+		b, _ := lookupBind(binds, key)
+		if err = b.setOutput(output, dest); err != nil {
+			return output, errors.Errorf("%s: %s: %w", fun.Name(), key, err)
+		}
+	}
+	return output, nil
+}
+
+// InvokePlsql returns the PL/SQL block executed by Invoke, with the descriptions of its bind variables, in order.
+func (fun Function) InvokePlsql() (string, []string, error) {
+	binds := make(map[string]bind)
+	decls, pre, call, post, _, _, err := fun.prepareCallBinds(binds)
+	if err != nil {
+		return "", nil, err
+	}
+	qry, keys := godror.MapToSlice(fun.plsqlText(decls, pre, call, post), func(key string) interface{} { return key })
+	descs := make([]string, len(keys))
+	for i, k := range keys {
+		b, ok := lookupBind(binds, k.(string))
+		if !ok {
+			descs[i] = fmt.Sprintf(":%d %s", i+1, k)
+			continue
+		}
+		typ := "REF CURSOR"
+		if b.arg.Type != typ {
+			if c, err := b.conv(); err != nil {
+				typ = err.Error()
+			} else if typ = c.typ.String(); b.table || b.arg.Flavor == FLAVOR_TABLE {
+				typ = "[]" + typ
+			}
+		}
+		descs[i] = fmt.Sprintf(":%d %s %s %s", i+1, strings.Join(b.path, "."), b.dir, typ)
+	}
+	return qry, descs, nil
+}
+
+// lookupBind returns the bind of the key of the PL/SQL block.
+// The hidden arguments ("name#") are registered with MarkHidden, as in paramsIdx.
+func lookupBind(binds map[string]bind, key string) (bind, bool) {
+	b, ok := binds[key]
+	if !ok && strings.HasSuffix(key, "#") {
+		b, ok = binds[key[:len(key)-1]+MarkHidden]
+	}
+	return b, ok
+}
+
+// invokeReplacement calls the replacement function, which gets the input and returns the output as a JSON CLOB.
+func (fun Function) invokeReplacement(ctx context.Context, db Preparer, qry string, input map[string]interface{}) (map[string]interface{}, error) {
+	if !fun.ReplacementIsJSON {
+		return nil, errors.Errorf("%s: only the JSON replacements can be invoked dynamically: %w", fun.Name(), ErrInvalidArgument)
+	}
+	in, err := json.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+	stmt, err := db.PrepareContext(ctx, qry)
+	if err != nil {
+		return nil, errors.Errorf("%s: %w", qry, err)
+	}
+	defer stmt.Close()
+	var outCLOB string
+	if _, err = stmt.ExecContext(ctx, string(in), sql.Out{Dest: &outCLOB}); err != nil {
+		return nil, errors.Errorf("%s: %w", fun.Name(), err)
+	}
+	var output map[string]interface{}
+	dec := json.NewDecoder(strings.NewReader(outCLOB))
+	dec.UseNumber()
+	if err = dec.Decode(&output); err != nil && err != io.EOF {
+		return nil, errors.Errorf("%s: %w", outCLOB, err)
+	}
+	return output, nil
+}
+
+// conv returns the conversion of the simple values of the bind (the elements, for the tables).
+func (b bind) conv() (*simpleConv, error) {
+	arg := b.arg
+	if arg.Flavor == FLAVOR_TABLE {
+		if arg.TableOf == nil {
+			return nil, errors.Errorf("%s: %w", arg.Name, ErrMissingTableOf)
+		}
+		arg = *arg.TableOf
+	}
+	c, ok := simpleConvs[arg.Type]
+	if !ok || arg.Flavor != FLAVOR_SIMPLE {
+		return nil, errors.Errorf("%s (%s): %w", arg.Name, arg.Type, UnknownSimpleType)
+	}
+	return c, nil
+}
+
+// param returns the parameter of the bind, with the value from the input.
+func (b bind) param(ctx context.Context, input map[string]interface{}) (interface{}, error) {
+	if b.arg.Inject != "" {
+		return InjectValue(ctx, b.arg.Inject), nil
+	}
+	if b.arg.Type == "REF CURSOR" {
+		return sql.Out{Dest: new(driver.Rows)}, nil
+	}
+	c, err := b.conv()
+	if err != nil {
+		return nil, err
+	}
+	typ := c.typ
+	var v interface{}
+	if b.dir.IsInput() {
+		v = lookupPath(input, b.path, b.table)
+	}
+
+	if b.table || b.arg.Flavor == FLAVOR_TABLE {
+		var vv []interface{}
+		if v != nil {
+			var ok bool
+			if vv, ok = v.([]interface{}); !ok {
+				return nil, errors.Errorf("wanted array, got %T: %w", v, ErrInvalidArgument)
+			}
+		}
+		n := b.maxTableSize
+		if n < len(vv) {
+			return nil, errors.Errorf("%d elements, at most %d allowed: %w", len(vv), n, ErrInvalidArgument)
+		}
+		slice := reflect.MakeSlice(reflect.SliceOf(typ), len(vv), n)
+		for i, v := range vv {
+			x, err := convertIn(c, v)
+			if err != nil {
+				return nil, errors.Errorf("%d: %w", i, err)
+			}
+			slice.Index(i).Set(reflect.ValueOf(x))
+		}
+		if !b.dir.IsOutput() {
+			return slice.Interface(), nil
+		}
+		dest := reflect.New(slice.Type())
+		dest.Elem().Set(slice)
+		return sql.Out{Dest: dest.Interface(), In: b.dir.IsInput()}, nil
+	}
+
+	if !b.dir.IsOutput() {
+		if v == nil {
+			return nil, nil
+		}
+		return convertIn(c, v)
+	}
+	dest := reflect.New(typ)
+	if v != nil {
+		x, err := convertIn(c, v)
+		if err != nil {
+			return nil, err
+		}
+		dest.Elem().Set(reflect.ValueOf(x))
+	}
+	return sql.Out{Dest: dest.Interface(), In: b.dir.IsInput()}, nil
+}
+
+// lookupPath returns the value at the path of the input.
+// For the fields of a table of records, it returns the array of the values of the field in each record.
+func lookupPath(input map[string]interface{}, path []string, table bool) interface{} {
+	v := input[path[0]]
+	if len(path) == 1 || v == nil {
+		return v
+	}
+	if !table {
+		if m, ok := v.(map[string]interface{}); ok {
+			return m[path[1]]
+		}
+		return nil
+	}
+	rows, _ := v.([]interface{})
+	vv := make([]interface{}, len(rows))
+	for i, row := range rows {
+		if m, ok := row.(map[string]interface{}); ok {
+			vv[i] = m[path[1]]
+		}
+	}
+	return vv
+}
+
+// convertIn converts the JSON value to the bind value.
+func convertIn(c *simpleConv, v interface{}) (interface{}, error) {
+	var s string
+	switch x := v.(type) {
+	case nil:
+		return reflect.Zero(c.typ).Interface(), nil
+	case string:
+		s = x
+	case json.Number:
+		s = x.String()
+	case bool:
+		if c.typ.Kind() == reflect.Bool {
+			return x, nil
+		}
+		s = strconv.FormatBool(x)
+	default:
+		if rv := reflect.ValueOf(v); rv.Type().ConvertibleTo(c.typ) {
+			return rv.Convert(c.typ).Interface(), nil
+		}
+		s = fmt.Sprintf("%v", v)
+	}
+	return c.valueOf(s)
+}
+
+// jsonValue returns the value as it is in the JSON of the generated structs.
+func jsonValue(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	return typeConvs[reflect.TypeOf(v)].jsonOf(v)
+}
+
+// setOutput sets the value of dest in the output.
+func (b bind) setOutput(output map[string]interface{}, dest interface{}) error {
+	if rows, ok := dest.(*driver.Rows); ok {
+		a, err := b.readRows(*rows)
+		output[b.path[0]] = a
+		return err
+	}
+	v := reflect.ValueOf(dest).Elem()
+	if v.Kind() != reflect.Slice || v.Type() == bytesConv.typ {
+		x := jsonValue(v.Interface())
+		if len(b.path) == 1 {
+			output[b.path[0]] = x
+			return nil
+		}
+		m, _ := output[b.path[0]].(map[string]interface{})
+		if m == nil {
+			m = make(map[string]interface{})
+			output[b.path[0]] = m
+		}
+		m[b.path[1]] = x
+		return nil
+	}
+
+	if len(b.path) == 1 || !b.table {
+		a := make([]interface{}, v.Len())
+		for i := range a {
+			a[i] = jsonValue(v.Index(i).Interface())
+		}
+		if len(b.path) == 1 {
+			output[b.path[0]] = a
+		} else {
+			m, _ := output[b.path[0]].(map[string]interface{})
+			if m == nil {
+				m = make(map[string]interface{})
+				output[b.path[0]] = m
+			}
+			m[b.path[1]] = a
+		}
+		return nil
+	}
+
+	// a field of a table of records
+	rows, _ := output[b.path[0]].([]interface{})
+	for len(rows) < v.Len() {
+		rows = append(rows, make(map[string]interface{}))
+	}
+	for i := 0; i < v.Len(); i++ {
+		rows[i].(map[string]interface{})[b.path[1]] = jsonValue(v.Index(i).Interface())
+	}
+	output[b.path[0]] = rows
+	return nil
+}
+
+// readRows reads all the rows of the REF CURSOR, naming the columns as the fields of the generated structs.
+func (b bind) readRows(rows driver.Rows) ([]interface{}, error) {
+	if rows == nil {
+		return nil, nil
+	}
+	defer rows.Close()
+	names := rows.Columns()
+	if b.arg.TableOf != nil && len(b.arg.TableOf.RecordOf) == len(names) {
+		for i, a := range b.arg.TableOf.RecordOf {
+			names[i] = a.Name
+		}
+	} else {
+		for i, nm := range names {
+			names[i] = strings.ToLower(nm)
+		}
+	}
+	var a []interface{}
+	vals := make([]driver.Value, len(names))
+	for {
+		if err := rows.Next(vals); err != nil {
+			if err == io.EOF {
+				return a, nil
+			}
+			return a, err
+		}
+		row := make(map[string]interface{}, len(names))
+		for i, nm := range names {
+			row[nm] = jsonValue(vals[i])
+		}
+		a = append(a, row)
+	}
+}
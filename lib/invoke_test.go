@@ -0,0 +1,136 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oracall
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/godror/godror"
+	"github.com/tgulacsi/go/loghlp/kitloghlp"
+)
+
+func TestInvokeBinds(t *testing.T) {
+	Log = kitloghlp.NewTestLogger(t).Log
+	for i, tc := range testCases {
+		fun := tc.ParseCsv(t, i)[0]
+		binds := make(map[string]bind)
+		decls, pre, call, post, _, _, err := fun.prepareCallBinds(binds)
+		if err != nil {
+			t.Fatalf("%d. %+v", i, err)
+		}
+		_, keys := godror.MapToSlice(fun.plsqlText(decls, pre, call, post), func(key string) interface{} { return key })
+		for _, k := range keys {
+			if _, ok := lookupBind(binds, k.(string)); !ok {
+				t.Errorf("%d. %s: no bind for %q", i, fun.Name(), k)
+			}
+		}
+	}
+}
+
+func TestInvokeConvert(t *testing.T) {
+	ctx := context.Background()
+	fun := Function{Package: "DB_PKG", name: "fun", Args: []Argument{
+		NewArgument("p_name", "VARCHAR2", "VARCHAR2", "", "IN", 0, "", 0, 0, 10),
+		NewArgument("p_date", "DATE", "DATE", "", "IN/OUT", 0, "", 0, 0, 0),
+		NewArgument("p_num", "NUMBER", "NUMBER", "", "OUT", 0, "", 0, 0, 0),
+	}}
+	binds := make(map[string]bind)
+	if _, _, _, _, _, _, err := fun.prepareCallBinds(binds); err != nil {
+		t.Fatal(err)
+	}
+	var input map[string]interface{}
+	if err := json.Unmarshal([]byte(`{"p_name":"x","p_date":"2020-01-02T03:04:05Z"}`), &input); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := binds["p_name"].param(ctx, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p != "x" {
+		t.Errorf("p_name: got %#v", p)
+	}
+
+	p, err = binds["p_date"].param(ctx, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, ok := p.(sql.Out)
+	if !ok || !out.In {
+		t.Fatalf("p_date: got %#v", p)
+	}
+	want := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if d := out.Dest.(*time.Time); !d.Equal(want) {
+		t.Errorf("p_date: got %v, wanted %v", d, want)
+	}
+
+	p, err = binds["p_num"].param(ctx, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	*(p.(sql.Out).Dest.(*godror.Number)) = "3.14"
+	output := make(map[string]interface{})
+	if err = binds["p_num"].setOutput(output, p.(sql.Out).Dest); err != nil {
+		t.Fatal(err)
+	}
+	if err = binds["p_date"].setOutput(output, out.Dest); err != nil {
+		t.Fatal(err)
+	}
+	if d, ok := output["p_date"].(time.Time); !ok || !d.Equal(want) {
+		t.Errorf("p_date: got %#v, wanted %v", output["p_date"], want)
+	}
+	if output["p_num"] != "3.14" {
+		t.Errorf("p_num: got %#v", output["p_num"])
+	}
+
+	if _, err = binds["p_date"].param(ctx, map[string]interface{}{"p_date": "tomorrow"}); err == nil {
+		t.Error("wanted error for bad date")
+	}
+}
+
+func TestInvokeTableOfRecords(t *testing.T) {
+	b := bind{path: []string{"p_tab", "id"}, arg: NewArgument("id", "NUMBER", "NUMBER", "", "OUT", 0, "", 0, 0, 0), dir: DIR_INOUT, table: true, maxTableSize: 4}
+	input := map[string]interface{}{"p_tab": []interface{}{
+		map[string]interface{}{"id": json.Number("1")},
+		map[string]interface{}{"id": json.Number("2")},
+	}}
+	p, err := b.param(context.Background(), input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest := p.(sql.Out).Dest.(*[]godror.Number)
+	if len(*dest) != 2 || cap(*dest) != 4 || (*dest)[1] != "2" {
+		t.Errorf("got %#v", *dest)
+	}
+	*dest = append(*dest, "3")
+	output := make(map[string]interface{})
+	if err = b.setOutput(output, dest); err != nil {
+		t.Fatal(err)
+	}
+	if got := output["p_tab"].([]interface{}); len(got) != 3 || got[2].(map[string]interface{})["id"] != "3" {
+		t.Errorf("got %#v", output)
+	}
+
+	input["p_tab"] = []interface{}{1, 2, 3, 4, 5}
+	if _, err = b.param(context.Background(), input); err == nil {
+		t.Error("wanted error for too many elements")
+	}
+}
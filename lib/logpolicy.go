@@ -0,0 +1,125 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oracall
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	errors "golang.org/x/xerrors"
+)
+
+// LogLevel is the verbosity of the logging of a call.
+type LogLevel int
+
+const (
+	// LogOff logs nothing.
+	LogOff = LogLevel(iota)
+	// LogError logs the failed calls only.
+	LogError
+	// LogInfo logs the calls, without the payloads.
+	LogInfo
+	// LogDebug logs the calls with the payloads (requests, responses, PL/SQL parameters).
+	LogDebug
+	// LogTrace logs the database driver, too.
+	LogTrace
+)
+
+var logLevelNames = [...]string{"off", "error", "info", "debug", "trace"}
+
+func (lvl LogLevel) String() string {
+	if lvl < 0 || int(lvl) >= len(logLevelNames) {
+		return fmt.Sprintf("LogLevel(%d)", int(lvl))
+	}
+	return logLevelNames[lvl]
+}
+
+// ParseLogLevel parses the name of the log level.
+func ParseLogLevel(s string) (LogLevel, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for i, nm := range logLevelNames {
+		if nm == s {
+			return LogLevel(i), nil
+		}
+	}
+	return LogOff, errors.Errorf("unknown log level %q: %w", s, ErrInvalidArgument)
+}
+
+// LogPolicy is the logging policy of a call.
+type LogPolicy struct {
+	Level LogLevel
+	// MaxPayload is the maximum length of a logged payload, unlimited if 0.
+	MaxPayload int
+}
+
+// DefaultLogPolicy is the policy of the calls without a LogPolicy in their context.
+var DefaultLogPolicy = LogPolicy{Level: LogInfo, MaxPayload: 4096}
+
+const logPolicyCtxKey = ctxKey("logPolicy")
+
+// ContextWithLogPolicy returns a context with the logging policy.
+func ContextWithLogPolicy(ctx context.Context, p LogPolicy) context.Context {
+	return context.WithValue(ctx, logPolicyCtxKey, p)
+}
+
+// ContextGetLogPolicy returns the logging policy of the context, or DefaultLogPolicy.
+func ContextGetLogPolicy(ctx context.Context) LogPolicy {
+	if p, ok := ctx.Value(logPolicyCtxKey).(LogPolicy); ok {
+		return p
+	}
+	return DefaultLogPolicy
+}
+
+// Enabled reports whether lvl is logged.
+func (p LogPolicy) Enabled(lvl LogLevel) bool { return lvl <= p.Level }
+
+// Payload returns the value as a string, truncated to MaxPayload.
+func (p LogPolicy) Payload(v interface{}) string {
+	var s string
+	switch x := v.(type) {
+	case string:
+		s = x
+	case []byte:
+		s = string(x)
+	case json.RawMessage:
+		s = string(x)
+	default:
+		s = fmt.Sprintf("%+v", v)
+	}
+	return CapString(s, p.MaxPayload)
+}
+
+// CapString truncates s to at most n bytes (plus a marker of the truncation), if n > 0.
+func CapString(s string, n int) string {
+	if n <= 0 || len(s) <= n {
+		return s
+	}
+	return fmt.Sprintf("%s...(%d bytes)", Truncate(s, n), len(s))
+}
+
+// Truncate truncates s to at most n bytes, without splitting a UTF-8 sequence, if n > 0.
+func Truncate(s string, n int) string {
+	if n <= 0 || len(s) <= n {
+		return s
+	}
+	for n > 0 && s[n]&0xc0 == 0x80 { // do not split a UTF-8 sequence
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oracall
+
+import (
+	"context"
+	"testing"
+)
+
+func TestLogPolicy(t *testing.T) {
+	if p := ContextGetLogPolicy(context.Background()); p != DefaultLogPolicy {
+		t.Errorf("got %+v, wanted the default", p)
+	}
+	p := LogPolicy{Level: LogInfo, MaxPayload: 3}
+	if !p.Enabled(LogError) || !p.Enabled(LogInfo) || p.Enabled(LogDebug) {
+		t.Errorf("bad Enabled of %v", p.Level)
+	}
+	if got := p.Payload("abcdef"); got != "abc...(6 bytes)" {
+		t.Errorf("got %q", got)
+	}
+	if got := p.Payload([]interface{}{1}); got != "[1]" {
+		t.Errorf("got %q", got)
+	}
+	for _, lvl := range []LogLevel{LogOff, LogError, LogInfo, LogDebug, LogTrace} {
+		if got, err := ParseLogLevel(lvl.String()); err != nil || got != lvl {
+			t.Errorf("%v: got %v, %+v", lvl, got, err)
+		}
+	}
+	if _, err := ParseLogLevel("verbose"); err == nil {
+		t.Error("wanted error for unknown level")
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	for _, tc := range []struct {
+		In   string
+		N    int
+		Want string
+	}{
+		{"abc", 5, "abc"},
+		{"abcdef", 3, "abc"},
+		{"árvíz", 2, "á"},
+		{"árvíz", 1, ""},
+	} {
+		if got := Truncate(tc.In, tc.N); got != tc.Want {
+			t.Errorf("Truncate(%q, %d)=%q, wanted %q", tc.In, tc.N, got, tc.Want)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oracall
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// MethodDesc describes a generated method, for calling it without gRPC (such as from the HTTP gateway of orasrv).
+//
+// The generated server lists them with its MethodDescs method.
+type MethodDesc struct {
+	// Name is the name of the gRPC method.
+	Name string
+	// Path is the lowercase "/package/function" path of the PL/SQL function.
+	Path string
+	// NewInput returns a new, empty input message.
+	NewInput func() interface{}
+	// Unary calls the method, nil for the methods streaming their (REF CURSOR) outputs.
+	Unary func(ctx context.Context, input interface{}) (interface{}, error)
+	// Stream calls the streaming method, calling send with each output, nil for the unary methods.
+	Stream func(ctx context.Context, input interface{}, send func(interface{}) error) error
+}
+
+// HTTPPath returns the lowercase "/package/function" path of the function.
+func (f Function) HTTPPath() string {
+	fn := f.name
+	if f.alias != "" {
+		fn = f.alias
+	}
+	fn = strings.ToLower(strings.Replace(fn, ".", "__", -1))
+	if f.Package == "" {
+		return "/" + fn
+	}
+	return "/" + strings.ToLower(f.Package) + "/" + fn
+}
+
+// MethodName returns the name of the gRPC method of the function.
+func (f Function) MethodName() string {
+	fn := f.name
+	if f.alias != "" {
+		fn = f.alias
+	}
+	return CamelCase(dot2D.Replace(strings.ToLower(fn)))
+}
+
+// FullMethod returns the full gRPC method ("/pkg.Service/Method") of the function,
+// in the Protocol Buffers package pbPkg, or, if it is empty, in the package named
+// after the PL/SQL package, as the dynamic server of orasrv serves it.
+func (f Function) FullMethod(pbPkg string) string {
+	if pbPkg == "" {
+		if pbPkg = strings.ToLower(f.Package); pbPkg == "" {
+			pbPkg = "main"
+		}
+	}
+	return "/" + pbPkg + "." + CamelCase(pbPkg) + "/" + f.MethodName()
+}
+
+// saveMethodDescs writes the MethodDescs method of the generated server,
+// with the stream adapters of the streaming methods.
+func saveMethodDescs(w io.Writer, functions []Function) error {
+	var descs, adapters bytes.Buffer
+	for _, fun := range functions {
+		fn := fun.name
+		if fun.alias != "" {
+			fn = fun.alias
+		}
+		name := CamelCase(strings.Replace(fn, ".", "__", -1))
+		input := "pb." + CamelCase(fun.getStructName(false, false))
+		fmt.Fprintf(&descs, "\t\t{Name: %q, Path: %q, NewInput: func() interface{} { return new(%s) },\n", name, fun.HTTPPath(), input)
+		if !fun.HasCursorOut() {
+			fmt.Fprintf(&descs, `			Unary: func(ctx context.Context, input interface{}) (interface{}, error) { return s.%s(ctx, input.(*%s)) },
+		},
+`, name, input)
+			continue
+		}
+		adapter := "sendStream" + name
+		fmt.Fprintf(&descs, `			Stream: func(ctx context.Context, input interface{}, send func(interface{}) error) error {
+				return s.%s(input.(*%s), %s{oragrpc.SendStream{Ctx: ctx, SendFunc: send}})
+			},
+		},
+`, name, input, adapter)
+		fmt.Fprintf(&adapters, `
+type %s struct{ oragrpc.SendStream }
+
+func (s %s) Send(output *pb.%s) error { return s.SendMsg(output) }
+`, adapter, adapter, CamelCase(fun.getStructName(true, false)))
+	}
+	_, err := fmt.Fprintf(w, `
+var _ oragrpc.SendStream // against "unused import" error
+
+// MethodDescs returns the descriptors of the methods, for calling them without gRPC.
+func (s *oracallServer) MethodDescs() []oracall.MethodDesc {
+	return []oracall.MethodDesc{
+%s	}
+}
+%s`, descs.String(), adapters.String())
+	return err
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oracall
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+func TestSaveMethodDescs(t *testing.T) {
+	functions := []Function{
+		{Package: "DB_PKG", name: "get_x"},
+		{Package: "DB_PKG", name: "list_x", Args: []Argument{{Name: "p_cur", Type: "REF CURSOR", Direction: DIR_OUT}}},
+		{name: "standalone", alias: "alone"},
+	}
+	for i, want := range []string{"/db_pkg/get_x", "/db_pkg/list_x", "/alone"} {
+		if got := functions[i].HTTPPath(); got != want {
+			t.Errorf("%d. got %q, wanted %q", i, got, want)
+		}
+	}
+	for i, tc := range []struct{ pbPkg, want string }{
+		{"", "/db_pkg.DbPkg/GetX"},
+		{"pb", "/pb.Pb/GetX"},
+	} {
+		if got := functions[0].FullMethod(tc.pbPkg); got != tc.want {
+			t.Errorf("%d. got %q, wanted %q", i, got, tc.want)
+		}
+	}
+	if got, want := functions[2].FullMethod(""), "/main.Main/Alone"; got != want {
+		t.Errorf("got %q, wanted %q", got, want)
+	}
+
+	var buf bytes.Buffer
+	if err := saveMethodDescs(&buf, functions); err != nil {
+		t.Fatal(err)
+	}
+	src := buf.String()
+	t.Log(src)
+	if _, err := parser.ParseFile(token.NewFileSet(), "descs.go", "package x\n"+src, 0); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`Path: "/db_pkg/get_x"`,
+		"return s.GetX(ctx, input.(*pb.GetX_Input))",
+		"type sendStreamListX struct{ oragrpc.SendStream }",
+		"func (s sendStreamListX) Send(output *pb.ListX_Output) error",
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("missing %q", want)
+		}
+	}
+}
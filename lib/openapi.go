@@ -0,0 +1,263 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oracall
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"strings"
+
+	errors "golang.org/x/xerrors"
+)
+
+// HTTPURLTemplate is the URL template of the google.api.http annotations of the rpcs,
+// such as "/v1/{package}/{function}" - no annotations are written if empty.
+var HTTPURLTemplate string
+
+// HTTPURLTemplates are the URL templates per (lowercase) package, overriding HTTPURLTemplate.
+var HTTPURLTemplates map[string]string
+
+// httpURL returns the URL of the google.api.http annotation of the function,
+// or the empty string if there is no template for it.
+func (f Function) httpURL() string {
+	tmpl := HTTPURLTemplates[strings.ToLower(f.Package)]
+	if tmpl == "" {
+		tmpl = HTTPURLTemplate
+	}
+	if tmpl == "" {
+		return ""
+	}
+	path := f.HTTPPath()
+	fn := path[strings.LastIndexByte(path, '/')+1:]
+	return strings.NewReplacer("{package}", strings.ToLower(f.Package), "{function}", fn).Replace(tmpl)
+}
+
+// httpAnnotation returns the body of the rpc: the google.api.http option, if there is a URL template for the function.
+func (f Function) httpAnnotation() string {
+	u := f.httpURL()
+	if u == "" {
+		return "{}"
+	}
+	return "{\n\t\toption (google.api.http) = { post: \"" + u + "\" body: \"*\" };\n\t}"
+}
+
+func hasHTTPURLTemplate() bool { return HTTPURLTemplate != "" || len(HTTPURLTemplates) != 0 }
+
+type openAPISchema map[string]interface{}
+
+// SaveOpenAPI writes the OpenAPI 3 document of the functions, as called through the HTTP gateway:
+// POST to the URL of the google.api.http annotation (or to the /package/function path of the gateway of orasrv),
+// with the JSON of the input, returning the JSON (or the NDJSON stream, for the REF CURSORs) of the output.
+//
+// The descriptions come from the documentation of the functions and their arguments,
+// the constraints (maxLength, maximum, multipleOf, maxItems) from the length, precision and scale of the arguments.
+func SaveOpenAPI(dst io.Writer, functions []Function, title, version string) error {
+	paths := make(map[string]interface{}, len(functions))
+	schemas := make(map[string]interface{}, 2*len(functions))
+	errorResponse := map[string]interface{}{
+		"description": "error",
+		"content": map[string]interface{}{"application/json": map[string]interface{}{
+			"schema": openAPISchema{"type": "object", "properties": map[string]interface{}{
+				"code":    openAPISchema{"type": "integer"},
+				"status":  openAPISchema{"type": "string"},
+				"message": openAPISchema{"type": "string"},
+			}},
+		}},
+	}
+
+FunLoop:
+	for _, fun := range functions {
+		names := make([]string, 2)
+		for i, out := range []bool{false, true} {
+			dirmap := DIR_IN
+			if out {
+				dirmap = DIR_OUT
+			}
+			args := make([]Argument, 0, len(fun.Args)+1)
+			for _, arg := range fun.Args {
+				if arg.Direction&dirmap > 0 && arg.Inject == "" {
+					args = append(args, arg)
+				}
+			}
+			if out && fun.Returns != nil {
+				args = append(args, *fun.Returns)
+			}
+			names[i] = CamelCase(fun.getStructName(out, false))
+			if err := openAPIObject(schemas, names[i], getDirDoc(fun.Documentation, dirmap), args); err != nil {
+				if SkipMissingTableOf && (errors.Is(err, ErrMissingTableOf) || errors.Is(err, UnknownSimpleType)) {
+					Log("msg", "SKIP function, missing TableOf info", "function", fun.Name())
+					continue FunLoop
+				}
+				return errors.Errorf("%s: %w", fun.Name(), err)
+			}
+		}
+		path := fun.httpURL()
+		if path == "" {
+			path = fun.HTTPPath()
+		}
+		contentType := "application/json"
+		if fun.HasCursorOut() {
+			contentType = "application/x-ndjson"
+		}
+		op := map[string]interface{}{
+			"operationId": names[0][:len(names[0])-len("_Input")],
+			"requestBody": map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{"application/json": map[string]interface{}{
+					"schema": openAPISchema{"$ref": "#/components/schemas/" + names[0]},
+				}},
+			},
+			"responses": map[string]interface{}{
+				"200": map[string]interface{}{
+					"description": "output",
+					"content": map[string]interface{}{contentType: map[string]interface{}{
+						"schema": openAPISchema{"$ref": "#/components/schemas/" + names[1]},
+					}},
+				},
+				"default": errorResponse,
+			},
+		}
+		if fun.Documentation != "" {
+			common, _, _ := splitDoc(fun.Documentation)
+			op["description"] = strings.TrimSpace(common)
+		}
+		if fun.Package != "" {
+			op["tags"] = []string{strings.ToLower(fun.Package)}
+		}
+		paths[path] = map[string]interface{}{"post": op}
+	}
+
+	enc := json.NewEncoder(dst)
+	enc.SetIndent("", "  ")
+	return enc.Encode(map[string]interface{}{
+		"openapi":    "3.0.3",
+		"info":       map[string]interface{}{"title": title, "version": version},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": schemas},
+	})
+}
+
+// openAPIObject adds the object schema of the arguments as name to the schemas, with the schemas of its records.
+func openAPIObject(schemas map[string]interface{}, name string, D argDocs, args []Argument) error {
+	if _, ok := schemas[name]; ok {
+		return nil
+	}
+	props := make(map[string]interface{}, len(args))
+	obj := openAPISchema{"type": "object", "properties": props}
+	if doc := strings.TrimSpace(D.Pre + D.Post); doc != "" {
+		obj["description"] = doc
+	}
+	schemas[name] = obj
+	for _, arg := range args {
+		aName := arg.Name
+		if strings.HasSuffix(aName, "#") {
+			aName = replHidden(aName)
+		}
+		s, err := openAPIArg(schemas, arg, D.Map[arg.Name])
+		if err != nil {
+			delete(schemas, name)
+			return errors.Errorf("%s.%s: %w", name, aName, err)
+		}
+		props[aName] = s
+	}
+	return nil
+}
+
+// openAPIArg returns the schema of the argument, adding the schemas of its records to schemas.
+func openAPIArg(schemas map[string]interface{}, arg Argument, doc string) (openAPISchema, error) {
+	if arg.Flavor == FLAVOR_TABLE {
+		if arg.TableOf == nil {
+			return nil, errors.Errorf("no table of data for %s: %w", arg.Name, ErrMissingTableOf)
+		}
+		items, err := openAPIArg(schemas, *arg.TableOf, "")
+		if err != nil {
+			return nil, err
+		}
+		s := openAPISchema{"type": "array", "items": items}
+		if arg.Type != "REF CURSOR" && MaxTableSize > 0 {
+			s["maxItems"] = MaxTableSize
+		}
+		if doc != "" {
+			s["description"] = doc
+		}
+		return s, nil
+	}
+	if arg.Flavor == FLAVOR_RECORD {
+		got, err := arg.goType(false)
+		if err != nil {
+			return nil, err
+		}
+		got = strings.TrimPrefix(strings.TrimPrefix(got, "[]"), "*")
+		if got == "" {
+			got = mkRecTypName(arg.Name)
+		}
+		typ := CamelCase(got)
+		subArgs := make([]Argument, 0, len(arg.RecordOf))
+		for _, v := range arg.RecordOf {
+			subArgs = append(subArgs, *v.Argument)
+		}
+		if err = openAPIObject(schemas, typ, argDocs{Pre: doc}, subArgs); err != nil {
+			return nil, err
+		}
+		return openAPISchema{"$ref": "#/components/schemas/" + typ}, nil
+	}
+
+	got, err := arg.goType(false)
+	if err != nil {
+		return nil, err
+	}
+	var s openAPISchema
+	switch typ, _ := protoType(got, arg.Name, arg.AbsType); typ {
+	case "sint32":
+		s = openAPISchema{"type": "integer", "format": "int32"}
+		if arg.Precision > 0 && arg.Precision < 10 {
+			s["maximum"] = math.Pow10(int(arg.Precision)) - 1
+			s["minimum"] = -(math.Pow10(int(arg.Precision)) - 1)
+		}
+	case "double":
+		s = openAPISchema{"type": "number", "format": "double"}
+		if arg.Precision > 0 {
+			s["maximum"] = math.Pow10(int(arg.Precision)-int(arg.Scale)) - math.Pow10(-int(arg.Scale))
+			s["minimum"] = -s["maximum"].(float64)
+		}
+		if arg.Scale > 0 {
+			s["multipleOf"] = math.Pow10(-int(arg.Scale))
+		}
+	case "google.protobuf.Timestamp":
+		s = openAPISchema{"type": "string", "format": "date-time"}
+	case "bytes":
+		s = openAPISchema{"type": "string", "format": "byte"}
+	case "bool":
+		s = openAPISchema{"type": "boolean"}
+	default:
+		s = openAPISchema{"type": "string"}
+		if strings.ToLower(got) == "godror.number" {
+			s["format"] = "decimal"
+		} else if arg.Charlength > 0 && !strings.HasSuffix(arg.Type, "LOB") {
+			s["maxLength"] = arg.Charlength
+		}
+	}
+	if NumberAsString && (s["type"] == "integer" || s["type"] == "number") {
+		// the JSON tag has ",string"
+		s = openAPISchema{"type": "string", "format": s["format"]}
+	}
+	if doc != "" {
+		s["description"] = doc
+	}
+	return s, nil
+}
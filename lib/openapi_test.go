@@ -0,0 +1,94 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oracall
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestOpenAPI(t *testing.T) {
+	defer func(tmpl string, tmpls map[string]string) { HTTPURLTemplate, HTTPURLTemplates = tmpl, tmpls }(HTTPURLTemplate, HTTPURLTemplates)
+	HTTPURLTemplate = "/v1/{package}/{function}"
+	HTTPURLTemplates = map[string]string{"db_web": "/web/{function}"}
+
+	functions := []Function{
+		{Package: "DB_PKG", name: "get_x",
+			Documentation: "Get the x.\ninput:\n - p_name: the name of x\n",
+			Args: []Argument{
+				NewArgument("p_name", "VARCHAR2", "VARCHAR2", "", "IN", 0, "", 0, 0, 50),
+				NewArgument("p_id", "NUMBER", "PLS_INTEGER", "", "OUT", 0, "", 9, 0, 0),
+			}},
+		{Package: "DB_WEB", name: "ping"},
+	}
+	if got, want := functions[0].httpURL(), "/v1/db_pkg/get_x"; got != want {
+		t.Errorf("got %q, wanted %q", got, want)
+	}
+	if got, want := functions[1].httpURL(), "/web/ping"; got != want {
+		t.Errorf("got %q, wanted %q", got, want)
+	}
+
+	var buf bytes.Buffer
+	if err := SaveProtobuf(&buf, functions, "pkg"); err != nil {
+		t.Fatal(err)
+	}
+	t.Log(buf.String())
+	for _, want := range []string{
+		`import "google/api/annotations.proto";`,
+		`option (google.api.http) = { post: "/v1/db_pkg/get_x" body: "*" };`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("proto: missing %q", want)
+		}
+	}
+
+	buf.Reset()
+	if err := SaveOpenAPI(&buf, functions, "pkg", "1"); err != nil {
+		t.Fatal(err)
+	}
+	t.Log(buf.String())
+	var doc struct {
+		Paths      map[string]map[string]json.RawMessage
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]struct {
+					Type        string
+					MaxLength   int
+					Description string
+				}
+			}
+		}
+	}
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := doc.Paths["/v1/db_pkg/get_x"]["post"]; !ok {
+		t.Errorf("missing path, got %v", doc.Paths)
+	}
+	if _, ok := doc.Paths["/web/ping"]["post"]; !ok {
+		t.Errorf("missing path, got %v", doc.Paths)
+	}
+	p := doc.Components.Schemas["GetX_Input"].Properties["p_name"]
+	if p.Type != "string" || p.MaxLength != 50 || p.Description != "the name of x" {
+		t.Errorf("p_name: got %+v", p)
+	}
+	if _, ok := doc.Components.Schemas["GetX_Output"].Properties["p_id"]; !ok {
+		t.Errorf("missing p_id, got %+v", doc.Components.Schemas)
+	}
+}
@@ -23,7 +23,9 @@ import (
 	"io"
 	"os"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"text/template"
 
 	errors "golang.org/x/xerrors"
@@ -37,7 +39,13 @@ const batchSize = 128
 
 // SavePlsqlBlock saves the plsql block definition into writer
 func (fun Function) PlsqlBlock(checkName string) (plsql, callFun string) {
-	decls, pre, call, post, convIn, convOut, err := fun.prepareCall()
+	return fun.plsqlBlock(checkName, grpcAPI)
+}
+
+// plsqlBlock returns the PL/SQL block and the Go function calling it, as a method of api.Server.
+func (fun Function) plsqlBlock(checkName string, api apiNames) (plsql, callFun string) {
+	binds := make(map[string]bind)
+	decls, pre, call, post, convIn, convOut, err := fun.prepareCallBinds(binds)
 	if err != nil {
 		Log("msg", "error preparing", "function", fun, "error", err)
 		panic(errors.Errorf("%s: %w", fun.Name(), err))
@@ -51,33 +59,7 @@ func (fun Function) PlsqlBlock(checkName string) (plsql, callFun string) {
 	plsBuf := Buffers.Get()
 	defer Buffers.Put(plsBuf)
 	plsBuf.Reset()
-	if len(decls) > 0 {
-		io.WriteString(plsBuf, "DECLARE\n")
-		for _, line := range decls {
-			fmt.Fprintf(plsBuf, "  %s\n", line)
-		}
-		plsBuf.Write([]byte{'\n'})
-	}
-	io.WriteString(plsBuf, "BEGIN\n")
-	for _, line := range pre {
-		fmt.Fprintf(plsBuf, "  %s\n", line)
-	}
-	if len(fun.handle) == 0 {
-		plsBuf.WriteString("\n")
-	} else {
-		plsBuf.WriteString("  BEGIN\n  ")
-	}
-	fmt.Fprintf(plsBuf, "  %s;\n", call)
-	//Log("handle", fun.handle, "fun", fun.Name())
-	if len(fun.handle) != 0 {
-		fmt.Fprintf(plsBuf, "  EXCEPTION WHEN %s THEN NULL;\n  END;\n",
-			strings.Join(fun.handle, " OR "))
-	}
-	plsBuf.WriteByte('\n')
-	for _, line := range post {
-		fmt.Fprintf(plsBuf, "  %s\n", line)
-	}
-	io.WriteString(plsBuf, "\nEND;\n")
+	plsBuf.WriteString(fun.plsqlText(decls, pre, call, post))
 
 	var check string
 	if checkName != "" {
@@ -94,10 +76,10 @@ func (fun Function) PlsqlBlock(checkName string) (plsql, callFun string) {
 
 	hasCursorOut := fun.HasCursorOut()
 	if hasCursorOut {
-		fmt.Fprintf(callBuf, `func (s *oracallServer) %s(input *pb.%s, stream pb.%s_%sServer) (err error) {
+		fmt.Fprintf(callBuf, `func (s *{{.Server}}) %s(input *{{.Pb}}%s, stream {{.Pb}}%s_%sServer) (err error) {
 			ctx := stream.Context()
 			%s
-			output := new(pb.%s)
+			output := new({{.Pb}}%s)
 			iterators := make([]iterator, 0, 1)
 		`,
 			CamelCase(fn), CamelCase(fun.getStructName(false, false)), CamelCase(fun.Package), CamelCase(fn),
@@ -105,9 +87,9 @@ func (fun Function) PlsqlBlock(checkName string) (plsql, callFun string) {
 			CamelCase(fun.getStructName(true, false)),
 		)
 	} else {
-		fmt.Fprintf(callBuf, `func (s *oracallServer) %s(ctx context.Context, input *pb.%s) (output *pb.%s, err error) {
+		fmt.Fprintf(callBuf, `func (s *{{.Server}}) %s(ctx context.Context, input *{{.Pb}}%s) (output *{{.Pb}}%s, err error) {
 		%s
-		output = new(pb.%s)
+		output = new({{.Pb}}%s)
 		iterators := make([]iterator, 0, 1) // just temporary
 		_ = iterators
     `,
@@ -122,9 +104,9 @@ func (fun Function) PlsqlBlock(checkName string) (plsql, callFun string) {
 	}
 
 	var pls string
+	paramsMap := make(map[string][]int, bytes.Count(plsBuf.Bytes(), []byte{':'}))
 	{
 		var i int
-		paramsMap := make(map[string][]int, bytes.Count(plsBuf.Bytes(), []byte{':'}))
 		first := make(map[string]int, len(paramsMap))
 		pls, _ = godror.MapToSlice(
 			plsBuf.String(),
@@ -138,6 +120,25 @@ func (fun Function) PlsqlBlock(checkName string) (plsql, callFun string) {
 			})
 	}
 
+	// mask the sensitive values in the logs, by the positions of their bind variables
+	logParams, logOutput := "params", "output"
+	if fun.hasSensitive() {
+		logOutput = "oracall.RedactedJSON(output)"
+		var idxs []int
+		if fun.Replacement != nil {
+			idxs = []int{0, 1} // the whole input and output
+		} else {
+			idxs = fun.sensitiveParams(binds, paramsMap)
+		}
+		if len(idxs) != 0 {
+			ss := make([]string, len(idxs))
+			for i, idx := range idxs {
+				ss[i] = strconv.Itoa(idx)
+			}
+			logParams = "oracall.MaskParams(params, " + strings.Join(ss, ", ") + ")"
+		}
+	}
+
 	i := strings.Index(call, fun.RealName())
 	if i < 0 {
 		Log("msg", "not found", "name", fun.RealName(), "in", call)
@@ -145,60 +146,83 @@ func (fun Function) PlsqlBlock(checkName string) (plsql, callFun string) {
 	j := i + strings.Index(call[i:], ")") + 1
 	//Log("msg","PlsqlBlock", "i", i, "j", j, "call", call)
 	fmt.Fprintf(callBuf, `
-	ctx = godror.ContextWithTraceTag(ctx, godror.TraceTag{Module: %q, Action: %q})
+	ctx = oracall.ContextWithTraceTag(ctx, %q, %q)
+const funName = "%s"
 if s.DBLog != nil {
-	const funName = "%s"
 	if err := s.DBLog(ctx, s.db, funName, input); err != nil {
 		Log("dbLog", funName, "error", err)
 	}
 }
 const callText = `+"`%s`"+`
-if true || DebugLevel > 0 {
-	Log("calling", callText, "stmt", `+"`%s`"+`, "params", params)
+if lp := oracall.ContextGetLogPolicy(ctx); DebugLevel > 0 || lp.Enabled(oracall.LogDebug) {
+	Log("calling", callText, "stmt", lp.Payload(`+"`%s`"+`), "params", lp.Payload(%s))
 }
 	qry := %s
 `,
 		fun.Package, fun.name,
 		fun.Name(),
-		call[i:j], rIdentifier.ReplaceAllString(pls, "'%#v'"),
+		call[i:j], rIdentifier.ReplaceAllString(pls, "'%#v'"), logParams,
 		fun.getPlsqlConstName())
 	callBuf.WriteString(`
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 	var tx *sql.Tx
-	if tx, err = s.db.BeginTx(ctx, nil); err != nil {
+	var finish func(commit bool) error
+	_, endSpan := oracall.StartSpan(ctx, s.Tracer, "BeginTx")
+	tx, finish, err = s.beginTx(ctx, {{.SessionBound}})
+	endSpan(err)
+	if err != nil {
 		return 
 	}
-	defer tx.Rollback()
+	defer finish(false)
+	callInfo := &oracall.CallInfo{FunName: funName, Input: input, Output: output, Tx: tx}
+	if err = oracall.RunBeforeCalls(ctx, callInfo, s.beforeCalls); err != nil {
+		return
+	}
+	callStart := time.Now()
+	// the AfterCall hooks are called once, after the transaction is finished (committed or rolled back), with the final error
+	defer func() {
+		if err != nil {
+			finish(false)
+		}
+		callInfo.Err, callInfo.Duration = err, time.Since(callStart)
+		if hookErr := oracall.RunAfterCalls(ctx, callInfo, s.afterCalls); hookErr != nil {
+			err = hookErr
+		}
+	}()
+	_, endSpan = oracall.StartSpan(ctx, s.Tracer, "PrepareContext")
 	stmt, stmtErr := tx.PrepareContext(ctx, qry)
+	endSpan(stmtErr)
 	if stmtErr != nil {
 		err = errors.Errorf("%s: %w", qry, stmtErr)
 		return
 	}
 	defer stmt.Close()
-	if _, err = stmt.ExecContext(ctx, append(params, godror.PlSQLArrays)...); err != nil {
-		if c, ok := err.(interface{ Code() int }); ok && c.Code() == 4068 {
-			// "existing state of packages has been discarded"
-			_, err = stmt.ExecContext(ctx, append(params, godror.PlSQLArrays)...)
-		}
-		if err != nil {
-			err = errors.Errorf("%q %+v: %w",  qry, params, err)
-			return
-		}
+	_, endSpan = oracall.StartSpan(ctx, s.Tracer, "ExecContext")
+	_, err = stmt.ExecContext(ctx, append(params, godror.PlSQLArrays)...)
+	if c, ok := err.(interface{ Code() int }); ok && c.Code() == 4068 {
+		// "existing state of packages has been discarded"
+		_, err = stmt.ExecContext(ctx, append(params, godror.PlSQLArrays)...)
 	}
+	endSpan(err)
+	if err != nil {
     `)
+	// the error gets into the logs, the audit log and to the client, too
+	fmt.Fprintf(callBuf, "\terr = errors.Errorf(\"%%q %%+v: %%w\", qry, %s, err)\n\treturn\n}\n", logParams)
 
-	callBuf.WriteString("\nif true || DebugLevel > 0 { Log(`result params`, params, `output`, output) }\n")
+	fmt.Fprintf(callBuf, "\nif lp := oracall.ContextGetLogPolicy(ctx); DebugLevel > 0 || lp.Enabled(oracall.LogDebug) {\n\tLog(`result params`, lp.Payload(%s), `output`, lp.Payload(%s))\n}\n", logParams, logOutput)
+	callBuf.WriteString("_, endSpan = oracall.StartSpan(ctx, s.Tracer, \"convertOutput\")\n")
 	for _, line := range convOut {
 		io.WriteString(callBuf, line+"\n")
 	}
+	callBuf.WriteString("endSpan(err)\n")
 	if !hasCursorOut {
-		fmt.Fprintf(callBuf, "\nerr = tx.Commit()\nreturn\n")
+		fmt.Fprintf(callBuf, "\nerr = finish(true)\nreturn\n")
 	} else {
 		fmt.Fprintf(callBuf, `
 		if len(iterators) == 0 {
 			if err = stream.Send(output); err == nil {
-				err = tx.Commit()
+				err = finish(true)
 			}
 			return
 		}
@@ -207,7 +231,14 @@ if true || DebugLevel > 0 {
 		for {
 			for _, it := range iterators {
 				if err = ctx.Err(); err != nil { return }
-				if err = it.Iterate(); err != nil {
+				_, endSpan := oracall.StartSpan(ctx, s.Tracer, "cursorBatch")
+				err = it.Iterate()
+				if errors.Is(err, io.EOF) {
+					endSpan(nil)
+				} else {
+					endSpan(err)
+				}
+				if err != nil {
 					if !errors.Is(err, io.EOF) {
 						_ = stream.Send(output)
 						return
@@ -223,7 +254,7 @@ if true || DebugLevel > 0 {
 			if len(iterators) != len(iterators2) {
 				if len(iterators2) == 0 {
 					//err = stream.Send(output)
-					err = tx.Commit()
+					err = finish(true)
 					return
 				}
 				iterators = append(iterators[:0], iterators2...)
@@ -241,11 +272,76 @@ if true || DebugLevel > 0 {
 	callFun = callBuf.String()
 	plsql = plsBuf.String()
 
-	plsql, callFun = demap(plsql, callFun)
+	plsql, callFun = demap(plsql, callFun, fun.sessionBound, api)
 	return
 }
 
-func demap(plsql, callFun string) (string, string) {
+// sensitiveParams returns the sorted positions of the bind variables of the sensitive arguments and record fields,
+// and of all the fields of the sensitive records.
+func (fun Function) sensitiveParams(binds map[string]bind, paramsMap map[string][]int) []int {
+	var idxs []int
+	for key, b := range binds {
+		if !b.arg.IsSensitive() {
+			var parent Argument
+			for _, arg := range fun.Args {
+				if replHidden(arg.Name) == b.path[0] {
+					parent = arg
+					break
+				}
+			}
+			if fun.Returns != nil && fun.Returns.Name == b.path[0] {
+				parent = *fun.Returns
+			}
+			if len(b.path) < 2 || !parent.IsSensitive() {
+				continue
+			}
+		}
+		positions, ok := paramsMap[key]
+		if !ok && strings.HasSuffix(key, MarkHidden) {
+			positions = paramsMap[key[:len(key)-len(MarkHidden)]+"#"]
+		}
+		idxs = append(idxs, positions...)
+	}
+	sort.Ints(idxs)
+	return idxs
+}
+
+// plsqlText returns the PL/SQL block from the parts returned by prepareCall.
+func (fun Function) plsqlText(decls, pre []string, call string, post []string) string {
+	plsBuf := Buffers.Get()
+	defer Buffers.Put(plsBuf)
+	plsBuf.Reset()
+	if len(decls) > 0 {
+		io.WriteString(plsBuf, "DECLARE\n")
+		for _, line := range decls {
+			fmt.Fprintf(plsBuf, "  %s\n", line)
+		}
+		plsBuf.Write([]byte{'\n'})
+	}
+	io.WriteString(plsBuf, "BEGIN\n")
+	for _, line := range pre {
+		fmt.Fprintf(plsBuf, "  %s\n", line)
+	}
+	if len(fun.handle) == 0 {
+		plsBuf.WriteString("\n")
+	} else {
+		plsBuf.WriteString("  BEGIN\n  ")
+	}
+	fmt.Fprintf(plsBuf, "  %s;\n", call)
+	//Log("handle", fun.handle, "fun", fun.Name())
+	if len(fun.handle) != 0 {
+		fmt.Fprintf(plsBuf, "  EXCEPTION WHEN %s THEN NULL;\n  END;\n",
+			strings.Join(fun.handle, " OR "))
+	}
+	plsBuf.WriteByte('\n')
+	for _, line := range post {
+		fmt.Fprintf(plsBuf, "  %s\n", line)
+	}
+	io.WriteString(plsBuf, "\nEND;\n")
+	return plsBuf.String()
+}
+
+func demap(plsql, callFun string, sessionBound bool, api apiNames) (string, string) {
 	var i int
 	paramsMap := make(map[string][]int, 16)
 	first := make(map[string]int, len(paramsMap))
@@ -262,9 +358,18 @@ func demap(plsql, callFun string) (string, string) {
 
 	type repl struct {
 		ParamsArrLen int
+		SessionBound bool
+		Gogo         bool
+		Pb, Server   string
+		Conv         string
 	}
 	opts := repl{
 		ParamsArrLen: len(paramsArr),
+		SessionBound: sessionBound,
+		Gogo:         api.gogo(),
+		Pb:           api.Pb,
+		Server:       api.Server,
+		Conv:         api.Conv,
 	}
 	callBuf := Buffers.Get()
 	defer Buffers.Put(callBuf)
@@ -361,6 +466,11 @@ func demap(plsql, callFun string) (string, string) {
 }
 
 func (fun Function) prepareCall() (decls, pre []string, call string, post []string, convIn, convOut []string, err error) {
+	return fun.prepareCallBinds(nil)
+}
+
+// prepareCallBinds is prepareCall, recording the bind variables of the PL/SQL block into binds, if not nil.
+func (fun Function) prepareCallBinds(binds map[string]bind) (decls, pre []string, call string, post []string, convIn, convOut []string, err error) {
 	callArgs := make(map[string]string, 16)
 	if repl := fun.Replacement; repl != nil {
 		decls = append(decls, "v_in CLOB := :1;")
@@ -449,23 +559,32 @@ func (fun Function) prepareCall() (decls, pre []string, call string, post []stri
 		"params := make([]interface{}, {{.ParamsArrLen}}, {{.ParamsArrLen}}+2)",
 	)
 
-	addParam := func(paramName string) string {
+	maxTableSize := fun.maxTableSize
+	if maxTableSize <= 0 {
+		maxTableSize = MaxTableSize
+	}
+	addParam := func(paramName string, b bind) string {
 		if paramName == "" {
 			panic("empty param name")
 		}
+		if binds != nil {
+			b.maxTableSize = maxTableSize
+			binds[paramName] = b
+		}
 		return fmt.Sprintf(`params[{{paramsIdx %q}}]`, paramName)
 	}
-	maxTableSize := fun.maxTableSize
-	if maxTableSize <= 0 {
-		maxTableSize = MaxTableSize
-	}
 	for _, arg := range args {
 		switch arg.Flavor {
 		case FLAVOR_SIMPLE:
+			if arg.Inject != "" {
+				convIn = append(convIn, fmt.Sprintf("%s = oracall.InjectValue(ctx, %q)  // inject",
+					addParam(arg.Name, bind{path: []string{arg.Name}, arg: arg, dir: arg.Direction}), arg.Inject))
+				continue
+			}
 			name := (CamelCase(arg.Name))
 			//name := capitalize(replHidden(arg.Name))
 			convIn, convOut = arg.getConvSimple(convIn, convOut,
-				name, addParam(arg.Name))
+				name, addParam(arg.Name, bind{path: []string{arg.Name}, arg: arg, dir: arg.Direction}))
 
 		case FLAVOR_RECORD:
 			vn = getInnerVarName(fun.Name(), arg.Name)
@@ -523,7 +642,7 @@ func (fun Function) prepareCall() (decls, pre []string, call string, post []stri
 					post = append(post, ":"+tmp+" := "+vn+"."+k+";")
 				}
 				convIn, convOut = v.getConvRec(convIn, convOut,
-					name, addParam(tmp),
+					name, addParam(tmp, bind{path: []string{arg.Name, k}, arg: *v, dir: arg.Direction}),
 					0, arg, k, maxTableSize)
 			}
 		case FLAVOR_TABLE:
@@ -535,7 +654,7 @@ func (fun Function) prepareCall() (decls, pre []string, call string, post []stri
 				name := (CamelCase(arg.Name))
 				//name := capitalize(replHidden(arg.Name))
 				convIn, convOut = arg.getConvSimpleTable(convIn, convOut,
-					name, addParam(arg.Name), maxTableSize)
+					name, addParam(arg.Name, bind{path: []string{arg.Name}, arg: arg, dir: arg.Direction}), maxTableSize)
 			} else {
 				switch arg.TableOf.Flavor {
 				case FLAVOR_SIMPLE: // like simple, but for the arg.TableOf
@@ -576,7 +695,7 @@ func (fun Function) prepareCall() (decls, pre []string, call string, post []stri
 					name := (CamelCase(arg.Name))
 					//name := capitalize(replHidden(arg.Name))
 					convIn, convOut = arg.getConvSimpleTable(convIn, convOut,
-						name, addParam(arg.Name), maxTableSize)
+						name, addParam(arg.Name, bind{path: []string{arg.Name}, arg: arg, dir: arg.Direction}), maxTableSize)
 
 				case FLAVOR_RECORD:
 					vn = getInnerVarName(fun.Name(), arg.Name+"."+arg.TableOf.Name)
@@ -652,7 +771,7 @@ func (fun Function) prepareCall() (decls, pre []string, call string, post []stri
 						convIn, convOut = v.getConvTableRec(
 							convIn, convOut,
 							[2]string{aname, kName},
-							addParam(tmp),
+							addParam(tmp, bind{path: []string{arg.Name, k}, arg: *v, dir: arg.Direction, table: true}),
 							uint(maxTableSize),
 							k, *arg.TableOf)
 
@@ -734,7 +853,8 @@ func (arg Argument) getConvSimple(
 			convIn = append(convIn, fmt.Sprintf(`output.%s = input.%s  // gcs3`, name, name))
 		}
 		if got == "time.Time" {
-			convOut = append(convOut, fmt.Sprintf("if output.%s != nil && output.%s.IsZero() { output.%s = nil }", name, name, name))
+			// the dates of the plain Go API are not pointers
+			convOut = append(convOut, fmt.Sprintf("{{if .Pb}}if output.%s != nil && output.%s.IsZero() { output.%s = nil }{{end}}", name, name, name))
 		}
 		src := "output." + name
 		in, varName := arg.ToOra(paramName, "&"+src, arg.Direction)
@@ -811,7 +931,7 @@ func (arg Argument) getConvSimpleTable(
 		if got == "[]godror.Number" { // don't copy, hack
 			convIn = append(convIn,
 				fmt.Sprintf(`if cap(output.%s) == 0 { output.%s = make([]string, 0, %d) }`, name, name, tableSize),
-				fmt.Sprintf(`%s = sql.Out{Dest: custom.NumbersFromStrings(&output.%s)}  // gcst1`, paramName, name))
+				fmt.Sprintf(`%s = sql.Out{Dest: {{.Conv}}NumbersFromStrings(&output.%s)}  // gcst1`, paramName, name))
 		} else {
 			convIn = append(convIn, fmt.Sprintf(`%s = output.%s // gcst1`, paramName, name))
 		}
@@ -825,7 +945,7 @@ func (arg Argument) getConvSimpleTable(
 		if got, _ := arg.goType(true); got == "[]godror.Number" {
 			convIn = append(convIn,
 				fmt.Sprintf(`if len(input.%s) == 0 { %s = []godror.Number{} } else {
-			%s = *custom.NumbersFromStrings(&input.%s) // gcst2
+			%s = *{{.Conv}}NumbersFromStrings(&input.%s) // gcst2
 		}`,
 					name, paramName,
 					paramName, name))
@@ -907,7 +1027,7 @@ func (arg Argument) getFromRset(rsetRow string) string {
 				a.GetOra(fmt.Sprintf("%s[%d]", rsetRow, i), ""),
 				got)
 		} else {
-			fmt.Fprintf(buf, "\t%s: custom.As%s(%s[%d]), // %s\n", CamelCase(a.Name), CamelCase(got), rsetRow, i,
+			fmt.Fprintf(buf, "\t%s: {{.Conv}}As%s(%s[%d]), // %s\n", CamelCase(a.Name), CamelCase(got), rsetRow, i,
 				got)
 		}
 	}
@@ -1081,9 +1201,18 @@ func (arg Argument) getConvTableRec(
 	return convIn, convOut
 }
 
-var varNames = make(map[string]map[string]string, 4)
+var (
+	varNamesMu sync.Mutex
+	varNames   = make(map[string]map[string]string, 4)
+)
 
 func getVarName(funName, varName, prefix string) string {
+	varNamesMu.Lock()
+	defer varNamesMu.Unlock()
+	return getVarNameLocked(funName, varName, prefix)
+}
+
+func getVarNameLocked(funName, varName, prefix string) string {
 	m, ok := varNames[funName]
 	if !ok {
 		m = make(map[string]string, 16)
@@ -1093,7 +1222,7 @@ func getVarName(funName, varName, prefix string) string {
 	if !ok {
 		length := len(m)
 		if i := strings.LastIndex(varName, "."); i > 0 && i < len(varName)-1 {
-			x = getVarName(funName, varName[:i], prefix) + "#" + varName[i+1:]
+			x = getVarNameLocked(funName, varName[:i], prefix) + "#" + varName[i+1:]
 		}
 		if x == "" || len(x) > 30 {
 			x = fmt.Sprintf("%s%03d", prefix, length+1)
@@ -1111,14 +1240,18 @@ func getParamName(funName, paramName string) string {
 	return getVarName(funName, paramName, "p")
 }
 
-func withPb(s string) string {
+// withPb qualifies the type s with the {{.Pb}} of the call template (see demap).
+func withPb(s string) string { return qualify(s, "{{.Pb}}") }
+
+// qualify prepends the package qualifier to the type s, after its leading * or &.
+func qualify(s, qualifier string) string {
 	if s == "" {
 		return s
 	}
 	if s[0] == '*' || s[0] == '&' {
-		return s[:1] + "pb." + s[1:]
+		return s[:1] + qualifier + s[1:]
 	}
-	return "pb." + s
+	return qualifier + s
 }
 
 type idxRemap struct {
@@ -1,6 +1,11 @@
 package oracall
 
 import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"testing"
 
 	"github.com/kylelemons/godebug/diff"
@@ -20,3 +25,96 @@ func TestOne(t *testing.T) {
 		}
 	}
 }
+
+// TestCommitAfterCalls runs the generated plain Go API on a fake driver,
+// checking that the AfterCall hooks are called once, after the commit, with its error.
+func TestCommitAfterCalls(t *testing.T) {
+	functions := testCases[0].ParseCsv(t, 0)
+	dn, err := ioutil.TempDir("", "commit-")
+	if err != nil {
+		t.Skipf("cannot create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dn)
+	var buf bytes.Buffer
+	if err = SaveGoAPI(&buf, functions, "main"); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(dn, "db.go"), buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(dn, "main.go"), []byte(commitAfterCallsMain), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("go", "run", filepath.Join(dn, "db.go"), filepath.Join(dn, "main.go"))
+	if b, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("go run: %v\n%s", err, b)
+	}
+}
+
+const commitAfterCallsMain = `package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	oracall "github.com/tgulacsi/oracall/lib"
+)
+
+var errCommit = errors.New("commit failed")
+
+// commitErr is the error of the commits of the fake driver.
+var commitErr error
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) { return fakeConn{}, nil }
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(string) (driver.Stmt, error)      { return fakeStmt{}, nil }
+func (fakeConn) Close() error                             { return nil }
+func (fakeConn) Begin() (driver.Tx, error)                { return fakeTx{}, nil }
+func (fakeConn) CheckNamedValue(*driver.NamedValue) error { return nil }
+
+type fakeStmt struct{}
+
+func (fakeStmt) Close() error                               { return nil }
+func (fakeStmt) NumInput() int                              { return -1 }
+func (fakeStmt) Exec([]driver.Value) (driver.Result, error) { return driver.RowsAffected(0), nil }
+func (fakeStmt) Query([]driver.Value) (driver.Rows, error)  { return nil, errors.New("no rows") }
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return commitErr }
+func (fakeTx) Rollback() error { return nil }
+
+func main() {
+	sql.Register("fake", fakeDriver{})
+	db, err := sql.Open("fake", "")
+	if err != nil {
+		panic(err)
+	}
+	var hookErrs []error
+	s := NewDB(db, nil, WithAfterCall(func(ctx context.Context, ci *oracall.CallInfo) error {
+		hookErrs = append(hookErrs, ci.Err)
+		return nil
+	}))
+	for _, commitErr = range []error{nil, errCommit} {
+		hookErrs = hookErrs[:0]
+		_, err := s.Sendpreoffer_31101(context.Background(), &Sendpreoffer_31101_Input{Szerkot: time.Now()})
+		if !errors.Is(err, commitErr) || commitErr == nil && err != nil {
+			fmt.Fprintf(os.Stderr, "commit error %v: got %v\n", commitErr, err)
+			os.Exit(1)
+		}
+		if len(hookErrs) != 1 || hookErrs[0] != err {
+			fmt.Fprintf(os.Stderr, "commit error %v: the hooks got %v, wanted once %v\n", commitErr, hookErrs, err)
+			os.Exit(1)
+		}
+	}
+}
+`
@@ -39,7 +39,10 @@ var NumberAsString bool
 // build: protoc --go_out=plugins=grpc:. my.proto
 
 func SaveProtobuf(dst io.Writer, functions []Function, pkg string) error {
-	var err error
+	pf, err := NewProtoFile(functions, pkg)
+	if err != nil {
+		return err
+	}
 	w := errWriter{Writer: dst, err: &err}
 
 	io.WriteString(w, `syntax = "proto3";`+"\n\n")
@@ -51,77 +54,178 @@ func SaveProtobuf(dst io.Writer, functions []Function, pkg string) error {
 		io.WriteString(w, `
 	import "google/protobuf/timestamp.proto";
 	import "github.com/gogo/protobuf/gogoproto/gogo.proto";
+
+	// register the descriptors in the golang/protobuf registry, too, for the gRPC server reflection
+	option (gogoproto.goproto_registration) = true;
 `)
 	}
-	seen := make(map[string]struct{}, 16)
+	if hasHTTPURLTemplate() {
+		io.WriteString(w, "\n\timport \"google/api/annotations.proto\";\n")
+	}
+	if pf.HasSensitive() {
+		io.WriteString(w, "\n\timport \""+OptionsProto+"\";\n")
+	}
+	for _, m := range pf.Messages {
+		m.write(w)
+	}
+
+	fmt.Fprintf(w, "\nservice %s {\n", pf.Service)
+	for _, m := range pf.Methods {
+		var streamQual string
+		if m.Stream {
+			streamQual = "stream "
+		}
+		var comment string
+		if m.Documentation != "" {
+			comment = asComment(m.Documentation, "")
+		}
+		fmt.Fprintf(w, "\t%srpc %s (%s) returns (%s%s) %s\n",
+			comment, m.Name, m.Input, streamQual, m.Output, m.httpAnnotation())
+	}
+	w.Write([]byte("}"))
 
-	services := make([]string, 0, len(functions))
+	return err
+}
+
+// ProtoFile is the Protocol Buffers definition of the functions, as SaveProtobuf writes it,
+// and oragrpc.NewDescriptors builds it.
+type ProtoFile struct {
+	// Package is the name of the package, Service is the name of the service.
+	Package, Service string
+	// Messages are the messages, each followed by the messages of its records.
+	Messages []ProtoMessage
+	// Methods are the rpcs of the service.
+	Methods []ProtoMethod
+}
+
+// OptionsProto is the file of the (oracall.sensitive) field option, marking the sensitive fields,
+// to be redacted in the logs - imported by the .proto files with sensitive fields.
+const OptionsProto = "github.com/tgulacsi/oracall/oragrpc/oracall.proto"
+
+// HasSensitive reports whether any field of the messages is sensitive.
+func (pf ProtoFile) HasSensitive() bool {
+	for _, m := range pf.Messages {
+		for _, f := range m.Fields {
+			if f.Sensitive {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ProtoMessage is a message of a ProtoFile.
+type ProtoMessage struct {
+	Name string
+	// Doc is the documentation of the message.
+	Doc    string
+	Fields []ProtoField
+}
+
+// ProtoField is a field of a ProtoMessage.
+type ProtoField struct {
+	Name     string
+	Number   int32
+	Repeated bool
+	// Type is the scalar type (like "string" or "sint32"), TimestampType, or the name of a message of the file.
+	Type string
+	// Message reports whether Type is a message of the file.
+	Message bool
+	// AbsType is the Oracle type of the argument, Doc is its documentation.
+	AbsType, Doc string
+	// Sensitive marks the field with the (oracall.sensitive) option (see OptionsProto).
+	Sensitive bool
+
+	options protoOptions
+}
+
+// ProtoMethod is an rpc of the service of a ProtoFile.
+type ProtoMethod struct {
+	Function
+	// Name is the name of the method, Input and Output are the names of its messages.
+	Name, Input, Output string
+	// Stream is true for the functions with REF CURSOR outputs, streaming their outputs.
+	Stream bool
+}
+
+// TimestampType is the type of the DATE fields.
+const TimestampType = "google.protobuf.Timestamp"
+
+// ProtoScalarTypes are the scalar types of the fields of the messages.
+var ProtoScalarTypes = []string{"string", "bytes", "bool", "sint32", "int32", "int64", "double"}
+
+// NewProtoFile returns the Protocol Buffers definition of the functions in package pkg.
+//
+// The functions with missing TableOf info, or unknown types, are skipped if SkipMissingTableOf is set.
+func NewProtoFile(functions []Function, pkg string) (ProtoFile, error) {
+	pf := ProtoFile{Package: pkg, Service: CamelCase(pkg)}
+	seen := make(map[string]struct{}, 16)
 
 FunLoop:
 	for _, fun := range functions {
-		//b, _ := json.Marshal(struct{Name, Documentation string}{Name:fun.Name(), Documentation:fun.Documentation})
-		//fmt.Println(string(b))
 		fName := fun.name
 		if fun.alias != "" {
 			fName = fun.alias
 		}
 		fName = strings.ToLower(fName)
-		if err := fun.SaveProtobuf(w, seen); err != nil {
-			if SkipMissingTableOf && (errors.Is(err, ErrMissingTableOf) ||
-				errors.Is(err, UnknownSimpleType)) {
-				Log("msg", "SKIP function, missing TableOf info", "function", fName)
-				continue FunLoop
-			}
-			return errors.Errorf("%s: %w", fun.name, err)
+		// the messages of a skipped function are not seen
+		funSeen := make(map[string]struct{}, len(seen))
+		for k := range seen {
+			funSeen[k] = struct{}{}
 		}
-		var streamQual string
-		if fun.HasCursorOut() {
-			streamQual = "stream "
+		var names [2]string
+		n := len(pf.Messages)
+		for i, out := range []bool{false, true} {
+			msgs, err := fun.protoMessages(funSeen, out)
+			if err != nil {
+				pf.Messages = pf.Messages[:n]
+				if SkipMissingTableOf && (errors.Is(err, ErrMissingTableOf) ||
+					errors.Is(err, UnknownSimpleType)) {
+					Log("msg", "SKIP function, missing TableOf info", "function", fName)
+					continue FunLoop
+				}
+				return pf, errors.Errorf("%s: %w", fun.name, err)
+			}
+			names[i] = msgs[0].Name
+			pf.Messages = append(pf.Messages, msgs...)
 		}
-		name := CamelCase(dot2D.Replace(fName))
-		var comment string
-		if fun.Documentation != "" {
-			comment = asComment(fun.Documentation, "")
-		}
-		services = append(services,
-			fmt.Sprintf(`%srpc %s (%s) returns (%s%s) {}`,
-				comment,
-				name,
-				CamelCase(fun.getStructName(false, false)),
-				streamQual,
-				CamelCase(fun.getStructName(true, false)),
-			),
-		)
+		seen = funSeen
+		pf.Methods = append(pf.Methods, ProtoMethod{
+			Function: fun,
+			Name:     CamelCase(dot2D.Replace(fName)),
+			Input:    names[0], Output: names[1],
+			Stream: fun.HasCursorOut(),
+		})
 	}
-
-	fmt.Fprintf(w, "\nservice %s {\n", CamelCase(pkg))
-	for _, s := range services {
-		fmt.Fprintf(w, "\t%s\n", s)
-	}
-	w.Write([]byte("}"))
-
-	return nil
+	return pf, nil
 }
 
+// SaveProtobuf writes the input and output messages of the function, with the messages of their records
+// not in seen yet.
 func (f Function) SaveProtobuf(dst io.Writer, seen map[string]struct{}) error {
 	var buf bytes.Buffer
-	if err := f.saveProtobufDir(&buf, seen, false); err != nil {
-		return errors.Errorf("%s: %w", "input", err)
-	}
-	if err := f.saveProtobufDir(&buf, seen, true); err != nil {
-		return errors.Errorf("%s: %w", "output", err)
+	for _, out := range []bool{false, true} {
+		msgs, err := f.protoMessages(seen, out)
+		if err != nil {
+			return err
+		}
+		for _, m := range msgs {
+			m.write(&buf)
+		}
 	}
 	_, err := dst.Write(buf.Bytes())
 	return err
 }
-func (f Function) saveProtobufDir(dst io.Writer, seen map[string]struct{}, out bool) error {
+
+// protoMessages returns the input (or output) message of the function, with the messages of its records.
+func (f Function) protoMessages(seen map[string]struct{}, out bool) ([]ProtoMessage, error) {
 	dirmap, dirname := DIR_IN, "input"
 	if out {
 		dirmap, dirname = DIR_OUT, "output"
 	}
 	args := make([]Argument, 0, len(f.Args)+1)
 	for _, arg := range f.Args {
-		if arg.Direction&dirmap > 0 {
+		if arg.Direction&dirmap > 0 && arg.Inject == "" {
 			args = append(args, arg)
 		}
 	}
@@ -134,92 +238,127 @@ func (f Function) saveProtobufDir(dst io.Writer, seen map[string]struct{}, out b
 	if f.alias != "" {
 		nm = f.alias
 	}
-	return protoWriteMessageTyp(dst,
+	msgs, err := protoMessages(
 		CamelCase(dot2D.Replace(strings.ToLower(nm))+"__"+dirname),
 		seen, getDirDoc(f.Documentation, dirmap), args...)
+	if err != nil {
+		return nil, errors.Errorf("%s: %w", dirname, err)
+	}
+	return msgs, nil
 }
 
 var dot2D = strings.NewReplacer(".", "__")
 
-func protoWriteMessageTyp(dst io.Writer, msgName string, seen map[string]struct{}, D argDocs, args ...Argument) error {
+// protoMessages returns the message of the arguments, followed by the messages of its records not in seen yet.
+func protoMessages(msgName string, seen map[string]struct{}, D argDocs, args ...Argument) ([]ProtoMessage, error) {
 	for _, arg := range args {
 		if arg.Flavor == FLAVOR_TABLE && arg.TableOf == nil {
-			return errors.Errorf("no table of data for %s.%s (%v): %w", msgName, arg, arg, ErrMissingTableOf)
+			return nil, errors.Errorf("no table of data for %s.%s (%v): %w", msgName, arg, arg, ErrMissingTableOf)
 		}
 	}
 
-	var err error
-	w := &errWriter{Writer: dst, err: &err}
-	fmt.Fprintf(w, "%smessage %s {\n", asComment(strings.TrimRight(D.Pre+D.Post, " \n\t"), ""), msgName)
-
-	buf := Buffers.Get()
-	defer Buffers.Put(buf)
+	msg := ProtoMessage{Name: msgName, Doc: strings.TrimRight(D.Pre+D.Post, " \n\t"), Fields: make([]ProtoField, 0, len(args))}
+	var subs []ProtoMessage
 	for i, arg := range args {
-		var rule string
 		if strings.HasSuffix(arg.Name, "#") {
 			arg.Name = replHidden(arg.Name)
 		}
-		if arg.Flavor == FLAVOR_TABLE {
-			if arg.TableOf == nil {
-				return errors.Errorf("no table of data for %s.%s (%v): %w", msgName, arg, arg, ErrMissingTableOf)
-			}
-			rule = "repeated "
+		field := ProtoField{
+			Name: arg.Name, Number: int32(i + 1), Repeated: arg.Flavor == FLAVOR_TABLE,
+			AbsType: arg.AbsType, Doc: D.Map[arg.Name], Sensitive: arg.IsSensitive(),
 		}
-		aName := arg.Name
 		got, err := arg.goType(false)
 		if err != nil {
-			return errors.Errorf("%s: %w", msgName, err)
+			return nil, errors.Errorf("%s: %w", msgName, err)
 		}
 		got = strings.TrimPrefix(got, "*")
-		if strings.HasPrefix(got, "[]") {
-			rule = "repeated "
+		// RAW is bytes, not repeated byte
+		if strings.HasPrefix(got, "[]") && got != "[]byte" {
+			field.Repeated = true
 			got = got[2:]
 		}
 		got = strings.TrimPrefix(got, "*")
 		if got == "" {
 			got = mkRecTypName(arg.Name)
 		}
-		typ, pOpts := protoType(got, arg.Name, arg.AbsType)
-		var optS string
-		if s := pOpts.String(); s != "" {
-			optS = " " + s
-		}
+		field.Type, field.options = protoType(got, arg.Name, arg.AbsType)
 		if arg.Flavor == FLAVOR_SIMPLE || arg.Flavor == FLAVOR_TABLE && arg.TableOf.Flavor == FLAVOR_SIMPLE {
-			fmt.Fprintf(w, "%s\t// %s\n\t%s%s %s = %d%s;\n", asComment(D.Map[aName], "\t"), arg.AbsType, rule, typ, aName, i+1, optS)
+			if !isProtoScalar(field.Type) && field.Type != TimestampType {
+				return nil, errors.Errorf("%s.%s (%s): %w", msgName, arg.Name, field.Type, UnknownSimpleType)
+			}
+			msg.Fields = append(msg.Fields, field)
 			continue
 		}
-		typ = CamelCase(typ)
-		if _, ok := seen[typ]; !ok {
-			seen[typ] = struct{}{}
-			//lName := strings.ToLower(arg.Name)
-			subArgs := make([]Argument, 0, 16)
-			if arg.TableOf == nil {
-				for _, v := range arg.RecordOf {
-					subArgs = append(subArgs, *v.Argument)
-				}
-			} else {
-				if arg.TableOf.RecordOf == nil {
-					subArgs = append(subArgs, *arg.TableOf)
-				} else {
-					for _, v := range arg.TableOf.RecordOf {
-						subArgs = append(subArgs, *v.Argument)
-					}
-				}
+		field.Type, field.Message = CamelCase(field.Type), true
+		msg.Fields = append(msg.Fields, field)
+		if _, ok := seen[field.Type]; ok {
+			continue
+		}
+		seen[field.Type] = struct{}{}
+		subArgs := make([]Argument, 0, 16)
+		if arg.TableOf == nil {
+			for _, v := range arg.RecordOf {
+				subArgs = append(subArgs, *v.Argument)
 			}
-			if err = protoWriteMessageTyp(buf, typ, seen, argDocs{Pre: D.Map[aName]}, subArgs...); err != nil {
-				Log("msg", "protoWriteMessageTyp", "error", err)
-				return err
+		} else if arg.TableOf.RecordOf == nil {
+			subArgs = append(subArgs, *arg.TableOf)
+		} else {
+			for _, v := range arg.TableOf.RecordOf {
+				subArgs = append(subArgs, *v.Argument)
 			}
 		}
-		fmt.Fprintf(w, "\t%s%s %s = %d%s;\n", rule, typ, aName, i+1, optS)
+		sub, err := protoMessages(field.Type, seen, argDocs{Pre: D.Map[arg.Name]}, subArgs...)
+		if err != nil {
+			Log("msg", "protoMessages", "error", err)
+			return nil, err
+		}
+		subs = append(subs, sub...)
 	}
-	io.WriteString(w, "}\n")
-	w.Write(buf.Bytes())
+	return append([]ProtoMessage{msg}, subs...), nil
+}
 
-	return err
+func isProtoScalar(typ string) bool {
+	for _, t := range ProtoScalarTypes {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// write the message in the .proto syntax.
+func (m ProtoMessage) write(dst io.Writer) {
+	fmt.Fprintf(dst, "%smessage %s {\n", asComment(m.Doc, ""), m.Name)
+	for _, f := range m.Fields {
+		var rule string
+		if f.Repeated {
+			rule = "repeated "
+		}
+		opts := f.options
+		if f.Sensitive {
+			opts = make(protoOptions, len(f.options)+1)
+			for k, v := range f.options {
+				opts[k] = v
+			}
+			opts["oracall.sensitive"] = true
+		}
+		var optS string
+		if s := opts.String(); s != "" {
+			optS = " " + s
+		}
+		if !f.Message {
+			fmt.Fprintf(dst, "%s\t// %s\n\t%s%s %s = %d%s;\n", asComment(f.Doc, "\t"), f.AbsType, rule, f.Type, f.Name, f.Number, optS)
+			continue
+		}
+		fmt.Fprintf(dst, "\t%s%s %s = %d%s;\n", rule, f.Type, f.Name, f.Number, optS)
+	}
+	io.WriteString(dst, "}\n")
 }
 
 func protoType(got, aName, absType string) (string, protoOptions) {
+	if got == "[]byte" {
+		return "bytes", nil
+	}
 	switch trimmed := strings.ToLower(strings.TrimPrefix(strings.TrimPrefix(got, "[]"), "*")); trimmed {
 	case "string":
 		return "string", nil
@@ -245,7 +384,7 @@ func protoType(got, aName, absType string) (string, protoOptions) {
 		}
 
 	case "custom.date", "time.time":
-		return "google.protobuf.Timestamp", protoOptions{
+		return TimestampType, protoOptions{
 			//"gogoproto.stdtime":    true,
 			"gogoproto.customtype": "github.com/tgulacsi/oracall/custom.DateTime",
 			"gogoproto.moretags":   `xml:",omitempty"`,
@@ -44,6 +44,7 @@ type UserArgument struct {
 	DataType string `sql:"DATA_TYPE"`
 
 	CharacterSetName string `sql:"CHARACTER_SET_NAME"`
+	CharUsed         string `sql:"CHAR_USED"`
 
 	PlsType     string `sql:"PLS_TYPE"`
 	TypeLink    string `sql:"TYPE_LINK"`
@@ -68,7 +69,7 @@ type UserArgument struct {
    SELECT object_id, subprogram_id, package_name, sequence, object_name,
           data_level, argument_name, in_out,
           data_type, data_precision, data_scale, character_set_name,
-          pls_type, char_length, type_owner, type_name, type_subname, type_link
+          pls_type, char_length, type_owner, type_name, type_subname, type_link, char_used
      FROM user_arguments
      ORDER BY object_id, subprogram_id, SEQUENCE;
 */
@@ -171,7 +172,8 @@ func ReadCsv(userArgs chan<- UserArgument, r io.Reader) error {
 		"OBJECT_NAME", "DATA_LEVEL", "SEQUENCE", "ARGUMENT_NAME", "IN_OUT",
 		"DATA_TYPE", "DATA_PRECISION", "DATA_SCALE", "CHARACTER_SET_NAME",
 		"PLS_TYPE", "CHAR_LENGTH",
-		"TYPE_LINK", "TYPE_OWNER", "TYPE_NAME", "TYPE_SUBNAME"} {
+		"TYPE_LINK", "TYPE_OWNER", "TYPE_NAME", "TYPE_SUBNAME", "CHAR_USED",
+		"POSITION"} {
 		csvFields[h] = -1
 	}
 	// get head
@@ -185,6 +187,10 @@ func ReadCsv(userArgs chan<- UserArgument, r io.Reader) error {
 			csvFields[h] = i
 		}
 	}
+	// the older dumps have POSITION instead of SEQUENCE
+	if csvFields["SEQUENCE"] < 0 {
+		csvFields["SEQUENCE"] = csvFields["POSITION"]
+	}
 	Log("msg", "field order", "fields", csvFields)
 
 	for {
@@ -204,7 +210,6 @@ func ReadCsv(userArgs chan<- UserArgument, r io.Reader) error {
 			ObjectName:  rec[csvFields["OBJECT_NAME"]],
 
 			DataLevel:    mustBeUint8(rec[csvFields["DATA_LEVEL"]]),
-			Position:     mustBeUint(rec[csvFields["SEQUENCE"]]),
 			ArgumentName: rec[csvFields["ARGUMENT_NAME"]],
 			InOut:        rec[csvFields["IN_OUT"]],
 
@@ -221,6 +226,13 @@ func ReadCsv(userArgs chan<- UserArgument, r io.Reader) error {
 			TypeName:    rec[csvFields["TYPE_NAME"]],
 			TypeSubname: rec[csvFields["TYPE_SUBNAME"]],
 		}
+		if i := csvFields["SEQUENCE"]; i >= 0 {
+			arg.Position = mustBeUint(rec[i])
+		}
+		// optional, missing from the older dumps
+		if i := csvFields["CHAR_USED"]; i >= 0 {
+			arg.CharUsed = rec[i]
+		}
 
 		userArgs <- arg
 	}
@@ -259,9 +271,21 @@ func ParseArguments(userArgs <-chan []UserArgument, filter func(string) bool) (f
 			}
 
 			level = int8(ua.DataLevel)
+			plsType := ua.PlsType
+			if plsType == "" {
+				// as parseDB: the data type for the simple, the type name for the complex types
+				if ua.TypeName == "" {
+					plsType = ua.DataType
+				} else {
+					plsType = ua.TypeOwner + "." + ua.TypeName + "." + ua.TypeSubname
+					if ua.TypeLink != "" {
+						plsType += "@" + ua.TypeLink
+					}
+				}
+			}
 			arg := NewArgument(ua.ArgumentName,
 				ua.DataType,
-				ua.PlsType,
+				plsType,
 				ua.TypeOwner+"."+ua.TypeName+"."+ua.TypeSubname+"@"+ua.TypeLink,
 				ua.InOut,
 				0,
@@ -270,6 +294,13 @@ func ParseArguments(userArgs <-chan []UserArgument, filter func(string) bool) (f
 				ua.DataScale,
 				ua.CharLength,
 			)
+			if arg.CharUsed = ua.CharUsed; arg.CharUsed == "C" {
+				switch arg.Type {
+				case "CHAR", "VARCHAR", "VARCHAR2":
+					// declare the variables of the PL/SQL block with the same length semantics
+					arg.AbsType = fmt.Sprintf("%s(%d CHAR)", arg.Type, arg.Charlength)
+				}
+			}
 			//Log("level", level, "arg", arg.Name, "type", ua.DataType, "last", lastArgs, "flavor", arg.Flavor)
 			// Possibilities:
 			// 1. SIMPLE
@@ -358,10 +389,14 @@ func (a Annotation) String() string {
 		return ""
 	}
 	switch a.Type {
-	case "private":
+	case "private", "session-bound", "idempotent", "sensitive", "required":
 		return a.Type + " " + a.FullName()
 	case "max-table-size":
 		return fmt.Sprintf("%s.MaxTableSize=%d", a.FullName(), a.Size)
+	case "retry":
+		return fmt.Sprintf("%s.MaxAttempts=%d", a.FullName(), a.Size)
+	case "inject", "timeout":
+		return a.Type + " " + a.FullName() + "=" + a.Other
 	}
 	return a.Type + " " + a.FullName() + "=>" + a.FullOther()
 }
@@ -380,10 +415,10 @@ func ApplyAnnotations(functions []Function, annotations []Annotation) []Function
 		if a.Name == "" || a.Type == "" {
 			continue
 		}
-		if a.Other == "" && !(a.Type == "private" || a.Type == "handle" || a.Type == "max-table-size") {
+		if a.Other == "" && !(a.Type == "private" || a.Type == "handle" || a.Type == "max-table-size" || a.Type == "session-bound" || a.Type == "idempotent" || a.Type == "sensitive" || a.Type == "required" || a.Type == "retry") {
 			continue
 		}
-		if a.Size <= 0 && a.Type == "max-table-size" {
+		if a.Size <= 0 && (a.Type == "max-table-size" || a.Type == "retry") {
 			continue
 		}
 		switch a.Type {
@@ -428,6 +463,95 @@ func ApplyAnnotations(functions []Function, annotations []Annotation) []Function
 			if f := funcs[nm]; f != nil && a.Size >= f.maxTableSize {
 				f.maxTableSize = a.Size
 			}
+
+		// execute the function in the client's dedicated session
+		case "session-bound":
+			nm := L(a.FullName())
+			Log("session-bound", nm)
+			if f := funcs[nm]; f != nil {
+				f.sessionBound = true
+			}
+
+		// the default deadline of the calls of the generated client
+		case "timeout":
+			nm := L(a.FullName())
+			d, err := time.ParseDuration(a.Other)
+			if err != nil {
+				Log("msg", "bad timeout", "annotation", a, "error", err)
+				continue
+			}
+			Log("timeout", nm, "duration", d)
+			if f := funcs[nm]; f != nil {
+				f.timeout = d
+			}
+
+		// the function can be called again with the same input, so the generated client may retry it
+		case "idempotent":
+			nm := L(a.FullName())
+			Log("idempotent", nm)
+			if f := funcs[nm]; f != nil {
+				f.idempotent = true
+			}
+
+		// the generated client retries the calls (of the idempotent functions) failed with Unavailable, at most this many times
+		case "retry":
+			nm := L(a.FullName())
+			Log("retry", nm, "attempts", a.Size)
+			if f := funcs[nm]; f != nil {
+				f.maxAttempts = a.Size
+			}
+
+		// mask the argument (or record field) of the function (or all functions in the package) in the logs
+		case "sensitive":
+			funName, argName := "", L(a.Name)
+			if i := strings.LastIndexByte(argName, '.'); i >= 0 {
+				funName, argName = argName[:i], argName[i+1:]
+			}
+			for _, f := range funcs {
+				if !strings.EqualFold(f.Package, a.Package) || funName != "" && L(f.name) != funName {
+					continue
+				}
+				for i := range f.Args {
+					markSensitive(&f.Args[i], argName)
+				}
+			}
+
+		// the argument (or record field) of the function (or all functions in the package) must not be empty (NULL)
+		case "required":
+			funName, argName := "", L(a.Name)
+			if i := strings.LastIndexByte(argName, '.'); i >= 0 {
+				funName, argName = argName[:i], argName[i+1:]
+			}
+			for _, f := range funcs {
+				if !strings.EqualFold(f.Package, a.Package) || funName != "" && L(f.name) != funName {
+					continue
+				}
+				for i := range f.Args {
+					markRequired(&f.Args[i], argName)
+				}
+			}
+
+		// inject the value into the IN argument of the function (or all functions in the package)
+		case "inject":
+			if !IsInjectSource(a.Other) {
+				Log("msg", "unknown inject source", "annotation", a)
+				continue
+			}
+			funName, argName := "", L(a.Name)
+			if i := strings.LastIndexByte(argName, '.'); i >= 0 {
+				funName, argName = argName[:i], argName[i+1:]
+			}
+			for _, f := range funcs {
+				if !strings.EqualFold(f.Package, a.Package) || funName != "" && L(f.name) != funName {
+					continue
+				}
+				for i, arg := range f.Args {
+					if arg.Name == argName && arg.Direction == DIR_IN && arg.Flavor == FLAVOR_SIMPLE {
+						Log("inject", f.Name()+"."+argName, "from", a.Other)
+						f.Args[i].Inject = a.Other
+					}
+				}
+			}
 		}
 	}
 	functions = functions[:0]
@@ -436,3 +560,33 @@ func ApplyAnnotations(functions []Function, annotations []Annotation) []Function
 	}
 	return functions
 }
+
+// markSensitive marks the argument, or its record fields named name as sensitive.
+func markSensitive(arg *Argument, name string) {
+	if arg.Name == name {
+		arg.Sensitive = true
+	}
+	for _, sub := range arg.RecordOf {
+		if sub.Argument != nil {
+			markSensitive(sub.Argument, name)
+		}
+	}
+	if arg.TableOf != nil {
+		markSensitive(arg.TableOf, name)
+	}
+}
+
+// markRequired marks the argument, or its record fields named name as required.
+func markRequired(arg *Argument, name string) {
+	if arg.Name == name {
+		arg.Required = true
+	}
+	for _, sub := range arg.RecordOf {
+		if sub.Argument != nil {
+			markRequired(sub.Argument, name)
+		}
+	}
+	if arg.TableOf != nil {
+		markRequired(arg.TableOf, name)
+	}
+}
@@ -35,3 +35,80 @@ func TestParseCsv(t *testing.T) {
 		}
 	}
 }
+
+func TestApplySessionBoundAnnotation(t *testing.T) {
+	functions := ApplyAnnotations(
+		[]Function{{Package: "pkg", name: "stateful"}, {Package: "pkg", name: "stateless"}},
+		[]Annotation{{Package: "pkg", Type: "session-bound", Name: "stateful"}},
+	)
+	for _, f := range functions {
+		if want := f.name == "stateful"; f.sessionBound != want {
+			t.Errorf("%s: sessionBound=%t, wanted %t", f.name, f.sessionBound, want)
+		}
+	}
+}
+
+func TestApplyIdempotentAnnotation(t *testing.T) {
+	functions := ApplyAnnotations(
+		[]Function{{Package: "pkg", name: "get"}, {Package: "pkg", name: "put"}},
+		[]Annotation{
+			{Package: "pkg", Type: "idempotent", Name: "get"},
+			{Package: "pkg", Type: "retry", Name: "get", Size: 3},
+		},
+	)
+	for _, f := range functions {
+		if want := f.name == "get"; f.idempotent != want {
+			t.Errorf("%s: idempotent=%t, wanted %t", f.name, f.idempotent, want)
+		}
+	}
+}
+
+func TestApplyRequiredAnnotation(t *testing.T) {
+	rec := NewArgument("p_rec", "PL/SQL RECORD", "PL/SQL RECORD", "PKG.REC_TYP", "IN", 0, "", 0, 0, 0)
+	name := NewArgument("name", "VARCHAR2", "VARCHAR2", "", "IN", 0, "", 0, 0, 10)
+	rec.RecordOf = []NamedArgument{{Name: "name", Argument: &name}}
+	functions := ApplyAnnotations(
+		[]Function{{Package: "pkg", name: "fun", Args: []Argument{
+			NewArgument("p_id", "NUMBER", "NUMBER", "", "IN", 0, "", 0, 0, 0),
+			NewArgument("p_note", "VARCHAR2", "VARCHAR2", "", "IN", 0, "", 0, 0, 10),
+			rec,
+		}}},
+		[]Annotation{
+			{Package: "pkg", Type: "required", Name: "fun.p_id"},
+			{Package: "pkg", Type: "required", Name: "name"},
+		},
+	)
+	args := functions[0].Args
+	if !args[0].Required || args[1].Required {
+		t.Errorf("p_id required=%t, p_note required=%t", args[0].Required, args[1].Required)
+	}
+	if !args[2].RecordOf[0].Required {
+		t.Error("p_rec.name is not required")
+	}
+}
+
+func TestParseCharUsed(t *testing.T) {
+	userArgs := make(chan []UserArgument, 1)
+	userArgs <- []UserArgument{
+		{PackageName: "PKG", ObjectName: "FUN", ArgumentName: "P_NAME", InOut: "IN", DataType: "VARCHAR2", CharLength: 10, CharUsed: "C"},
+		{PackageName: "PKG", ObjectName: "FUN", ArgumentName: "P_CODE", InOut: "IN", DataType: "VARCHAR2", CharLength: 10, CharUsed: "B"},
+	}
+	close(userArgs)
+	functions, err := ParseArguments(userArgs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := functions[0].Args
+	if args[0].CharUsed != "C" || args[0].AbsType != "VARCHAR2(10 CHAR)" {
+		t.Errorf("%s: got %q (%s)", args[0].Name, args[0].CharUsed, args[0].AbsType)
+	}
+	if args[1].AbsType != "VARCHAR2(10)" {
+		t.Errorf("%s: got %s", args[1].Name, args[1].AbsType)
+	}
+	if n := args[0].strLen("árvíztűrő"); n != 9 {
+		t.Errorf("%s: got length %d", args[0].Name, n)
+	}
+	if n := args[1].strLen("árvíztűrő"); n != 13 {
+		t.Errorf("%s: got length %d", args[1].Name, n)
+	}
+}
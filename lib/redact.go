@@ -0,0 +1,113 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oracall
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// Redacted is the replacement of the redacted values.
+const Redacted = "***"
+
+// RedactJSON returns the JSON data with the values of the given keys
+// (case-insensitively, at any depth) replaced by Redacted.
+//
+// Data which is not valid JSON is replaced as a whole.
+func RedactJSON(data []byte, keys ...string) []byte {
+	if len(keys) == 0 || len(data) == 0 {
+		return data
+	}
+	redact := make(map[string]struct{}, len(keys))
+	for _, k := range keys {
+		redact[strings.ToLower(k)] = struct{}{}
+	}
+	return redactJSON(data, redact, nil)
+}
+
+// RedactPaths returns the JSON data with the values at the paths (see RegisterSensitive),
+// and of the extra keys (at any depth), replaced by Redacted - case-insensitively.
+//
+// Data which is not valid JSON is replaced as a whole.
+func RedactPaths(data []byte, paths []string, extra ...string) []byte {
+	if len(paths) == 0 && len(extra) == 0 || len(data) == 0 {
+		return data
+	}
+	redact := make(map[string]struct{}, len(extra))
+	for _, k := range extra {
+		redact[strings.ToLower(k)] = struct{}{}
+	}
+	tree := make(pathTree, len(paths))
+	for _, path := range paths {
+		tree.add(strings.Split(strings.ToLower(path), "."))
+	}
+	return redactJSON(data, redact, tree)
+}
+
+// pathTree is the tree of the paths to be redacted: a nil subtree redacts the whole value of its key.
+type pathTree map[string]pathTree
+
+func (t pathTree) add(path []string) {
+	sub, ok := t[path[0]]
+	if ok && sub == nil { // the whole value is redacted already
+		return
+	}
+	if len(path) == 1 {
+		t[path[0]] = nil
+		return
+	}
+	if sub == nil {
+		sub = make(pathTree)
+		t[path[0]] = sub
+	}
+	sub.add(path[1:])
+}
+
+func redactJSON(data []byte, redact map[string]struct{}, tree pathTree) []byte {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return []byte(`"` + Redacted + `"`)
+	}
+	b, err := json.Marshal(redactValue(v, redact, tree))
+	if err != nil {
+		return []byte(`"` + Redacted + `"`)
+	}
+	return b
+}
+
+func redactValue(v interface{}, redact map[string]struct{}, tree pathTree) interface{} {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		for k, sub := range x {
+			lk := strings.ToLower(k)
+			subTree, inTree := tree[lk]
+			if _, ok := redact[lk]; ok || inTree && subTree == nil {
+				x[k] = Redacted
+			} else {
+				x[k] = redactValue(sub, redact, subTree)
+			}
+		}
+	case []interface{}:
+		for i, sub := range x {
+			x[i] = redactValue(sub, redact, tree)
+		}
+	}
+	return v
+}
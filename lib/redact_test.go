@@ -0,0 +1,36 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oracall
+
+import "testing"
+
+func TestRedactJSON(t *testing.T) {
+	for tN, tC := range []struct {
+		In, Want string
+		Keys     []string
+	}{
+		{In: `{"a":1}`, Want: `{"a":1}`},
+		{In: `{"a":1,"password":"x"}`, Keys: []string{"PASSWORD"}, Want: `{"a":1,"password":"***"}`},
+		{In: `{"rows":[{"card":"1234","n":12345678901234567890}]}`, Keys: []string{"card"},
+			Want: `{"rows":[{"card":"***","n":12345678901234567890}]}`},
+		{In: `{"a":`, Keys: []string{"a"}, Want: `"***"`},
+	} {
+		if got := string(RedactJSON([]byte(tC.In), tC.Keys...)); got != tC.Want {
+			t.Errorf("%d. got %s, wanted %s", tN, got, tC.Want)
+		}
+	}
+}
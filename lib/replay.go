@@ -0,0 +1,267 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oracall
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-logfmt/logfmt"
+	"github.com/kylelemons/godebug/diff"
+	errors "golang.org/x/xerrors"
+)
+
+// ErrGoldenMismatch is returned by Golden when the output differs from the golden file.
+var ErrGoldenMismatch = errors.New("output differs from the golden file")
+
+// ReplayRecord is a logged request, read by ReadReplayLog.
+type ReplayRecord struct {
+	// Method is the full gRPC method ("/pkg.Service/Method").
+	Method string
+	// Input is the JSON input.
+	Input json.RawMessage
+}
+
+// Name returns the name of the method, without the service.
+func (r ReplayRecord) Name() string {
+	if i := strings.LastIndexByte(r.Method, '/'); i >= 0 {
+		return r.Method[i+1:]
+	}
+	return r.Method
+}
+
+// Redacted reports whether the input contains a value redacted by RedactPaths (or RedactJSON),
+// as those cannot be replayed.
+func (r ReplayRecord) Redacted() bool {
+	var v interface{}
+	if err := json.Unmarshal(r.Input, &v); err != nil {
+		return false
+	}
+	return hasRedacted(v)
+}
+
+func hasRedacted(v interface{}) bool {
+	switch x := v.(type) {
+	case string:
+		return x == Redacted
+	case map[string]interface{}:
+		for _, sub := range x {
+			if hasRedacted(sub) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, sub := range x {
+			if hasRedacted(sub) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ReadReplayLog reads the logfmt-formatted records from r, calling f with each request logged with its input:
+// with both a REQ (the method) and a req (the JSON input) key, as orasrv logs them at debug level
+// (or at info level, with LogConfig.LogRequests).
+func ReadReplayLog(r io.Reader, f func(ReplayRecord) error) error {
+	dec := logfmt.NewDecoder(r)
+	for dec.ScanRecord() {
+		var rec ReplayRecord
+		for dec.ScanKeyval() {
+			switch string(dec.Key()) {
+			case "REQ":
+				rec.Method = string(dec.Value())
+			case "req":
+				rec.Input = json.RawMessage(bytes.TrimSpace(dec.Value()))
+			}
+		}
+		if err := dec.Err(); err != nil {
+			return err
+		}
+		if rec.Method == "" || len(rec.Input) == 0 {
+			continue
+		}
+		if err := f(rec); err != nil {
+			return err
+		}
+	}
+	return dec.Err()
+}
+
+// ReplayResult is the result of a replayed call, as stored in the golden files.
+type ReplayResult struct {
+	Output interface{} `json:"output,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// NewReplayResult returns the ReplayResult of the output and the error of a call.
+func NewReplayResult(output interface{}, err error) ReplayResult {
+	if err != nil {
+		return ReplayResult{Output: output, Error: err.Error()}
+	}
+	return ReplayResult{Output: output}
+}
+
+// IgnoreRules are the values ignored when comparing the outputs of the calls.
+type IgnoreRules struct {
+	// Fields are the names of the ignored fields (like the IDs generated from sequences),
+	// or their dot-separated paths from the root, like "output.p_rows.id".
+	Fields []string
+	// Timestamps ignores the values looking like timestamps.
+	Timestamps bool
+}
+
+// ParseIgnoreRules parses the comma-separated list of the ignored fields,
+// where "timestamps" means all the timestamps.
+func ParseIgnoreRules(s string) IgnoreRules {
+	var rules IgnoreRules
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f == "" {
+			continue
+		} else if f == "timestamps" {
+			rules.Timestamps = true
+		} else {
+			rules.Fields = append(rules.Fields, f)
+		}
+	}
+	return rules
+}
+
+const ignoredValue = "<ignored>"
+
+// Normalize returns the indented JSON of v (a JSON text, or anything marshaled to it),
+// with the object keys sorted, and the ignored values replaced.
+func (rules IgnoreRules) Normalize(v interface{}) ([]byte, error) {
+	var data []byte
+	switch x := v.(type) {
+	case []byte:
+		data = x
+	case json.RawMessage:
+		data = x
+	default:
+		var err error
+		if data, err = json.Marshal(v); err != nil {
+			return nil, err
+		}
+	}
+	var tree interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&tree); err != nil {
+		return nil, errors.Errorf("%s: %w", data, err)
+	}
+	b, err := json.MarshalIndent(rules.normalize(tree, ""), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+func (rules IgnoreRules) normalize(v interface{}, path string) interface{} {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		for k, e := range x {
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+			if rules.ignored(k, p) {
+				x[k] = ignoredValue
+				continue
+			}
+			x[k] = rules.normalize(e, p)
+		}
+	case []interface{}:
+		for i, e := range x {
+			x[i] = rules.normalize(e, path)
+		}
+	case string:
+		if rules.Timestamps && isTimestamp(x) {
+			return ignoredValue
+		}
+	}
+	return v
+}
+
+func (rules IgnoreRules) ignored(name, path string) bool {
+	for _, f := range rules.Fields {
+		if strings.EqualFold(f, name) || strings.EqualFold(f, path) {
+			return true
+		}
+	}
+	return false
+}
+
+func isTimestamp(s string) bool {
+	if len(s) < len("2006-01-02T15:04:05Z") || s[4] != '-' || s[10] != 'T' {
+		return false
+	}
+	_, err := time.Parse(time.RFC3339Nano, s)
+	return err == nil
+}
+
+// Compare returns the differences of a and b (JSON texts, or anything marshaled to JSON), without the ignored values.
+func (rules IgnoreRules) Compare(a, b interface{}) (string, error) {
+	na, err := rules.Normalize(a)
+	if err != nil {
+		return "", err
+	}
+	nb, err := rules.Normalize(b)
+	if err != nil {
+		return "", err
+	}
+	if bytes.Equal(na, nb) {
+		return "", nil
+	}
+	return diff.Diff(string(na), string(nb)), nil
+}
+
+// Golden compares the output with the golden file fn, returning ErrGoldenMismatch with the differences;
+// or records it into the file, when update is true.
+func Golden(fn string, output interface{}, update bool, rules IgnoreRules) error {
+	if update {
+		b, err := rules.Normalize(output)
+		if err != nil {
+			return err
+		}
+		if err = os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+			return err
+		}
+		return ioutil.WriteFile(fn, b, 0644)
+	}
+	want, err := ioutil.ReadFile(fn)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return errors.Errorf("%s: no golden file (run with -update to record it): %w", fn, err)
+		}
+		return err
+	}
+	d, err := rules.Compare(json.RawMessage(want), output)
+	if err != nil {
+		return errors.Errorf("%s: %w", fn, err)
+	}
+	if d != "" {
+		return errors.Errorf("%s: %w:\n%s", fn, ErrGoldenMismatch, d)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oracall
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	errors "golang.org/x/xerrors"
+)
+
+func TestReadReplayLog(t *testing.T) {
+	const logs = `REQ=/pkg.DbPkg/GetX
+REQ=/pkg.DbPkg/GetX req="{\"p_id\":1}\n"
+RESP=/pkg.DbPkg/GetX dur=1ms error=null
+REQ=/pkg.DbPkg/ListX req="{}"
+`
+	var got []ReplayRecord
+	if err := ReadReplayLog(strings.NewReader(logs), func(rec ReplayRecord) error {
+		got = append(got, rec)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d records, wanted 2: %v", len(got), got)
+	}
+	if got[0].Name() != "GetX" || string(got[0].Input) != `{"p_id":1}` {
+		t.Errorf("got %s %s", got[0].Name(), got[0].Input)
+	}
+	if got[1].Method != "/pkg.DbPkg/ListX" {
+		t.Errorf("got %q", got[1].Method)
+	}
+}
+
+func TestReplayRecordRedacted(t *testing.T) {
+	input := []byte(`{"p_id":1,"p_rows":[{"name":"a","password":"secret"}]}`)
+	if rec := (ReplayRecord{Input: input}); rec.Redacted() {
+		t.Errorf("%s: got redacted", rec.Input)
+	}
+	if rec := (ReplayRecord{Input: RedactJSON(input, "password")}); !rec.Redacted() {
+		t.Errorf("%s: got not redacted", rec.Input)
+	}
+}
+
+func TestIgnoreRules(t *testing.T) {
+	rules := ParseIgnoreRules("timestamps, p_id ,output.rows.seq")
+	if !rules.Timestamps || len(rules.Fields) != 2 {
+		t.Fatalf("got %+v", rules)
+	}
+	a := `{"output":{"p_id":1,"created":"2020-01-02T03:04:05Z","rows":[{"seq":10,"name":"a"}]}}`
+	b := `{"output":{"p_id":2,"created":"2020-02-03T04:05:06.7+01:00","rows":[{"seq":11,"name":"a"}]}}`
+	if d, err := rules.Compare([]byte(a), []byte(b)); err != nil || d != "" {
+		t.Errorf("got %q, %v", d, err)
+	}
+	c := strings.Replace(b, `"name":"a"`, `"name":"b"`, 1)
+	if d, err := rules.Compare([]byte(a), []byte(c)); err != nil || d == "" {
+		t.Errorf("got no difference (%v)", err)
+	}
+}
+
+func TestGolden(t *testing.T) {
+	dn, err := ioutil.TempDir("", "golden-")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer os.RemoveAll(dn)
+	fn := filepath.Join(dn, "testdata", "GetX-001.json")
+	rules := IgnoreRules{Fields: []string{"p_id"}}
+
+	if err = Golden(fn, NewReplayResult(map[string]interface{}{"p_id": 1, "p_name": "a"}, nil), false, rules); !os.IsNotExist(errors.Unwrap(err)) {
+		t.Errorf("got %v, wanted not exist", err)
+	}
+	if err = Golden(fn, NewReplayResult(map[string]interface{}{"p_id": 1, "p_name": "a"}, nil), true, rules); err != nil {
+		t.Fatal(err)
+	}
+	if err = Golden(fn, NewReplayResult(map[string]interface{}{"p_id": 2, "p_name": "a"}, nil), false, rules); err != nil {
+		t.Error(err)
+	}
+	if err = Golden(fn, NewReplayResult(nil, errors.New("ORA-01403: no data found")), false, rules); !errors.Is(err, ErrGoldenMismatch) {
+		t.Errorf("got %v, wanted mismatch", err)
+	}
+}
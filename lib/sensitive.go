@@ -0,0 +1,153 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oracall
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// SensitivePattern marks the arguments (and record fields) with matching names as sensitive,
+// besides the ones annotated with
+//
+//	--oracall:sensitive p_password
+var SensitivePattern *regexp.Regexp
+
+// IsSensitive reports whether the argument is sensitive: annotated as such, or its name matches SensitivePattern.
+func (arg Argument) IsSensitive() bool {
+	return arg.Sensitive || SensitivePattern != nil && SensitivePattern.MatchString(arg.Name)
+}
+
+// hasSensitive reports whether the function has sensitive arguments or record fields
+// - including the injected ones, which are in the parameters of the call, but not in its input.
+func (f Function) hasSensitive() bool {
+	args := f.Args
+	if f.Returns != nil {
+		args = append(append(make([]Argument, 0, len(args)+1), args...), *f.Returns)
+	}
+	for _, arg := range args {
+		if len(sensitivePaths(arg, "")) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// sensitivePaths returns the paths (see RegisterSensitive) of the sensitive arguments and record fields
+// of the input (or output) message of the function.
+func (f Function) sensitivePaths(out bool) []string {
+	dirmap := DIR_IN
+	if out {
+		dirmap = DIR_OUT
+	}
+	var paths []string
+	for _, arg := range f.Args {
+		if arg.Direction&dirmap > 0 && arg.Inject == "" {
+			paths = append(paths, sensitivePaths(arg, "")...)
+		}
+	}
+	if out && f.Returns != nil {
+		paths = append(paths, sensitivePaths(*f.Returns, "")...)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// sensitivePaths returns the paths of the argument, or of its sensitive record fields, prefixed with prefix.
+func sensitivePaths(arg Argument, prefix string) []string {
+	path := prefix + strings.ToLower(replHidden(arg.Name))
+	if arg.IsSensitive() || arg.TableOf != nil && arg.TableOf.IsSensitive() {
+		return []string{path}
+	}
+	fields := arg.RecordOf
+	if arg.TableOf != nil {
+		fields = arg.TableOf.RecordOf
+	}
+	var paths []string
+	for _, sub := range fields {
+		if sub.Argument != nil {
+			paths = append(paths, sensitivePaths(*sub.Argument, path+".")...)
+		}
+	}
+	return paths
+}
+
+var (
+	sensitiveMu sync.RWMutex
+	sensitive   = make(map[string][]string)
+)
+
+// RegisterSensitive registers the paths of the sensitive fields of the message, by its name (see MessageName)
+// - the generated code calls this for its input and output structs.
+//
+// A path is the (JSON) name of the field, prefixed with the names of its parent record fields and dots,
+// like "p_rec.card_no"; the tables (arrays) are walked through.
+func RegisterSensitive(message string, paths ...string) {
+	sensitiveMu.Lock()
+	sensitive[message] = append(sensitive[message], paths...)
+	sensitiveMu.Unlock()
+}
+
+// SensitivePaths returns the paths of the sensitive fields of the message, registered with RegisterSensitive.
+func SensitivePaths(message string) []string {
+	sensitiveMu.RLock()
+	paths := sensitive[message]
+	sensitiveMu.RUnlock()
+	return paths
+}
+
+// MessageName returns the name of the message v: the result of its XXX_MessageName method, if it has one,
+// or the name of its type.
+func MessageName(v interface{}) string {
+	if m, ok := v.(interface{ XXX_MessageName() string }); ok {
+		return m.XXX_MessageName()
+	}
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil {
+		return ""
+	}
+	return t.Name()
+}
+
+// RedactedJSON returns v as JSON, with its sensitive fields (see RegisterSensitive) redacted - for logging.
+func RedactedJSON(v interface{}) json.RawMessage {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return json.RawMessage(fmt.Sprintf("%q", err.Error()))
+	}
+	return json.RawMessage(RedactPaths(b, SensitivePaths(MessageName(v))))
+}
+
+// MaskParams returns a copy of params, with the elements at the given positions replaced by Redacted
+// - for logging the parameters of the sensitive arguments and record fields.
+func MaskParams(params []interface{}, idxs ...int) []interface{} {
+	masked := append(make([]interface{}, 0, len(params)), params...)
+	for _, i := range idxs {
+		if 0 <= i && i < len(masked) {
+			masked[i] = Redacted
+		}
+	}
+	return masked
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oracall
+
+import (
+	"database/sql"
+	"io"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/godror/godror"
+	errors "golang.org/x/xerrors"
+)
+
+func TestMaskParams(t *testing.T) {
+	out := "secret"
+	params := []interface{}{"x", "secret", sql.Out{Dest: &out}, 1, nil}
+	got := MaskParams(params, 1, 2, 9)
+	want := []interface{}{"x", Redacted, Redacted, 1, nil}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, wanted %v", got, want)
+	}
+	if params[1] != "secret" {
+		t.Error("params modified")
+	}
+}
+
+func TestMaskSensitiveRecordField(t *testing.T) {
+	fun := testCases[2].ParseCsv(t, 2)[0]
+	var recField string
+	for i, arg := range fun.Args {
+		switch arg.Name {
+		case "p_sessionid":
+			fun.Args[i].Sensitive = true
+		case "p_kotveny":
+			for _, sub := range arg.RecordOf {
+				if sub.Name == "szamlaszam" {
+					sub.Argument.Sensitive = true
+					recField = sub.Name
+				}
+			}
+		}
+	}
+	if recField == "" {
+		t.Fatal("no szamlaszam field in p_kotveny")
+	}
+
+	binds := make(map[string]bind)
+	decls, pre, call, post, _, _, err := fun.prepareCallBinds(binds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, keys := godror.MapToSlice(fun.plsqlText(decls, pre, call, post), func(key string) interface{} { return key })
+	var want []string
+	for i, k := range keys {
+		if b, ok := binds[k.(string)]; ok && (b.path[len(b.path)-1] == recField || b.path[0] == "p_sessionid") {
+			want = append(want, strconv.Itoa(i))
+		}
+	}
+	if len(want) < 2 {
+		t.Fatalf("got %d sensitive binds of %q, wanted at least 2", len(want), keys)
+	}
+
+	_, callFun := fun.PlsqlBlock("")
+	m := regexp.MustCompile(`oracall\.MaskParams\(params, ([0-9, ]+)\)`).FindStringSubmatch(callFun)
+	if m == nil {
+		t.Fatalf("no MaskParams in\n%s", callFun)
+	}
+	if got := strings.Split(m[1], ", "); !reflect.DeepEqual(got, want) {
+		t.Errorf("masked %q, wanted %q", got, want)
+	}
+
+	// the error of the failed call gets to the client and the audit log, too
+	if !strings.Contains(callFun, `err = errors.Errorf("%q %+v: %w", qry, `+m[0]+`, err)`) {
+		t.Errorf("the error of the call is not masked:\n%s", callFun)
+	}
+	params := make([]interface{}, len(keys))
+	for i := range params {
+		params[i] = "secret"
+	}
+	idxs := make([]int, len(want))
+	for i, s := range want {
+		idxs[i], _ = strconv.Atoi(s)
+	}
+	callErr := errors.Errorf("%q %+v: %w", "qry", MaskParams(params, idxs...), io.EOF)
+	if strings.Count(callErr.Error(), "secret") != len(params)-len(idxs) {
+		t.Errorf("sensitive value in the error: %v", callErr)
+	}
+}
+
+func TestSensitivePaths(t *testing.T) {
+	defer func(old *regexp.Regexp) { SensitivePattern = old }(SensitivePattern)
+	SensitivePattern = regexp.MustCompile("(?i)card")
+	rec := Argument{Name: "p_rec", Flavor: FLAVOR_RECORD, Direction: DIR_IN,
+		RecordOf: []NamedArgument{
+			{Name: "card_no", Argument: &Argument{Name: "card_no"}},
+			{Name: "holder", Argument: &Argument{Name: "holder"}},
+		}}
+	f := Function{Args: []Argument{
+		{Name: "p_password", Sensitive: true, Direction: DIR_IN},
+		{Name: "p_name", Direction: DIR_INOUT},
+		rec,
+		{Name: "p_token", Sensitive: true, Direction: DIR_OUT},
+	}}
+	if got, want := f.sensitivePaths(false), []string{"p_password", "p_rec.card_no"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("input: got %q, wanted %q", got, want)
+	}
+	if got, want := f.sensitivePaths(true), []string{"p_token"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("output: got %q, wanted %q", got, want)
+	}
+
+	type testSensitivePaths_Input struct{}
+	name := MessageName(&testSensitivePaths_Input{})
+	if name != "testSensitivePaths_Input" {
+		t.Errorf("MessageName: got %q", name)
+	}
+	RegisterSensitive(name, "p_rec.card_no")
+	// only the card_no field of p_rec in this message, not any card_no
+	data := []byte(`{"card_no":"1","p_rec":[{"card_no":"2","holder":"x"}]}`)
+	if got, want := string(RedactPaths(data, SensitivePaths(name))), `{"card_no":"1","p_rec":[{"card_no":"***","holder":"x"}]}`; got != want {
+		t.Errorf("got %s, wanted %s", got, want)
+	}
+	if paths := SensitivePaths("other_Input"); len(paths) != 0 {
+		t.Errorf("other message: got %q", paths)
+	}
+}
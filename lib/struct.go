@@ -47,6 +47,10 @@ type Function struct {
 	LastDDL              time.Time
 	handle               []string
 	maxTableSize         int
+	sessionBound         bool
+	idempotent           bool
+	timeout              time.Duration
+	maxAttempts          int
 }
 
 func (f Function) Name() string {
@@ -95,6 +99,10 @@ func (f Function) HasCursorOut() bool {
 	return false
 }
 
+// IsSessionBound reports whether the function has the "session-bound" annotation:
+// it must be called on the dedicated session of the client.
+func (f Function) IsSessionBound() bool { return f.sessionBound }
+
 type direction uint8
 
 func (dir direction) IsInput() bool  { return dir&DIR_IN > 0 }
@@ -157,7 +165,17 @@ type Argument struct {
 	Direction direction
 	Precision uint8
 	Scale     uint8
-	mu        *sync.Mutex
+	// Inject is the source of the value of this (IN) argument, instead of the input message
+	// - see InjectValue.
+	Inject string `xml:"-"`
+	// Sensitive marks the argument's value to be masked in the logs - see IsSensitive.
+	Sensitive bool `xml:"-"`
+	// Required marks the argument as NOT NULL: the generated checks reject its empty value.
+	Required bool `xml:"-"`
+	// CharUsed is the length semantics of the Charlength (char_used of all_arguments):
+	// "C" for CHAR, "B" (or empty) for BYTE.
+	CharUsed string `xml:"-"`
+	mu       *sync.Mutex
 }
 type NamedArgument struct {
 	Name string
@@ -182,6 +200,24 @@ func (a Argument) IsOutput() bool {
 	return a.Direction&DIR_OUT > 0
 }
 
+// lengthSemantics returns the character set of the string argument (DBCharset or DBNCharset),
+// and whether Oracle counts its length in characters (CHAR semantics, or a national character type) instead of bytes.
+func (a Argument) lengthSemantics() (charset string, inChars bool) {
+	if a.Charset == "NCHAR_CS" || strings.HasPrefix(a.Type, "N") {
+		return DBNCharset, true
+	}
+	return DBCharset, a.CharUsed == "C"
+}
+
+// strLen returns the length of s, as Oracle counts it for the argument (-1 if it cannot be counted, see EncodedLen).
+func (a Argument) strLen(s string) int {
+	charset, inChars := a.lengthSemantics()
+	if inChars {
+		return CharLen(s, charset)
+	}
+	return EncodedLen(s, charset)
+}
+
 func NewArgument(name, dataType, plsType, typeName, dirName string, dir direction,
 	charset string, precision, scale uint8, charlength uint) Argument {
 
@@ -254,6 +290,8 @@ func UnoCap(text string) string {
 	i := strings.Index(text, "_")
 	if i == 0 {
 		return capitalize(text)
+	} else if i < 0 {
+		return strings.ToUpper(text)
 	}
 	return strings.ToUpper(text[:i]) + "_" + strings.ToLower(text[i+1:])
 }
@@ -0,0 +1,234 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oracall
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/godror/godror"
+	errors "golang.org/x/xerrors"
+)
+
+// Span is a traced unit of work.
+type Span interface {
+	SetAttribute(key string, value interface{})
+	RecordError(error)
+	End()
+}
+
+// Tracer starts the spans of the generated calls.
+//
+// An OpenTelemetry trace.Tracer can be used with the NewTracer adapter of
+// the github.com/tgulacsi/oracall/otel module.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// TracerFunc is a function usable as a Tracer.
+type TracerFunc func(ctx context.Context, name string) (context.Context, Span)
+
+// Start calls f.
+func (f TracerFunc) Start(ctx context.Context, name string) (context.Context, Span) {
+	return f(ctx, name)
+}
+
+// StartSpan starts a span named name with tracer, or with the Tracer of ctx if tracer is nil.
+//
+// The returned function ends the span, recording the error if it's not nil.
+func StartSpan(ctx context.Context, tracer Tracer, name string) (context.Context, func(error)) {
+	if tracer == nil {
+		if tracer = ContextGetTracer(ctx); tracer == nil {
+			return ctx, func(error) {}
+		}
+	}
+	ctx, span := tracer.Start(ctx, name)
+	return ctx, func(err error) {
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.End()
+	}
+}
+
+// TraceContext is the W3C Trace Context of a call (the "traceparent" header).
+type TraceContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Flags   byte
+	// State is the "tracestate" header, passed through unchanged.
+	State string
+}
+
+// ParseTraceParent parses a W3C "traceparent" header.
+func ParseTraceParent(s string) (TraceContext, error) {
+	var tc TraceContext
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" ||
+		parts[0] == "00" && len(parts) != 4 {
+		return tc, errors.Errorf("%q: %w", s, errBadTraceParent)
+	}
+	var flags [1]byte
+	for _, x := range []struct {
+		Src string
+		Dst []byte
+	}{{parts[1], tc.TraceID[:]}, {parts[2], tc.SpanID[:]}, {parts[3], flags[:]}} {
+		if len(x.Src) != 2*len(x.Dst) || strings.ToLower(x.Src) != x.Src {
+			return tc, errors.Errorf("%q: %w", s, errBadTraceParent)
+		}
+		if _, err := hex.Decode(x.Dst, []byte(x.Src)); err != nil {
+			return tc, errors.Errorf("%q: %w", s, err)
+		}
+	}
+	tc.Flags = flags[0]
+	if !tc.IsValid() {
+		return tc, errors.Errorf("%q: %w", s, errBadTraceParent)
+	}
+	return tc, nil
+}
+
+var errBadTraceParent = errors.New("bad traceparent")
+
+// IsValid reports whether both the trace and the span ID are non-zero.
+func (tc TraceContext) IsValid() bool {
+	return tc.TraceID != [16]byte{} && tc.SpanID != [8]byte{}
+}
+
+// TraceIDString returns the trace ID in hex.
+func (tc TraceContext) TraceIDString() string { return hex.EncodeToString(tc.TraceID[:]) }
+
+// String returns the trace context in "traceparent" format.
+func (tc TraceContext) String() string {
+	return fmt.Sprintf("00-%x-%x-%02x", tc.TraceID[:], tc.SpanID[:], tc.Flags)
+}
+
+// NewChild returns a new trace context with a new span ID - and a new trace ID, if tc is not valid.
+func (tc TraceContext) NewChild() TraceContext {
+	if tc.TraceID == [16]byte{} {
+		_, _ = rand.Read(tc.TraceID[:])
+		tc.Flags = 1 // sampled
+	}
+	_, _ = rand.Read(tc.SpanID[:])
+	return tc
+}
+
+type ctxKey string
+
+const (
+	tracerCtxKey       = ctxKey("tracer")
+	traceContextCtxKey = ctxKey("traceContext")
+	reqIDCtxKey        = ctxKey("reqID")
+)
+
+// ContextWithReqID returns a context with the request ID.
+func ContextWithReqID(ctx context.Context, reqID string) context.Context {
+	return context.WithValue(ctx, reqIDCtxKey, reqID)
+}
+
+// ContextGetReqID returns the request ID of the context, or the empty string.
+func ContextGetReqID(ctx context.Context) string {
+	reqID, _ := ctx.Value(reqIDCtxKey).(string)
+	return reqID
+}
+
+// ContextWithTracer returns a context with the tracer, to be used by StartSpan.
+func ContextWithTracer(ctx context.Context, tracer Tracer) context.Context {
+	return context.WithValue(ctx, tracerCtxKey, tracer)
+}
+
+// ContextGetTracer returns the Tracer of the context, or nil.
+func ContextGetTracer(ctx context.Context) Tracer {
+	if tracer, ok := ctx.Value(tracerCtxKey).(Tracer); ok {
+		return tracer
+	}
+	return nil
+}
+
+// ContextWithTraceContext returns a context with the trace context.
+func ContextWithTraceContext(ctx context.Context, tc TraceContext) context.Context {
+	return context.WithValue(ctx, traceContextCtxKey, tc)
+}
+
+// ContextGetTraceContext returns the trace context of ctx.
+func ContextGetTraceContext(ctx context.Context) (TraceContext, bool) {
+	tc, ok := ctx.Value(traceContextCtxKey).(TraceContext)
+	return tc, ok && tc.IsValid()
+}
+
+// ContextWithTraceTag returns a context with a godror.TraceTag for module and action,
+// with the request ID as ClientIdentifier and the trace ID as ClientInfo,
+// to correlate the Oracle session (V$SESSION, audit trail) with the request and the trace.
+func ContextWithTraceTag(ctx context.Context, module, action string) context.Context {
+	tt := godror.TraceTag{Module: module, Action: action}
+	if tt.ClientIdentifier = ContextGetReqID(ctx); len(tt.ClientIdentifier) > maxClientIdentifierLength {
+		tt.ClientIdentifier = tt.ClientIdentifier[:maxClientIdentifierLength]
+	}
+	if tc, ok := ContextGetTraceContext(ctx); ok {
+		tt.ClientInfo = tc.TraceIDString()
+	}
+	return godror.ContextWithTraceTag(ctx, tt)
+}
+
+// maxClientIdentifierLength is the maximum length of DBMS_SESSION.SET_IDENTIFIER.
+const maxClientIdentifierLength = 64
+
+// LogTracer is a Tracer which logs the finished spans with its Log function.
+type LogTracer struct {
+	Log func(...interface{}) error
+}
+
+// Start a new span, as a child of the trace context of ctx.
+func (t LogTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	parent, _ := ContextGetTraceContext(ctx)
+	tc := parent.NewChild()
+	return ContextWithTraceContext(ctx, tc), &logSpan{
+		log: t.Log, name: name, start: time.Now(),
+		tc: tc, parentID: parent.SpanID,
+	}
+}
+
+type logSpan struct {
+	log      func(...interface{}) error
+	start    time.Time
+	name     string
+	tc       TraceContext
+	parentID [8]byte
+	attrs    []interface{}
+	err      error
+}
+
+func (s *logSpan) SetAttribute(key string, value interface{}) {
+	s.attrs = append(s.attrs, key, value)
+}
+func (s *logSpan) RecordError(err error) { s.err = err }
+func (s *logSpan) End() {
+	if s.log == nil {
+		return
+	}
+	keyvals := append(make([]interface{}, 0, 12+len(s.attrs)),
+		"span", s.name, "traceID", s.tc.TraceIDString(),
+		"spanID", hex.EncodeToString(s.tc.SpanID[:]), "parentID", hex.EncodeToString(s.parentID[:]),
+		"dur", time.Since(s.start))
+	if s.err != nil {
+		keyvals = append(keyvals, "error", s.err)
+	}
+	s.log(append(keyvals, s.attrs...)...)
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oracall
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	for tN, tC := range []struct {
+		In      string
+		WantErr bool
+	}{
+		{In: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		{In: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"},
+		{In: "00-00000000000000000000000000000000-00f067aa0ba902b7-01", WantErr: true},
+		{In: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", WantErr: true},
+		{In: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", WantErr: true},
+		{In: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", WantErr: true},
+		{In: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7", WantErr: true},
+		{In: "", WantErr: true},
+	} {
+		tc, err := ParseTraceParent(tC.In)
+		if err != nil {
+			if !tC.WantErr {
+				t.Errorf("%d. got error %+v for %q", tN, err, tC.In)
+			}
+			continue
+		}
+		if tC.WantErr {
+			t.Errorf("%d. wanted error for %q", tN, tC.In)
+			continue
+		}
+		if got := tc.String(); got != tC.In {
+			t.Errorf("%d. got %q, wanted %q", tN, got, tC.In)
+		}
+	}
+}
+
+func TestLogTracer(t *testing.T) {
+	var logged []interface{}
+	tracer := LogTracer{Log: func(keyvals ...interface{}) error { logged = keyvals; return nil }}
+	parent, _ := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := ContextWithTracer(ContextWithTraceContext(context.Background(), parent), tracer)
+
+	spanCtx, endSpan := StartSpan(ctx, nil, "test")
+	child, ok := ContextGetTraceContext(spanCtx)
+	if !ok {
+		t.Fatal("no trace context in the span's context")
+	}
+	if child.TraceID != parent.TraceID {
+		t.Errorf("trace ID changed: got %x, wanted %x", child.TraceID, parent.TraceID)
+	}
+	if child.SpanID == parent.SpanID {
+		t.Error("span ID is the same as the parent's")
+	}
+	endSpan(nil)
+	if len(logged) < 4 || logged[1] != "test" || logged[3] != parent.TraceIDString() {
+		t.Errorf("got %v", logged)
+	}
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oracall
+
+import (
+	"context"
+	"database/sql"
+
+	errors "golang.org/x/xerrors"
+)
+
+const txCtxKey = ctxKey("tx")
+
+// ContextWithTx returns a context with the transaction, which spans several calls.
+//
+// The generated calls execute in this transaction, and leave it open:
+// committing or rolling it back is the responsibility of its owner.
+func ContextWithTx(ctx context.Context, tx *sql.Tx) context.Context {
+	return context.WithValue(ctx, txCtxKey, tx)
+}
+
+// ContextGetTx returns the transaction of the context, or nil.
+func ContextGetTx(ctx context.Context) *sql.Tx {
+	tx, _ := ctx.Value(txCtxKey).(*sql.Tx)
+	return tx
+}
+
+// ErrNoSession is returned by the session-bound calls without a session in the context.
+var ErrNoSession = errors.New("no session")
+
+const connCtxKey = ctxKey("conn")
+
+// ContextWithConn returns a context with the dedicated connection (session) of the client,
+// to be used by the session-bound calls (see the "session-bound" annotation).
+func ContextWithConn(ctx context.Context, conn *sql.Conn) context.Context {
+	return context.WithValue(ctx, connCtxKey, conn)
+}
+
+// ContextGetConn returns the connection of the context, or nil.
+func ContextGetConn(ctx context.Context) *sql.Conn {
+	conn, _ := ctx.Value(connCtxKey).(*sql.Conn)
+	return conn
+}
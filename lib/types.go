@@ -37,12 +37,15 @@ func NewPlsType(ora string) PlsType {
 
 // FromOra retrieves the value of the argument with arg type, from src variable to dst variable.
 func (arg PlsType) FromOra(dst, src, varName string) string {
-	if Gogo {
+	return gogoOr(arg.fromOra(dst, src, varName, true), arg.fromOra(dst, src, varName, false))
+}
+
+func (arg PlsType) fromOra(dst, src, varName string, gogo bool) string {
+	if gogo {
 		if varName != "" {
 			switch arg.ora {
 			case "DATE", "TIMESTAMP":
-				return fmt.Sprintf("%s = &custom.DateTime{Time:%s}", dst, varName)
-				//return fmt.Sprintf("%s = &custom.DateTime{Time:%s}", dst, varName)
+				return fmt.Sprintf("%s = %s", dst, simpleConvs[arg.ora].genFromBindOf(varName, gogo))
 			}
 		}
 	}
@@ -57,48 +60,60 @@ func (arg PlsType) FromOra(dst, src, varName string) string {
 			return fmt.Sprintf("{var b []byte; if %s.Reader != nil {b, err = ioutil.ReadAll(%s); %s = string(b)}}", varName, varName, dst)
 		}
 		return fmt.Sprintf("%s = godror.Lob{IsClob:true, Reader:strings.NewReader(%s)}", dst, src)
-	case "DATE", "TIMESTAMP":
-		return fmt.Sprintf("%s = (%s)", dst, src)
-	case "PLS_INTEGER":
-		return fmt.Sprintf("%s = int32(%s)", dst, src)
-	case "NUMBER":
-		return fmt.Sprintf("%s = string(%s)", dst, src)
 	case "":
 		panic(fmt.Sprintf("empty \"ora\" type: %#v", arg))
 	}
+	if c, ok := simpleConvs[arg.ora]; ok {
+		return fmt.Sprintf("%s = %s", dst, c.genFromBindOf(src, gogo))
+	}
 	return fmt.Sprintf("%s = %s // %s fromOra", dst, src, arg.ora)
 }
 
+// GetOra returns the value of the argument with arg type, from src variable (or varName, if not empty).
 func (arg PlsType) GetOra(src, varName string) string {
-	if Gogo {
-		switch arg.ora {
-		case "DATE":
-			if varName != "" {
+	return gogoOr(arg.getOra(src, varName, true), arg.getOra(src, varName, false))
+}
+
+func (arg PlsType) getOra(src, varName string, gogo bool) string {
+	switch arg.ora {
+	case "DATE":
+		if varName != "" {
+			if gogo {
 				return fmt.Sprintf("%s.Format(time.RFC3339)", varName)
 			}
+		} else if gogo {
 			return fmt.Sprintf("custom.AsDate(%s)", src)
+		} else {
+			return fmt.Sprintf("{{.Conv}}AsTime(%s)", src)
 		}
-	}
-	switch arg.ora {
 	case "NUMBER":
 		if varName != "" {
 			//return fmt.Sprintf("string(%s.(godror.Number))", varName)
-			return fmt.Sprintf("custom.AsString(%s)", varName)
+			return fmt.Sprintf("{{.Conv}}AsString(%s)", varName)
 		}
 		//return fmt.Sprintf("string(%s.(godror.Number))", src)
-		return fmt.Sprintf("custom.AsString(%s)", src)
+		return fmt.Sprintf("{{.Conv}}AsString(%s)", src)
 	}
 	return src
 }
 
 // ToOra adds the value of the argument with arg type, from src variable to dst variable.
 func (arg PlsType) ToOra(dst, src string, dir direction) (expr string, variable string) {
+	gExpr, gVariable := arg.toOra(dst, src, dir, true)
+	expr, variable = arg.toOra(dst, src, dir, false)
+	if gVariable != variable {
+		panic(fmt.Sprintf("%s: variable %q of the Gogo structs, %q of the plain ones", arg.ora, gVariable, variable))
+	}
+	return gogoOr(gExpr, expr), variable
+}
+
+func (arg PlsType) toOra(dst, src string, dir direction, gogo bool) (expr string, variable string) {
 	dstVar := mkVarName(dst)
 	var inTrue string
 	if dir.IsInput() {
 		inTrue = ",In:true"
 	}
-	if Gogo {
+	if gogo {
 		switch arg.ora {
 		case "DATE":
 			np := strings.TrimPrefix(src, "&")
@@ -113,17 +128,13 @@ func (arg PlsType) ToOra(dst, src string, dir direction) (expr string, variable
 					),
 					""
 			}
-			return fmt.Sprintf(`%s = custom.AsDate(%s).Time // toOra D`, dst, np), ""
+			return fmt.Sprintf(`%s = %s // toOra D`, dst, simpleConvs[arg.ora].genToBindOf(np, gogo)), ""
 		}
 	}
 	switch arg.ora {
-	case "PLS_INTEGER":
-		if src[0] != '&' {
-			return fmt.Sprintf("var %s sql.NullInt64; if %s != 0 { %s.Int64, %s.Valid = int64(%s), true }; %s = int32(%s.Int64)", dstVar, src, dstVar, dstVar, src, dst, dstVar), dstVar
-		}
 	case "NUMBER":
 		if src[0] != '&' {
-			return fmt.Sprintf("%s := godror.Number(%s); %s = %s", dstVar, src, dst, dstVar), dstVar
+			return fmt.Sprintf("%s := %s; %s = %s", dstVar, numberConv.genToBind(src), dst, dstVar), dstVar
 		}
 	case "CLOB":
 		if dir.IsOutput() {
@@ -141,6 +152,15 @@ func (arg PlsType) ToOra(dst, src string, dir direction) (expr string, variable
 	return fmt.Sprintf("%s = %s // %s", dst, src, arg.ora), ""
 }
 
+// gogoOr returns the generated code for the Gogo structs, and for the plain ones
+// (the gRPC server without Gogo, and the plain Go API - see apiNames.gogo), as a call template.
+func gogoOr(gogo, plain string) string {
+	if !Gogo || gogo == plain {
+		return plain
+	}
+	return "{{if .Gogo}}" + gogo + "{{else}}" + plain + "{{end}}"
+}
+
 func mkVarName(dst string) string {
 	h := fnv.New64()
 	io.WriteString(h, dst)
@@ -24,8 +24,11 @@ import (
 	"io/ioutil"
 	"os"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"text/template"
 	"time"
 	"unicode"
 
@@ -35,28 +38,12 @@ import (
 var ErrMissingTableOf = errors.New("missing TableOf info")
 var ErrInvalidArgument = errors.New("invalid argument")
 
-func SaveFunctions(dst io.Writer, functions []Function, pkg, pbImport string, saveStructs bool) error {
-	var err error
-	w := errWriter{Writer: dst, err: &err}
-
-	if pkg != "" {
-		if pbImport != "" {
-			pbImport = `pb "` + pbImport + `"`
-		}
-		var lastDDL time.Time
-		for _, f := range functions {
-			if f.LastDDL.After(lastDDL) {
-				lastDDL = f.LastDDL
-			}
-		}
-		if lastDDL.IsZero() {
-			lastDDL = time.Now()
-		}
-		io.WriteString(w,
-			// https://github.com/golang/go/issues/13560#issuecomment-288457920
-			`// Code generated by oracall, DO NOT EDIT.
+// serverHeader is the header of the generated server (or plain Go API), with the type of api.Server.
+var serverHeader = template.Must(template.New("header").Parse(
+	// https://github.com/golang/go/issues/13560#issuecomment-288457920
+	`// Code generated by oracall, DO NOT EDIT.
 
-package `+pkg+`
+package {{.Package}}
 
 import (
 	"context"
@@ -77,21 +64,23 @@ import (
 	errors "golang.org/x/xerrors"
 
     godror "github.com/godror/godror" // Oracle
-	"github.com/tgulacsi/oracall/custom"	// custom.AsDate
-	oracall "github.com/tgulacsi/oracall/lib"	// ErrInvalidArgument
-	`+pbImport+`
-)
+{{if .Pb}}	"github.com/tgulacsi/oracall/custom"	// custom.AsDate
+{{else}}	"github.com/tgulacsi/oracall/custom/conv"	// conv.AsTime
+{{end}}	oracall "github.com/tgulacsi/oracall/lib"	// ErrInvalidArgument
+{{range .Imports}}	{{.}}
+{{end}})
 
 var DebugLevel = uint(0)
 
-const LastDDL = "`+lastDDL.Format(time.RFC3339)+`"
+const LastDDL = "{{.LastDDL}}"
 
 // against "unused import" error
 var _ json.Marshaler
 var _ = io.EOF
 var _ context.Context
-var _ = custom.AsDate
-var _ strconv.NumError
+{{if .Pb}}var _ = custom.AsDate
+{{else}}var _ = conv.AsTime
+{{end}}var _ strconv.NumError
 var _ time.Time
 var _ strings.Reader
 var _ xml.Name
@@ -111,30 +100,152 @@ type iterator struct {
 	Iterate func() error
 }
 
-type oracallServer struct {
+// {{.Server}} calls the PL/SQL functions.
+type {{.Server}} struct {
 	db *sql.DB
 	DBLog func(context.Context, *sql.DB, string, interface{}) error
+	// Tracer starts the spans of the calls; if nil, the Tracer of the context is used.
+	Tracer oracall.Tracer
+	// SetIdentity is called in the transaction of the call, before the call,
+	// with the oracall.Identity of the context, or the empty Identity - see oracall.SetIdentityPlsql.
+	SetIdentity func(context.Context, *sql.Tx, oracall.Identity) error
+
+	beforeCalls []oracall.BeforeCall
+	afterCalls  []oracall.AfterCall
 }
 
-func NewServer(db *sql.DB, dbLog func(context.Context, *sql.DB, string, interface{}) error) *oracallServer {
-	return &oracallServer{db: db, DBLog: dbLog}
+// ServerOption is an option of {{.New}}.
+type ServerOption func(*{{.Server}})
+
+// WithBeforeCall adds a hook called before each call.
+func WithBeforeCall(f oracall.BeforeCall) ServerOption {
+	return func(s *{{.Server}}) { s.beforeCalls = append(s.beforeCalls, f) }
 }
 
-`)
+// WithAfterCall adds a hook called after each call, after committing (or rolling back) its transaction.
+func WithAfterCall(f oracall.AfterCall) ServerOption {
+	return func(s *{{.Server}}) { s.afterCalls = append(s.afterCalls, f) }
+}
+
+// WithTracer sets the Tracer of the server.
+func WithTracer(tracer oracall.Tracer) ServerOption {
+	return func(s *{{.Server}}) { s.Tracer = tracer }
+}
+
+// WithSetIdentity sets the SetIdentity hook of the server.
+func WithSetIdentity(f func(context.Context, *sql.Tx, oracall.Identity) error) ServerOption {
+	return func(s *{{.Server}}) { s.SetIdentity = f }
+}
+
+// {{.New}} returns a new {{.Server}} calling the functions in db, and dbLog (if not nil) with each input.
+func {{.New}}(db *sql.DB, dbLog func(context.Context, *sql.DB, string, interface{}) error, options ...ServerOption) *{{.Server}} {
+	s := &{{.Server}}{db: db, DBLog: dbLog}
+	for _, o := range options {
+		o(s)
+	}
+	return s
+}
+
+// beginTx returns the transaction of the context (see oracall.ContextWithTx),
+// or begins a new transaction
+// - on the session of the context (see oracall.ContextWithConn) for the session-bound calls,
+// - or as the oracall.Identity of the context:
+// in a proxy authenticated session if the Identity requests it,
+// and calls SetIdentity with the Identity of the context (the empty one if it has none,
+// to clear the previous user's identity from the session - see oracall.ApplyIdentity).
+//
+// The returned finish function commits (or rolls back) the transaction,
+// only if it has been begun here - and rolls back instead of committing in dry-run mode.
+func (s *{{.Server}}) beginTx(ctx context.Context, sessionBound bool) (*sql.Tx, func(commit bool) error, error) {
+	if tx := oracall.ContextGetTx(ctx); tx != nil {
+		if sessionBound {
+			return nil, nil, errors.Errorf("session-bound call in a shared transaction: %w", oracall.ErrInvalidArgument)
+		}
+		return tx, func(bool) error { return nil }, nil
+	}
+	var tx *sql.Tx
+	var err error
+	if sessionBound {
+		conn := oracall.ContextGetConn(ctx)
+		if conn == nil {
+			return nil, nil, oracall.ErrNoSession
+		}
+		tx, err = conn.BeginTx(ctx, nil)
+	} else {
+		tx, err = s.db.BeginTx(oracall.ContextWithProxyUser(ctx), nil)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	finish := func(commit bool) error {
+		if commit && !oracall.IsDryRun(ctx) {
+			return tx.Commit()
+		}
+		err := tx.Rollback()
+		if commit && err == nil {
+			oracall.MarkRolledBack(ctx)
+		}
+		return err
+	}
+	if err = oracall.ApplyIdentity(ctx, tx, s.SetIdentity); err != nil {
+		tx.Rollback()
+		return nil, nil, err
+	}
+	return tx, finish, nil
+}
+
+`))
+
+func SaveFunctions(dst io.Writer, functions []Function, pkg, pbImport string, saveStructs bool) error {
+	imports := []string{`"github.com/tgulacsi/oracall/oragrpc"`}
+	if pbImport != "" {
+		imports = append(imports, `pb "`+pbImport+`"`)
+	}
+	return saveFunctions(dst, functions, pkg, imports, saveStructs, grpcAPI)
+}
+
+// saveFunctions writes the functions as methods of api.Server - with the header of package pkg, importing imports, too, if pkg is not empty.
+func saveFunctions(dst io.Writer, functions []Function, pkg string, imports []string, saveStructs bool, api apiNames) error {
+	var err error
+	w := errWriter{Writer: dst, err: &err}
+
+	if pkg != "" {
+		var lastDDL time.Time
+		for _, f := range functions {
+			if f.LastDDL.After(lastDDL) {
+				lastDDL = f.LastDDL
+			}
+		}
+		if lastDDL.IsZero() {
+			lastDDL = time.Now()
+		}
+		if err := serverHeader.Execute(w, struct {
+			apiNames
+			Package, LastDDL string
+			Imports          []string
+		}{apiNames: api, Package: pkg, LastDDL: lastDDL.Format(time.RFC3339), Imports: imports}); err != nil {
+			return err
+		}
 	}
 	types := make(map[string]string, 16)
 	inits := make([]string, 0, len(functions))
+	saved := make([]Function, 0, len(functions))
 	var b []byte
 
 FunLoop:
 	for _, fun := range functions {
-		structW := io.Writer(w)
-		if !saveStructs {
-			structW = ioutil.Discard
+		// the plain structs are checked even if not saved, to skip the functions missing type info
+		plainW, plainTypes := io.Writer(w), types
+		if !saveStructs || api != plainAPI {
+			plainW, plainTypes = ioutil.Discard, make(map[string]string)
 		}
 		var checkName string
 		for _, dir := range []bool{false, true} {
-			if err = fun.SaveStruct(structW, dir); err != nil {
+			err = fun.savePlainStruct(plainW, dir, plainTypes)
+			if err == nil && saveStructs && api != plainAPI {
+				err = fun.SaveStruct(w, dir)
+			}
+			if err != nil {
 				if SkipMissingTableOf && (errors.Is(err, ErrMissingTableOf) || errors.Is(err, UnknownSimpleType)) {
 					Log("msg", "SKIP function, missing TableOf info", "function", fun.Name(), "error", err)
 					continue FunLoop
@@ -142,7 +253,16 @@ FunLoop:
 				return err
 			}
 		}
-		plsBlock, callFun := fun.PlsqlBlock(checkName)
+		if checkName, err = fun.writeChecks(w, api.Pb); err != nil {
+			return err
+		}
+		plsBlock, callFun := fun.plsqlBlock(checkName, api)
+		for _, out := range []bool{false, true} {
+			if paths := fun.sensitivePaths(out); len(paths) != 0 {
+				inits = append(inits, fmt.Sprintf("oracall.RegisterSensitive(%q, %s)",
+					CamelCase(fun.getStructName(out, false)), quoteJoin(paths)))
+			}
+		}
 		fmt.Fprintf(w, "\nconst %s = `", fun.getPlsqlConstName())
 		io.WriteString(w, plsBlock)
 		io.WriteString(w, "`\n\n")
@@ -154,15 +274,24 @@ FunLoop:
 			return fmt.Errorf("error saving function %s: %s", fun.Name(), err)
 		}
 		w.Write(b)
+		saved = append(saved, fun)
 	}
-	for tn, text := range types {
-		if tn[0] == '+' { // REF CURSOR skip
-			continue
-		}
-		if b, err = format.Source([]byte(text)); err != nil {
-			return fmt.Errorf("error saving type %s: %s\n%s", tn, err, text)
+	if err = writeTypes(w, types); err != nil {
+		return err
+	}
+	if pkg != "" {
+		if api == plainAPI {
+			if err = saveStreams(w, saved); err != nil {
+				return err
+			}
+		} else {
+			if err = saveMethodDescs(w, saved); err != nil {
+				return err
+			}
+			if err = saveFakes(w, saved); err != nil {
+				return err
+			}
 		}
-		w.Write(b)
 	}
 
 	io.WriteString(w, "\nfunc init() {\n")
@@ -173,23 +302,27 @@ FunLoop:
 	_, err = io.WriteString(w, "}\n")
 	return err
 }
+
+// quoteJoin returns the quoted strings, separated by commas.
+func quoteJoin(ss []string) string {
+	qq := make([]string, len(ss))
+	for i, s := range ss {
+		qq[i] = strconv.Quote(s)
+	}
+	return strings.Join(qq, ", ")
+}
+
+// SaveFunctionTests writes the TestCalls test of the functions, replaying the requests logged by orasrv.
 func SaveFunctionTests(dst io.Writer, functions []Function, pkg, pbImport string, saveStructs bool) error {
 	var err error
-	w := errWriter{Writer: dst, err: &err}
+	buf := Buffers.Get()
+	defer Buffers.Put(buf)
+	w := errWriter{Writer: buf, err: &err}
 
 	if pkg != "" {
 		if pbImport != "" {
 			pbImport = `pb "` + pbImport + `"`
 		}
-		var lastDDL time.Time
-		for _, f := range functions {
-			if f.LastDDL.After(lastDDL) {
-				lastDDL = f.LastDDL
-			}
-		}
-		if lastDDL.IsZero() {
-			lastDDL = time.Now()
-		}
 		io.WriteString(w,
 			// https://github.com/golang/go/issues/13560#issuecomment-288457920
 			`// Code generated by oracall, DO NOT EDIT.
@@ -200,31 +333,37 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
-    "time"    
-	"os"
-	"bytes"
 	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
 	"sync"
 	"testing"
+	"time"
 
 	errors "golang.org/x/xerrors"
 
-	"github.com/go-logfmt/logfmt"
-
 	_ "github.com/godror/godror" // Oracle
+	oracall "github.com/tgulacsi/oracall/lib"
+	"github.com/tgulacsi/oracall/oragrpc"
 	`+pbImport+`
 )
 
+var _ oragrpc.SendStream // against "unused import" error
+
 var (
 	connectOnce sync.Once
 	flagConnect = flag.String("connect", "", "database to connect to")
-	testDB *sql.DB
-	testServer *oracallServer
+	flagUpdate  = flag.Bool("update", false, "record the outputs into the golden files")
+	flagGolden  = flag.String("golden", "testdata", "directory of the golden files")
+	flagIgnore  = flag.String("ignore", "timestamps", "comma-separated list of the fields ignored when comparing with the golden files (timestamps: all the timestamps)")
+	testDB      *sql.DB
+	testServer  *oracallServer
 )
 
 func testSetup(t *testing.T) *oracallServer {
 	connectOnce.Do(func() {
-		flag.Parse() 
+		flag.Parse()
 		var err error
 		if testDB, err = sql.Open("godror", *flagConnect); err != nil {
 			panic(errors.Errorf("%s: %s", *flagConnect, err))
@@ -234,42 +373,43 @@ func testSetup(t *testing.T) *oracallServer {
 	return testServer
 }
 
+// TestCalls replays the requests logged by orasrv (read from stdin),
+// comparing the results with the golden files - or recording them with -update.
 func TestCalls(t *testing.T) {
 	t.Log("TestCalls reads logfmt-formatted records from stdin")
-	dec := logfmt.NewDecoder(os.Stdin)
-	for dec.ScanRecord() {
-		var fn, jsonText string
-		for dec.ScanKeyval() {
-			k := dec.Key()
-			if bytes.Equal(k, []byte("REQ")) {
-				v := dec.Value()
-				if i := bytes.LastIndexByte(v, '/'); i >= 0 {
-					v = v[i+1:]
-				}
-				fn = string(v)
-			} else if bytes.Equal(k, []byte("req")) {
-				jsonText = string(dec.Value())
-			}
-		}
-		if err := dec.Err(); err != nil {
-			t.Fatal(err)
-		}
+	rules := oracall.ParseIgnoreRules(*flagIgnore)
+	seen := make(map[string]int)
+	err := oracall.ReadReplayLog(os.Stdin, func(rec oracall.ReplayRecord) error {
+		fn := rec.Name()
 		tf := TestFunctions[fn]
 		if tf == nil {
 			t.Errorf("cannot find %s", fn)
-			continue
+			return nil
 		}
-		t.Run(fn, func(t *testing.T) {
-			TestFunctions[fn](t, []byte(jsonText))
+		seen[fn]++
+		name := fmt.Sprintf("%s-%03d", fn, seen[fn])
+		t.Run(name, func(t *testing.T) {
+			if rec.Redacted() {
+				t.Skip("the input contains redacted values")
+			}
+			output, err := tf(t, rec.Input)
+			result := oracall.NewReplayResult(output, err)
+			if err := oracall.Golden(filepath.Join(*flagGolden, name+".json"), result, *flagUpdate, rules); err != nil {
+				t.Error(err)
+			}
 		})
-	}
-	if err := dec.Err(); err != nil {
+		return nil
+	})
+	if err != nil {
 		t.Fatal(err)
 	}
+	if len(seen) == 0 {
+		t.Skip("no logged request read from stdin - orasrv logs the inputs at debug level, or with LogConfig.LogRequests")
+	}
 }
 `)
-}
-	FN := func(f Function) string { 
+	}
+	FN := func(f Function) string {
 		fn := f.name
 		if f.alias != "" {
 			fn = f.alias
@@ -283,7 +423,7 @@ func TestCalls(t *testing.T) {
 		fn := FN(f)
 
 		fmt.Fprintf(w, `
-func test%s(t *testing.T, jsonText []byte) {
+func test%s(t *testing.T, jsonText []byte) (interface{}, error) {
 	srv := testSetup(t)
 	var input pb.%s
 	if err := json.Unmarshal(jsonText, &input); err != nil {
@@ -291,34 +431,49 @@ func test%s(t *testing.T, jsonText []byte) {
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
 	defer cancel()
-	output, err := srv.%s(ctx, &input)
-	t.Log(output)
-	if err != nil {
-		t.Error(err)
-	}
-}
-
 `,
-fn,
-structName,
-fn,
-)
-funNames = append(funNames, fn)
+			fn,
+			structName,
+		)
+		if !f.HasCursorOut() {
+			fmt.Fprintf(w, `	return srv.%s(ctx, &input)
 }
+`, fn)
+		} else {
+			fmt.Fprintf(w, `	var outputs []json.RawMessage
+	err := srv.%s(&input, sendStream%s{oragrpc.SendStream{Ctx: ctx, SendFunc: func(output interface{}) error {
+		b, err := json.Marshal(output)
+		outputs = append(outputs, b)
+		return err
+	}}})
+	return outputs, err
+}
+`, fn, fn)
+		}
+		funNames = append(funNames, fn)
+	}
 	io.WriteString(w, `
-var TestFunctions = map[string]func(t *testing.T, jsonText []byte) {
-	`)
+var TestFunctions = map[string]func(t *testing.T, jsonText []byte) (interface{}, error){
+`)
 	Pkg := CamelCase(pkg)
 	for _, fn := range funNames {
 		fmt.Fprintf(w, "\t"+`"%s": test%s,`+"\n", fn, fn)
 		fmt.Fprintf(w, "\t"+`"%s_%s": test%s,`+"\n", Pkg, fn, fn)
 	}
-	io.WriteString(w, `
-}
-`)
-return nil
-}
+	io.WriteString(w, "}\n")
+	if err != nil {
+		return err
+	}
 
+	b := buf.Bytes()
+	if pkg != "" {
+		if b, err = format.Source(b); err != nil {
+			return errors.Errorf("format function tests: %w\n%s", err, buf.String())
+		}
+	}
+	_, err = dst.Write(b)
+	return err
+}
 
 func (f Function) getPlsqlConstName() string {
 	nm := f.name
@@ -356,7 +511,7 @@ func (f Function) SaveStruct(dst io.Writer, out bool) error {
 	)
 	args := make([]Argument, 0, len(f.Args))
 	for _, arg := range f.Args {
-		if arg.Direction&dirmap > 0 {
+		if arg.Direction&dirmap > 0 && arg.Inject == "" {
 			args = append(args, arg)
 		}
 	}
@@ -420,33 +575,237 @@ func (f Function) SaveStruct(dst io.Writer, out bool) error {
 	return err
 }
 
-func (f Function) GenChecks(w io.Writer) (string, error) {
+// savePlainStruct writes the struct of the input (or the output) of the plain Go API into dst,
+// with the same fields as the one generated from the .proto file,
+// and the structs of the records used by it into types, by name.
+func (f Function) savePlainStruct(dst io.Writer, out bool, types map[string]string) error {
+	dirmap, dirname := DIR_IN, "input"
+	if out {
+		dirmap, dirname = DIR_OUT, "output"
+	}
+	var (
+		err                    error
+		aName, structName, got string
+	)
 	args := make([]Argument, 0, len(f.Args))
 	for _, arg := range f.Args {
-		if arg.IsInput() {
+		if arg.Direction&dirmap > 0 && arg.Inject == "" {
 			args = append(args, arg)
 		}
 	}
-	checks := make([]string, 0, len(args)+1)
+	// return variable for function out structs
+	if out && f.Returns != nil {
+		args = append(args, *f.Returns)
+	}
+
+	structName = CamelCase(f.getStructName(out, false))
+	buf := Buffers.Get()
+	defer Buffers.Put(buf)
+	w := errWriter{Writer: buf, err: &err}
+
+	fmt.Fprintf(w, `
+	// %s %s
+	type %s struct {
+		XMLName xml.Name `+"`json:\"-\" xml:\"%s\"`"+`
+		`, structName, f.Name()+" "+dirname, structName, strings.ToLower(structName[:1])+structName[1:],
+	)
+
 	for _, arg := range args {
-		checks = genChecks(checks, arg, "s", false)
+		if arg.Flavor == FLAVOR_TABLE && arg.TableOf == nil {
+			return errors.Errorf("no table of data for %s.%s (%v): %w", f.Name(), arg, arg, ErrMissingTableOf)
+		}
+		aName = CamelCase(replHidden(arg.Name))
+		var rec string
+		if got, rec, err = arg.plainType(true); err != nil {
+			return errors.Errorf("%s: %w", arg.Name, err)
+		}
+		if rec != "" {
+			if err = arg.saveRecordType(types, rec); err != nil {
+				return errors.Errorf("%s: %w", arg.Name, err)
+			}
+		}
+		lName := strings.ToLower(replHidden(arg.Name))
+		io.WriteString(w, "\t"+aName+" "+got+
+			"\t`json:\""+lName+",omitempty\""+
+			" xml:\""+lName+",omitempty\"`\n")
+	}
+	io.WriteString(w, "}\n")
+
+	if !out {
+		fmt.Fprintf(w, `func (s *%s) FromJSON(data []byte) error {
+			err := json.Unmarshal(data, &s)
+			if DebugLevel > 0 {
+				Log("msg", "unmarshal", "data", data, "into", s, "error", err)
+			}
+			return err
+}`, structName)
+	}
+	if err != nil {
+		return err
+	}
+
+	var b []byte
+	if b, err = format.Source(buf.Bytes()); err != nil {
+		return errors.Errorf("save struct %q (%s): %w", structName, buf.String(), err)
+	}
+	_, err = dst.Write(b)
+
+	return err
+}
+
+// plainType returns the Go type of the argument's field in the plain structs
+// - the same as protoc-gen-gogo generates from the field written by protoWriteMessageTyp,
+// but with time.Time dates if plain (for the plain Go API) -,
+// and the name of the record's struct, if the field is (a table of) records.
+func (arg Argument) plainType(plain bool) (typ, rec string, err error) {
+	got, err := arg.goType(false)
+	if err != nil {
+		return "", "", err
+	}
+	repeated := arg.Flavor == FLAVOR_TABLE
+	got = strings.TrimPrefix(got, "*")
+	if strings.HasPrefix(got, "[]") {
+		repeated = true
+		got = got[2:]
+	}
+	got = strings.TrimPrefix(got, "*")
+	if got == "" {
+		got = mkRecTypName(arg.Name)
+	}
+	pTyp, _ := protoType(got, arg.Name, arg.AbsType)
+	switch {
+	case arg.Flavor == FLAVOR_RECORD || arg.Flavor == FLAVOR_TABLE && arg.TableOf.Flavor != FLAVOR_SIMPLE:
+		rec = CamelCase(pTyp)
+		typ = "*" + rec
+	case pTyp == "google.protobuf.Timestamp" && plain:
+		typ = "time.Time"
+	case pTyp == "google.protobuf.Timestamp":
+		typ = "*custom.DateTime"
+	case pTyp == "sint32":
+		typ = "int32"
+	case pTyp == "double":
+		typ = "float64"
+	case pTyp == "bytes":
+		typ = "[]byte"
+	default:
+		typ = pTyp
+	}
+	if repeated {
+		typ = "[]" + typ
+	}
+	return typ, rec, nil
+}
+
+// saveRecordType adds the struct of the record (or table of records) argument, named name,
+// and the structs of its records, to types.
+func (arg Argument) saveRecordType(types map[string]string, name string) error {
+	if _, ok := types[name]; ok {
+		return nil
+	}
+	types[name] = ""
+	subArgs := make([]Argument, 0, 16)
+	if arg.TableOf == nil {
+		for _, v := range arg.RecordOf {
+			subArgs = append(subArgs, *v.Argument)
+		}
+	} else if arg.TableOf.RecordOf == nil {
+		subArgs = append(subArgs, *arg.TableOf)
+	} else {
+		for _, v := range arg.TableOf.RecordOf {
+			subArgs = append(subArgs, *v.Argument)
+		}
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "\n// %s is the %s record.\ntype %s struct {\n", name, arg.TypeName, name)
+	for _, sub := range subArgs {
+		if sub.Flavor == FLAVOR_TABLE && sub.TableOf == nil {
+			return errors.Errorf("no table of data for %s.%s (%v): %w", name, sub, sub, ErrMissingTableOf)
+		}
+		got, rec, err := sub.plainType(true)
+		if err != nil {
+			return errors.Errorf("%s.%s: %w", name, sub.Name, err)
+		}
+		if rec != "" {
+			if err = sub.saveRecordType(types, rec); err != nil {
+				return err
+			}
+		}
+		lName := strings.ToLower(replHidden(sub.Name))
+		fmt.Fprintf(&buf, "\t%s %s `json:\"%s,omitempty\" xml:\"%s,omitempty\"`\n",
+			CamelCase(replHidden(sub.Name)), got, lName, lName)
+	}
+	buf.WriteString("}\n")
+	types[name] = buf.String()
+	return nil
+}
+
+// writeTypes writes the types, sorted by name.
+func writeTypes(w io.Writer, types map[string]string) error {
+	names := make([]string, 0, len(types))
+	for tn := range types {
+		if tn[0] == '+' || types[tn] == "" { // REF CURSOR skip, or unfinished
+			continue
+		}
+		names = append(names, tn)
+	}
+	sort.Strings(names)
+	for _, tn := range names {
+		b, err := format.Source([]byte(types[tn]))
+		if err != nil {
+			return fmt.Errorf("error saving type %s: %s\n%s", tn, err, types[tn])
+		}
+		if _, err = w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GenChecks writes the Check<Name>_Input function, checking the input of the function,
+// and returns its name - or "" if there's nothing to check.
+//
+// The checks return a *FieldError (an ErrInvalidArgument) with the path of the field,
+// for the strings longer than accepted (counted in characters or bytes, as Oracle does - see CharLen and EncodedLen), the numbers with too many digits, the dates out of range,
+// the tables longer than the max-table-size, and the missing required (annotated) arguments.
+func (f Function) GenChecks(w io.Writer) (string, error) {
+	return f.writeChecks(w, grpcAPI.Pb)
+}
+
+// writeChecks writes the checks of GenChecks, of the input struct qualified with pb.
+func (f Function) writeChecks(w io.Writer, pb string) (string, error) {
+	tableSize := f.maxTableSize
+	if tableSize <= 0 {
+		tableSize = MaxTableSize
+	}
+	checks := make([]string, 0, len(f.Args)+1)
+	for _, arg := range f.Args {
+		if !arg.IsInput() || arg.Inject != "" {
+			continue
+		}
+		var err error
+		if checks, err = genChecks(checks, arg, "s."+CamelCase(arg.Name), checkPath{}.field(arg.Name), tableSize, pb == ""); err != nil {
+			return "", errors.Errorf("%s: %w", f.Name(), err)
+		}
 	}
 	if len(checks) == 0 {
 		return "", nil
 	}
-	structName := CamelCase(strings.SplitN(f.getStructName(false, true), "__", 2)[1])
+	structName := CamelCase(f.getStructName(false, false))
 	buf := Buffers.Get()
 	defer Buffers.Put(buf)
 	nm := "Check" + structName
 	fmt.Fprintf(buf, `
-// %s checks input bounds for pb.%s
-func %s(s *pb.%s) error {
+// %s checks the input bounds of %s.
+func %s(s *%s%s) error {
+	if s == nil {
+		return nil
+	}
 	`,
 		nm, structName,
-		nm, structName,
+		nm, pb, structName,
 	)
 	for _, line := range checks {
-		fmt.Fprintf(buf, line+"\n")
+		io.WriteString(buf, line+"\n")
 	}
 	if _, err := io.WriteString(buf, "\n\treturn nil\n}\n"); err != nil {
 		return "", err
@@ -459,115 +818,139 @@ func %s(s *pb.%s) error {
 	return nm, err
 }
 
-func genChecks(checks []string, arg Argument, base string, parentIsTable bool) []string {
-	aName := (CamelCase(arg.Name))
-	//aName := capitalize(replHidden(arg.Name))
-	got, err := arg.goType(parentIsTable || arg.Flavor == FLAVOR_TABLE)
-	if err != nil {
-		panic(err)
+// checkPath is the path of a checked field, as reported in the FieldError:
+// the format of the path (with a %d for each table index), and the index variables.
+type checkPath struct {
+	format  string
+	indexes []string
+}
+
+// field returns the path of the named field (or record field).
+func (p checkPath) field(name string) checkPath {
+	name = strings.ToLower(replHidden(name))
+	if p.format != "" {
+		name = p.format + "." + name
 	}
-	var name string
-	if aName == "" {
-		name = base
-	} else {
-		name = base + "." + aName
-	}
-	switch arg.Flavor {
-	case FLAVOR_SIMPLE:
-		switch got {
-		case "string":
-			checks = append(checks,
-				fmt.Sprintf(`if len(%s) > %d {
-		return errors.Errorf("%s is longer than accepted (%d): %%w", oracall.ErrInvalidArgument)
-    }`,
-					name, arg.Charlength, name, arg.Charlength))
-		case "*string":
-			checks = append(checks,
-				fmt.Sprintf(`if %s != nil && len(*%s) > %d {
-		return errors.Errorf("%s is longer than accepted (%d): %%w", oracall.ErrInvalidArgument)
-    }`,
-					name, name, arg.Charlength,
-					name, arg.Charlength))
-		case "sql.NullString":
-			checks = append(checks,
-				fmt.Sprintf(`if %s.Valid && len(%s.String) > %d {
-		return errors.Errorf("%s is longer than accepted (%d): %%w", oracall.ErrInvalidArgument)
-    }`,
-					name, name, arg.Charlength,
-					name, arg.Charlength))
-		case "NullString":
-			checks = append(checks,
-				fmt.Sprintf(`if %s.Valid && len(%s.String) > %d {
-		return errors.Errorf("%s is longer than accepted (%d): %%w", oracall.ErrInvalidArgument)
-    }`,
-					name, name, arg.Charlength,
-					name, arg.Charlength))
-		case "godror.Number":
-			checks = append(checks,
-				fmt.Sprintf(
-					`if err := oracall.ParseDigits(%s, %d, %d); err != nil {
-						return errors.Errorf("%s: %%w", oracall.ErrInvalidArgument)
-					}`,
-					name, arg.Precision, arg.Scale,
-					name))
-
-		case "int32": // no check is needed
-		case "int64", "float64":
-			if arg.Precision > 0 {
-				cons := strings.Repeat("9", int(arg.Precision))
-				checks = append(checks,
-					fmt.Sprintf(`if (%s <= -%s || %s > %s) {
-		return errors.Errorf("%s is out of bounds (-%s..%s): %%w", oracall.ErrInvalidArgument)
-    }`,
-						name, cons, name, cons,
-						name, cons, cons))
-			}
-		case "NullInt64", "NullFloat64", "sql.NullInt64", "sql.NullFloat64":
-			if arg.Precision > 0 {
-				vn := got[strings.Index(got, "Null")+4:]
-				cons := strings.Repeat("9", int(arg.Precision))
-				checks = append(checks,
-					fmt.Sprintf(`if %s.Valid && (%s.%s <= -%s || %s.%s > %s) {
-		return errors.Errorf("%s is out of bounds (-%s..%s): %%w", oracall.ErrInvalidArgument)
-    }`,
-						name, name, vn, cons, name, vn, cons,
-						name, cons, cons))
-			}
+	return checkPath{format: name, indexes: p.indexes}
+}
 
+// index returns the path of the table's elements, and the name of the index variable.
+func (p checkPath) index() (checkPath, string) {
+	i := "i" + strconv.Itoa(len(p.indexes))
+	return checkPath{
+		format:  p.format + "[%d]",
+		indexes: append(append(make([]string, 0, len(p.indexes)+1), p.indexes...), i),
+	}, i
+}
+
+// fieldError returns the Go expression of the *oracall.FieldError of the field, with the reason expression.
+func (p checkPath) fieldError(reason string) string {
+	field := strconv.Quote(p.format)
+	if len(p.indexes) != 0 {
+		field = fmt.Sprintf("fmt.Sprintf(%q, %s)", p.format, strings.Join(p.indexes, ", "))
+	}
+	return fmt.Sprintf("&oracall.FieldError{Field: %s, Reason: %s}", field, reason)
+}
+
+// genChecks appends the checks of arg, which is name in the generated code, to checks.
+// The struct of name is the plain Go API's one, if plain.
+func genChecks(checks []string, arg Argument, name string, path checkPath, tableSize int, plain bool) ([]string, error) {
+	typ, _, err := arg.plainType(plain)
+	if err != nil {
+		return checks, err
+	}
+	if arg.Required {
+		var cond string
+		switch {
+		case strings.HasPrefix(typ, "[]"):
+			cond = "len(" + name + ") == 0"
+		case typ == "string":
+			cond = name + ` == ""`
+		case typ == "*custom.DateTime":
+			cond = name + " == nil || " + name + ".IsZero()"
+		case typ == "time.Time":
+			cond = name + ".IsZero()"
+		case typ[0] == '*':
+			cond = name + " == nil"
 		default:
-			checks = append(checks, fmt.Sprintf("// No check for %q (%q)", arg.Name, got))
+			Log("msg", "the required argument cannot be checked", "arg", arg.Name, "type", typ)
 		}
-	case FLAVOR_RECORD:
-		if parentIsTable || got[0] == '*' {
-			checks = append(checks, "if "+name+" != nil {")
+		if cond != "" {
+			checks = append(checks, fmt.Sprintf("if %s {\n\treturn %s\n}", cond, path.fieldError(`"is required"`)))
 		}
-		for _, sub := range arg.RecordOf {
-			checks = genChecks(checks, *sub.Argument, name, arg.Flavor == FLAVOR_TABLE) //parentIsTable || sub.Flavor == FLAVOR_TABLE)
+	}
+
+	switch {
+	case arg.Flavor == FLAVOR_TABLE:
+		if arg.TableOf == nil || arg.Type == "REF CURSOR" {
+			return checks, nil
 		}
-		if parentIsTable || got[0] == '*' {
-			checks = append(checks, "}")
+		checks = append(checks, fmt.Sprintf("if len(%s) > %d {\n\treturn %s\n}",
+			name, tableSize,
+			path.fieldError(fmt.Sprintf(`fmt.Sprintf("has %%d elements, at most %d allowed", len(%s))`, tableSize, name))))
+		eltPath, i := path.index()
+		v := "v" + strconv.Itoa(len(path.indexes))
+		elt, err := genChecks(nil, *arg.TableOf, v, eltPath, tableSize, plain)
+		if err != nil {
+			return checks, err
 		}
-	case FLAVOR_TABLE:
-		if got[0] == '*' {
-			checks = append(checks, fmt.Sprintf("if %s != nil {  // genChecks[T] %q", name, got))
+		if len(elt) != 0 {
+			checks = append(checks, fmt.Sprintf("for %s, %s := range %s {\n%s\n}", i, v, name, strings.Join(elt, "\n")))
 		}
-		plus := strings.Join(
-			genChecks(nil, *arg.TableOf, "v", true),
-			"\n\t")
-		if len(strings.TrimSpace(plus)) > 0 {
-			checks = append(checks,
-				fmt.Sprintf("\tfor _, v := range %s.%s {\n\t%s\n}",
-					base, aName,
-					plus))
+
+	case arg.Flavor == FLAVOR_RECORD:
+		var sub []string
+		for _, f := range arg.RecordOf {
+			if sub, err = genChecks(sub, *f.Argument, name+"."+CamelCase(f.Name), path.field(f.Name), tableSize, plain); err != nil {
+				return checks, err
+			}
 		}
-		if got[0] == '*' {
-			checks = append(checks, "}")
+		if len(sub) != 0 {
+			checks = append(checks, fmt.Sprintf("if %s != nil {\n%s\n}", name, strings.Join(sub, "\n")))
+		}
+
+	case typ == "string" && arg.Type == "NUMBER":
+		checks = append(checks, fmt.Sprintf("if err := oracall.ParseDigits(%s, %d, %d); err != nil {\n\treturn %s\n}",
+			name, arg.Precision, arg.Scale, path.fieldError("err.Error()")))
+
+	case typ == "string":
+		// the length of the CLOBs is not limited
+		if arg.Charlength > 0 && arg.Type != "CLOB" {
+			// count the length the same way as Oracle does
+			length, unit := "len("+name+")", "bytes"
+			switch charset, inChars := arg.lengthSemantics(); {
+			case inChars:
+				length, unit = fmt.Sprintf("oracall.CharLen(%s, %q)", name, charset), "characters"
+			case EncodedLen("", charset) < 0:
+				Log("msg", "the length in bytes cannot be counted in the character set, skipping the check", "arg", arg.Name, "charset", charset)
+				length = ""
+			case charset != "AL32UTF8":
+				length = fmt.Sprintf("oracall.EncodedLen(%s, %q)", name, charset)
+			}
+			if length != "" {
+				checks = append(checks, fmt.Sprintf("if %s > %d {\n\treturn %s\n}",
+					length, arg.Charlength, path.fieldError(strconv.Quote(fmt.Sprintf("longer than accepted (%d %s)", arg.Charlength, unit)))))
+			}
+		}
+
+	case typ == "*custom.DateTime":
+		checks = append(checks, fmt.Sprintf("if %s != nil && !%s.IsZero() {\n\tif err := oracall.CheckDate(%s.Time); err != nil {\n\t\treturn %s\n\t}\n}",
+			name, name, name, path.fieldError("err.Error()")))
+
+	case typ == "time.Time":
+		checks = append(checks, fmt.Sprintf("if !%s.IsZero() {\n\tif err := oracall.CheckDate(%s); err != nil {\n\t\treturn %s\n\t}\n}",
+			name, name, path.fieldError("err.Error()")))
+
+	case typ == "int64" || typ == "float64":
+		// the int64 cannot hold more than 18 digits
+		if arg.Precision > 0 && (typ == "float64" || arg.Precision < 19) {
+			cons := strings.Repeat("9", int(arg.Precision))
+			checks = append(checks, fmt.Sprintf("if %s < -%s || %s > %s {\n\treturn %s\n}",
+				name, cons, name, cons,
+				path.fieldError(strconv.Quote(fmt.Sprintf("out of bounds (-%s..%s)", cons, cons)))))
 		}
-	default:
-		Log("msg", "unknown flavor", "flavor", arg.Flavor)
-		panic(errors.Errorf("unknown flavor %v", arg.Flavor))
 	}
-	return checks
+	return checks, nil
 }
 
 func capitalize(text string) string {
@@ -603,45 +986,19 @@ func (arg *Argument) goType(isTable bool) (typName string, err error) {
 	}()
 	if arg.Flavor == FLAVOR_SIMPLE {
 		switch arg.Type {
-		case "CHAR", "VARCHAR2", "ROWID":
-			if !isTable && arg.IsOutput() {
-				//return "*string", nil
-				return "string", nil
-			}
-			return "string", nil // NULL is the same as the empty string for Oracle
-		case "RAW":
-			return "[]byte", nil
-		case "NUMBER":
-			return "godror.Number", nil
-		case "INTEGER":
-			if !isTable && arg.IsOutput() {
-				return "*int64", nil
-			}
-			return "int64", nil
-		case "PLS_INTEGER", "BINARY_INTEGER":
-			if !isTable && arg.IsOutput() {
-				//return "*int32", nil
-				return "int32", nil
-			}
-			return "int32", nil
-		case "BOOLEAN", "PL/SQL BOOLEAN":
-			if !isTable && arg.IsOutput() {
-				return "*bool", nil
-			}
-			return "bool", nil
-		case "DATE", "DATETIME", "TIME", "TIMESTAMP":
-			return "time.Time", nil
 		case "REF CURSOR":
 			return "*sql.Rows", nil
-		case "BLOB":
-			return "[]byte", nil
-		case "CLOB":
-			return "string", nil
 		case "BFILE":
 			return "ora.Bfile", nil
-		default:
+		}
+		c, ok := simpleConvs[arg.Type]
+		if !ok {
 			return "", errors.Errorf("%v: %w", arg, UnknownSimpleType)
 		}
+		if c.outPtr && !isTable && arg.IsOutput() {
+			return "*" + c.goType, nil
+		}
+		return c.goType, nil
 	}
 	typName = arg.TypeName
 	chunks := strings.Split(typName, ".")
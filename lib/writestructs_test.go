@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"flag"
 	"fmt"
+	"go/format"
 	"io"
 	"io/ioutil"
 	"os"
@@ -27,6 +28,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/kylelemons/godebug/diff"
 	"github.com/tgulacsi/go/loghlp/kitloghlp"
 )
 
@@ -90,6 +92,51 @@ func TestWriteStruct(t *testing.T) {
 	}
 }
 
+// TestSaveStruct checks that SaveStruct keeps its names and tags - the plain Go API has its own structs.
+func TestSaveStruct(t *testing.T) {
+	fun := testCases[0].ParseCsv(t, 0)[0]
+	var buf bytes.Buffer
+	if err := fun.SaveStruct(&buf, false); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"type DbWeb_Sendpreoffer_31101_Input struct {",
+		"`json:\"-\" xml:\"dbWeb_Sendpreoffer_31101_Input\"`",
+		"P_sessionid      string        `json:\"p_sessionid\" xml:\"p_sessionid\"`",
+		"Szerkot          time.Time     `json:\"szerkot\" xml:\"szerkot\"`",
+		"func (s *DbWeb_Sendpreoffer_31101_Input) FromJSON(data []byte) error {",
+	} {
+		if !bytes.Contains(buf.Bytes(), []byte(want)) {
+			t.Errorf("missing %q from\n%s", want, buf.String())
+		}
+	}
+}
+
+// TestSaveFunctionTests checks that the generated TestCalls is gofmt-clean.
+func TestSaveFunctionTests(t *testing.T) {
+	functions := testCases[0].ParseCsv(t, 0)
+	var buf bytes.Buffer
+	if err := SaveFunctionTests(&buf, functions, "main", "example.com/pb", false); err != nil {
+		t.Fatal(err)
+	}
+	b, err := format.Source(buf.Bytes())
+	if err != nil {
+		t.Fatalf("%v\n%s", err, buf.String())
+	}
+	if d := diff.Diff(buf.String(), string(b)); d != "" {
+		t.Errorf("not gofmt-clean:\n%s", d)
+	}
+	for _, want := range []string{
+		"func TestCalls(t *testing.T) {",
+		"func testSendpreoffer_31101(t *testing.T, jsonText []byte) (interface{}, error) {",
+		`"Main_Sendpreoffer_31101": testSendpreoffer_31101,`,
+	} {
+		if !bytes.Contains(b, []byte(want)) {
+			t.Errorf("missing %q", want)
+		}
+	}
+}
+
 func TestGoName(t *testing.T) {
 	for eltNum, elt := range [][2]string{
 		{"a", "A"},
@@ -65,6 +65,18 @@ func main() {
 }
 
 func Main(args []string) error {
+	if len(args) > 1 {
+		switch args[1] {
+		case "call":
+			return callMain(args[2:])
+		case "serve":
+			return serveMain(args[2:])
+		case "replay":
+			return replayMain(args[2:])
+		case "gen-inputs":
+			return genInputsMain(args[2:])
+		}
+	}
 	os.Args = args
 
 	gopSrc := filepath.Join(os.Getenv("GOPATH"), "src")
@@ -81,6 +93,14 @@ func Main(args []string) error {
 	flagExcept := flag.String("except", "", "except these functions")
 	flagReplace := flag.String("replace", "", "funcA=>funcB")
 	flag.IntVar(&oracall.MaxTableSize, "max-table-size", oracall.MaxTableSize, "maximum table size for PL/SQL associative arrays")
+	flag.StringVar(&oracall.DBCharset, "charset", oracall.DBCharset, "character set of the database (NLS_CHARACTERSET) for the length checks, when not read from the database")
+	flag.StringVar(&oracall.DBNCharset, "ncharset", oracall.DBNCharset, "national character set of the database (NLS_NCHAR_CHARACTERSET) for the length checks, when not read from the database")
+	flagHTTPURL := flag.String("http-url", "", "URL template of the google.api.http annotations, like \"/v1/{package}/{function}\", optionally with per-package templates, like \"/v1/{package}/{function},db_web=/web/{function}\" (needs the googleapis protos on the include path)")
+	flagOpenAPI := flag.String("openapi", "", "write the OpenAPI 3 document into this file (relative to -base-dir and the -pb-out path)")
+	flagGoOut := flag.String("go-out", "", "package import path of the plain Go API (without protobuf and gRPC), optionally with the package name, like \"my/db-pkg:db\"")
+	flagFuzz := flag.Bool("fuzz", false, "write Go (1.18+) fuzz targets of the functions into *_fuzz_test.go, next to the generated tests")
+	flagClientOut := flag.String("client-out", "", "package import path of the generated Go client, optionally with the package name, like \"my/client-pkg:client\"")
+	flagSensitive := flag.String("sensitive", "", "regexp of the argument names to be masked in the logs (besides the ones annotated as sensitive), like \"(?i)passw|card_no\"")
 
 	flag.Parse()
 	if *flagPbOut == "" {
@@ -100,6 +120,25 @@ func Main(args []string) error {
 		pattern = "%"
 	}
 	oracall.Gogo = *flagGenerator != "go"
+	for _, elt := range strings.Split(*flagHTTPURL, ",") {
+		if elt = strings.TrimSpace(elt); elt == "" {
+			continue
+		}
+		if i := strings.IndexByte(elt, '='); i < 0 {
+			oracall.HTTPURLTemplate = elt
+		} else {
+			if oracall.HTTPURLTemplates == nil {
+				oracall.HTTPURLTemplates = make(map[string]string)
+			}
+			oracall.HTTPURLTemplates[strings.ToLower(elt[:i])] = elt[i+1:]
+		}
+	}
+	if *flagSensitive != "" {
+		var err error
+		if oracall.SensitivePattern, err = regexp.Compile(*flagSensitive); err != nil {
+			return errors.Errorf("-sensitive=%q: %w", *flagSensitive, err)
+		}
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
 	defer cancel()
@@ -159,7 +198,7 @@ func Main(args []string) error {
 
 	defer os.Stdout.Sync()
 	out := os.Stdout
-	var testOut *os.File
+	var testOut, fuzzOut *os.File
 	if dbPath != "" && dbPath != "-" {
 		fn := "oracall.go"
 		if dbPkg != "main" {
@@ -175,6 +214,12 @@ func Main(args []string) error {
 		if testOut, err = os.Create(testFn); err != nil {
 			return errors.Errorf("create %s: %w", testFn, err)
 		}
+		if *flagFuzz {
+			fuzzFn := fn[:len(fn)-3] + "_fuzz_test.go"
+			if fuzzOut, err = os.Create(fuzzFn); err != nil {
+				return errors.Errorf("create %s: %w", fuzzFn, err)
+			}
+		}
 		defer func() {
 			if err := out.Close(); err != nil {
 				Log("msg", "close", "file", out.Name(), "error", err)
@@ -182,6 +227,12 @@ func Main(args []string) error {
 			if err := testOut.Close(); err != nil {
 				Log("msg", "close", "file", testOut.Name(), "error", err)
 			}
+			if fuzzOut == nil {
+				return
+			}
+			if err := fuzzOut.Close(); err != nil {
+				Log("msg", "close", "file", fuzzOut.Name(), "error", err)
+			}
 		}()
 	}
 
@@ -233,6 +284,18 @@ func Main(args []string) error {
 			return nil
 		})
 	}
+	if fuzzOut != nil {
+		grp.Go(func() error {
+			pbPath := pbPath
+			if pbPath == dbPath {
+				pbPath = ""
+			}
+			if err := oracall.SaveFunctionFuzz(fuzzOut, functions, dbPkg, pbPath); err != nil {
+				return errors.Errorf("save function fuzz targets: %w", err)
+			}
+			return nil
+		})
+	}
 
 	grp.Go(func() error {
 		fn := "oracall.proto"
@@ -255,10 +318,14 @@ func Main(args []string) error {
 		}
 
 		goOut := *flagGenerator + "_out"
+		mappings := "Mgoogle/protobuf/timestamp.proto=github.com/gogo/protobuf/types,"
+		if oracall.Gogo && *flagHTTPURL != "" {
+			mappings += "Mgoogle/api/annotations.proto=github.com/gogo/googleapis/google/api,"
+		}
 		cmd := exec.Command(
 			"protoc",
 			"--proto_path="+*flagBaseDir+":.",
-			"--"+goOut+"=Mgoogle/protobuf/timestamp.proto=github.com/gogo/protobuf/types,plugins=grpc:"+*flagBaseDir,
+			"--"+goOut+"="+mappings+"plugins=grpc:"+*flagBaseDir,
 			fn,
 		)
 		cmd.Stdout = os.Stdout
@@ -269,6 +336,74 @@ func Main(args []string) error {
 		return nil
 	})
 
+	if *flagOpenAPI != "" {
+		grp.Go(func() error {
+			fn := filepath.Join(*flagBaseDir, pbPath, *flagOpenAPI)
+			os.MkdirAll(filepath.Dir(fn), 0775)
+			Log("msg", "Writing OpenAPI", "file", fn)
+			var lastDDL time.Time
+			for _, f := range functions {
+				if f.LastDDL.After(lastDDL) {
+					lastDDL = f.LastDDL
+				}
+			}
+			fh, err := os.Create(fn)
+			if err != nil {
+				return errors.Errorf("create openapi: %w", err)
+			}
+			err = oracall.SaveOpenAPI(fh, functions, pbPkg, lastDDL.Format("20060102.150405"))
+			if closeErr := fh.Close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return errors.Errorf("SaveOpenAPI: %w", err)
+			}
+			return nil
+		})
+	}
+
+	if *flagGoOut != "" {
+		grp.Go(func() error {
+			goPath, goPkg := parsePkgFlag(*flagGoOut)
+			fn := filepath.Join(*flagBaseDir, goPath, goPkg+".go")
+			os.MkdirAll(filepath.Dir(fn), 0775)
+			Log("msg", "Writing plain Go API", "file", fn)
+			fh, err := os.Create(fn)
+			if err != nil {
+				return errors.Errorf("create plain Go API: %w", err)
+			}
+			err = oracall.SaveGoAPI(fh, functions, goPkg)
+			if closeErr := fh.Close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return errors.Errorf("SaveGoAPI: %w", err)
+			}
+			return nil
+		})
+	}
+
+	if *flagClientOut != "" {
+		grp.Go(func() error {
+			clientPath, clientPkg := parsePkgFlag(*flagClientOut)
+			fn := filepath.Join(*flagBaseDir, clientPath, clientPkg+".go")
+			os.MkdirAll(filepath.Dir(fn), 0775)
+			Log("msg", "Writing client", "file", fn)
+			fh, err := os.Create(fn)
+			if err != nil {
+				return errors.Errorf("create client: %w", err)
+			}
+			err = oracall.SaveClient(fh, functions, clientPkg, pbPath, pbPkg)
+			if closeErr := fh.Close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return errors.Errorf("SaveClient: %w", err)
+			}
+			return nil
+		})
+	}
+
 	if err := grp.Wait(); err != nil {
 		return err
 	}
@@ -287,10 +422,10 @@ func (r dbRow) String() string {
 }
 
 type dbType struct {
-	Argument                                       string
-	Data, PLS, Owner, Name, Subname, Link, Charset string
-	Level                                          int
-	Prec, Scale, Length                            sql.NullInt64
+	Argument                                                 string
+	Data, PLS, Owner, Name, Subname, Link, Charset, CharUsed string
+	Level                                                    int
+	Prec, Scale, Length                                      sql.NullInt64
 }
 
 func (t dbType) String() string {
@@ -309,7 +444,7 @@ func parseDB(ctx context.Context, cx *sql.DB, pattern, dumpFn string, filter fun
            package_name, object_name,
            data_level, argument_name, in_out,
            data_type, data_precision, data_scale, character_set_name,
-           pls_type, char_length, type_owner, type_name, type_subname, type_link
+           pls_type, char_length, type_owner, type_name, type_subname, type_link, char_used
       FROM ` + tbl + `
       WHERE data_type <> 'OBJECT' AND package_name||'.'||object_name LIKE UPPER(:1)
      UNION ALL
@@ -318,7 +453,7 @@ func parseDB(ctx context.Context, cx *sql.DB, pattern, dumpFn string, filter fun
             A.data_level, B.attr_name, A.in_out,
             B.ATTR_TYPE_NAME, B.PRECISION, B.scale, B.character_set_name,
             NVL2(B.ATTR_TYPE_OWNER, B.attr_type_owner||'.', '')||B.attr_type_name, B.length,
-			NULL, NULL, NULL, NULL
+			NULL, NULL, NULL, NULL, B.char_used
        FROM all_type_attrs B, ` + tbl + ` A
        WHERE B.owner = A.type_owner AND B.type_name = A.type_name AND
              A.data_type = 'OBJECT' AND
@@ -329,6 +464,27 @@ func parseDB(ctx context.Context, cx *sql.DB, pattern, dumpFn string, filter fun
 	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
+	// the character sets of the database, for the length checks of the strings
+	const charsetQry = `SELECT parameter, value FROM nls_database_parameters WHERE parameter IN ('NLS_CHARACTERSET', 'NLS_NCHAR_CHARACTERSET')`
+	if rows, qryErr := cx.QueryContext(ctx, charsetQry); qryErr != nil {
+		logger.Log("qry", charsetQry, "error", qryErr)
+	} else {
+		for rows.Next() {
+			var k, v string
+			if qryErr = rows.Scan(&k, &v); qryErr != nil {
+				logger.Log("qry", charsetQry, "error", qryErr)
+				break
+			}
+			if k == "NLS_CHARACTERSET" {
+				oracall.DBCharset = v
+			} else {
+				oracall.DBNCharset = v
+			}
+		}
+		rows.Close()
+		logger.Log("charset", oracall.DBCharset, "ncharset", oracall.DBNCharset)
+	}
+
 	objTimeQry := `SELECT last_ddl_time FROM ` + objTbl + ` WHERE object_name = :1 AND object_type <> 'PACKAGE BODY'`
 	objTimeStmt, err := cx.PrepareContext(ctx, objTimeQry)
 	if err != nil {
@@ -349,7 +505,7 @@ func parseDB(ctx context.Context, cx *sql.DB, pattern, dumpFn string, filter fun
 		defer close(dbCh)
 		var collStmt, attrStmt *sql.Stmt
 		qry := `SELECT coll_type, elem_type_owner, elem_type_name, elem_type_package,
-				   length, precision, scale, character_set_name, index_by,
+				   length, precision, scale, character_set_name, char_used, index_by,
 				   (SELECT MIN(typecode) FROM all_plsql_types B
 				      WHERE B.owner = A.elem_type_owner AND
 					        B.type_name = A.elem_type_name AND
@@ -358,7 +514,7 @@ func parseDB(ctx context.Context, cx *sql.DB, pattern, dumpFn string, filter fun
 			  WHERE owner = :owner AND package_name = :pkg AND type_name = :sub
 			UNION
 			SELECT coll_type, elem_type_owner, elem_type_name, NULL elem_type_package,
-				   length, precision, scale, character_set_name, NULL index_by,
+				   length, precision, scale, character_set_name, char_used, NULL index_by,
 				   (SELECT MIN(typecode) FROM all_types B
 				      WHERE B.owner = A.elem_type_owner AND
 					        B.type_name = A.elem_type_name) typecode
@@ -381,7 +537,7 @@ func parseDB(ctx context.Context, cx *sql.DB, pattern, dumpFn string, filter fun
 				rows.Close()
 
 				qry = `SELECT attr_name, attr_type_owner, attr_type_name, attr_type_package,
-                      length, precision, scale, character_set_name, attr_no,
+                      length, precision, scale, character_set_name, char_used, attr_no,
 				      (SELECT MIN(typecode) FROM all_plsql_types B
 				         WHERE B.owner = A.attr_type_owner AND B.type_name = A.attr_type_name AND B.package_name = A.attr_type_package) typecode
 			     FROM all_plsql_type_attrs A
@@ -417,7 +573,7 @@ func parseDB(ctx context.Context, cx *sql.DB, pattern, dumpFn string, filter fun
 			if err = rows.Scan(&row.OID, &row.SubID, &row.Seq, &row.Package, &row.Object,
 				&row.Level, &row.Argument, &row.InOut,
 				&row.Data, &row.Prec, &row.Scale, &row.Charset,
-				&row.PLS, &row.Length, &row.Owner, &row.Name, &row.Subname, &row.Link,
+				&row.PLS, &row.Length, &row.Owner, &row.Name, &row.Subname, &row.Link, &row.CharUsed,
 			); err != nil {
 				return errors.Errorf("reading row=%v: %w", rows, err)
 			}
@@ -443,6 +599,7 @@ func parseDB(ctx context.Context, cx *sql.DB, pattern, dumpFn string, filter fun
 					row.Seq = seq
 					seq++
 					row.Argument, row.Data, row.Length, row.Prec, row.Scale, row.Charset = p.Argument, p.Data, p.Length, p.Prec, p.Scale, p.Charset
+					row.CharUsed = p.CharUsed
 					row.Owner, row.Name, row.Subname, row.Link = p.Owner, p.Name, p.Subname, p.Link
 					row.Level = p.Level
 					//logger.Log("arg", row.Argument, "row", row.Length, "p", p.Length)
@@ -568,7 +725,7 @@ func parseDB(ctx context.Context, cx *sql.DB, pattern, dumpFn string, filter fun
 					strconv.Itoa(row.Level), row.Argument, ua.InOut,
 					ua.DataType, N(row.Prec), N(row.Scale), row.Charset,
 					row.PLS, N(row.Length),
-					row.Owner, row.Name, row.Subname, row.Link,
+					row.Owner, row.Name, row.Subname, row.Link, row.CharUsed,
 				})
 				cwMu.Unlock()
 				if err != nil {
@@ -604,7 +761,9 @@ func parseDB(ctx context.Context, cx *sql.DB, pattern, dumpFn string, filter fun
 							a.Type, b = string(b[:i]), b[i+1:]
 						}
 						if i := bytes.Index(b, []byte("=>")); i < 0 {
-							if i = bytes.IndexByte(b, '='); i < 0 {
+							if i = bytes.IndexByte(b, '='); i >= 0 && (a.Type == "inject" || a.Type == "timeout") {
+								a.Name, a.Other = string(bytes.TrimSpace(b[:i])), string(bytes.TrimSpace(b[i+1:]))
+							} else if i < 0 {
 								a.Name = string(bytes.TrimSpace(b))
 							} else {
 								a.Name = string(bytes.TrimSpace(b[:i]))
@@ -649,6 +808,7 @@ func parseDB(ctx context.Context, cx *sql.DB, pattern, dumpFn string, filter fun
 			if row.Charset != "" {
 				ua.CharacterSetName = row.Charset
 			}
+			ua.CharUsed = row.CharUsed
 			if row.PLS != "" {
 				ua.PlsType = row.PLS
 			}
@@ -757,7 +917,7 @@ func parsePkgFlag(s string) (string, string) {
 }
 
 var rReplace = regexp.MustCompile(`\s*=>\s*`)
-var rAnnotation = regexp.MustCompile(`--oracall:(?:(replace(_json)?|rename)\s+[a-zA-Z0-9_#]+\s*=>\s*[a-zA-Z0-9_#]+|(handle|private)\s+[a-zA-Z0-9_#]+|max-table-size\s+[a-zA-Z0-9_$]+\s*=\s*[0-9]+)`)
+var rAnnotation = regexp.MustCompile(`--oracall:(?:(replace(_json)?|rename)\s+[a-zA-Z0-9_#]+\s*=>\s*[a-zA-Z0-9_#]+|(handle|private|session-bound|idempotent)\s+[a-zA-Z0-9_#]+|max-table-size\s+[a-zA-Z0-9_$]+\s*=\s*[0-9]+|inject\s+[a-zA-Z0-9_#.]+\s*=\s*[a-z.]+|(sensitive|required)\s+[a-zA-Z0-9_#.]+|timeout\s+[a-zA-Z0-9_$]+\s*=\s*[0-9][0-9a-z.]*|retry\s+[a-zA-Z0-9_$]+\s*=\s*[0-9]+)`)
 
 func resolveType(ctx context.Context, collStmt, attrStmt *sql.Stmt, typ, owner, pkg, sub string) ([]dbType, error) {
 	plus := make([]dbType, 0, 4)
@@ -767,7 +927,7 @@ func resolveType(ctx context.Context, collStmt, attrStmt *sql.Stmt, typ, owner,
 	switch typ {
 	case "PL/SQL TABLE", "PL/SQL INDEX TABLE", "TABLE":
 		/*SELECT coll_type, elem_type_owner, elem_type_name, elem_type_package,
-			   length, precision, scale, character_set_name, index_by
+			   length, precision, scale, character_set_name, char_used, index_by
 		  FROM all_plsql_coll_types
 		  WHERE owner = :1 AND package_name = :2 AND type_name = :3*/
 		if rows, err = collStmt.QueryContext(ctx,
@@ -780,7 +940,7 @@ func resolveType(ctx context.Context, collStmt, attrStmt *sql.Stmt, typ, owner,
 			var t dbType
 			var indexBy, typeCode string
 			if err = rows.Scan(&t.Data, &t.Owner, &t.Subname, &t.Name,
-				&t.Length, &t.Prec, &t.Scale, &t.Charset, &indexBy, &typeCode,
+				&t.Length, &t.Prec, &t.Scale, &t.Charset, &t.CharUsed, &indexBy, &typeCode,
 			); err != nil {
 				return plus, err
 			}
@@ -815,7 +975,7 @@ func resolveType(ctx context.Context, collStmt, attrStmt *sql.Stmt, typ, owner,
 
 	case "PL/SQL RECORD":
 		/*SELECT attr_name, attr_type_owner, attr_type_name, attr_type_package,
-		                      length, precision, scale, character_set_name, attr_no
+		                      length, precision, scale, character_set_name, char_used, attr_no
 					     FROM all_plsql_type_attrs
 						 WHERE owner = :1 AND package_name = :2 AND type_name = :3
 						 ORDER BY attr_no*/
@@ -830,7 +990,7 @@ func resolveType(ctx context.Context, collStmt, attrStmt *sql.Stmt, typ, owner,
 			var attrNo sql.NullInt64
 			var typeCode string
 			if err = rows.Scan(&t.Argument, &t.Owner, &t.Subname, &t.Name,
-				&t.Length, &t.Prec, &t.Scale, &t.Charset, &attrNo, &typeCode,
+				&t.Length, &t.Prec, &t.Scale, &t.Charset, &t.CharUsed, &attrNo, &typeCode,
 			); err != nil {
 				return plus, err
 			}
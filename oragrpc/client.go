@@ -0,0 +1,86 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oragrpc
+
+import (
+	"context"
+	"time"
+
+	errors "golang.org/x/xerrors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultRetryBackoff is the default wait before the first retry of CallOptions.
+const DefaultRetryBackoff = 100 * time.Millisecond
+
+// CallOptions are the deadline and the retries of the calls of a generated client method,
+// from the "timeout" and "retry" annotations of the function.
+type CallOptions struct {
+	// Timeout is the deadline of each attempt, if not zero.
+	Timeout time.Duration
+	// MaxAttempts is the maximum number of attempts of the calls failing with Unavailable.
+	MaxAttempts int
+	// Backoff is the wait before the first retry, doubled before each further one - DefaultRetryBackoff if zero.
+	Backoff time.Duration
+}
+
+// Call calls f with the Timeout, retrying it while it fails with Unavailable (and not marked with NoRetry),
+// at most MaxAttempts times. The returned error is translated with ClientError.
+func (o CallOptions) Call(ctx context.Context, f func(context.Context) error) error {
+	backoff := o.Backoff
+	if backoff <= 0 {
+		backoff = DefaultRetryBackoff
+	}
+	var err error
+	for i := 0; i == 0 || i < o.MaxAttempts; i++ {
+		if i != 0 {
+			select {
+			case <-ctx.Done():
+				return ClientError(err)
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+		callCtx, cancel := ctx, context.CancelFunc(func() {})
+		if o.Timeout > 0 {
+			callCtx, cancel = context.WithTimeout(ctx, o.Timeout)
+		}
+		err = f(callCtx)
+		cancel()
+		var nr noRetry
+		if errors.As(err, &nr) {
+			return ClientError(nr.error)
+		}
+		if status.Code(err) != codes.Unavailable {
+			break
+		}
+	}
+	return ClientError(err)
+}
+
+// NoRetry marks the error as not to be retried by CallOptions.Call - such as the errors after a stream has started.
+func NoRetry(err error) error {
+	if err == nil {
+		return nil
+	}
+	return noRetry{err}
+}
+
+type noRetry struct{ error }
+
+func (e noRetry) Unwrap() error { return e.error }
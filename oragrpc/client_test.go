@@ -0,0 +1,59 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oragrpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCallOptions(t *testing.T) {
+	ctx := context.Background()
+	opts := CallOptions{MaxAttempts: 3, Backoff: time.Millisecond, Timeout: time.Second}
+
+	var n int
+	err := opts.Call(ctx, func(ctx context.Context) error {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("no deadline")
+		}
+		n++
+		return status.Error(codes.Unavailable, "down")
+	})
+	if status.Code(err) != codes.Unavailable || n != 3 {
+		t.Errorf("got %v after %d attempts, wanted Unavailable after 3", err, n)
+	}
+
+	n = 0
+	if err = opts.Call(ctx, func(context.Context) error {
+		n++
+		return NoRetry(status.Error(codes.Unavailable, "down"))
+	}); status.Code(err) != codes.Unavailable || n != 1 {
+		t.Errorf("NoRetry: got %v after %d attempts, wanted Unavailable after 1", err, n)
+	}
+
+	n = 0
+	if err = opts.Call(ctx, func(context.Context) error {
+		n++
+		return status.Error(codes.InvalidArgument, "bad")
+	}); status.Code(err) != codes.InvalidArgument || n != 1 {
+		t.Errorf("got %v after %d attempts, wanted InvalidArgument after 1", err, n)
+	}
+}
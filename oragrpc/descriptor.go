@@ -0,0 +1,180 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oragrpc
+
+import (
+	"strings"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/gogo/protobuf/protoc-gen-gogo/descriptor"
+	oracall "github.com/tgulacsi/oracall/lib"
+	errors "golang.org/x/xerrors"
+)
+
+// TimestampProto is the file of google.protobuf.Timestamp, the dependency of the descriptors with DATE arguments.
+const TimestampProto = "google/protobuf/timestamp.proto"
+
+const timestampTypeName = "." + oracall.TimestampType
+
+// Descriptors are the protobuf descriptors of the functions, built in memory:
+// the same messages and service as SaveProtobuf writes, without the gogoproto and google.api.http options
+// (but with the (oracall.sensitive) option of the sensitive fields).
+type Descriptors struct {
+	// File is the descriptor of the "<pkg>.proto" file.
+	File *descriptor.FileDescriptorProto
+	// Methods are the methods of the service, by the full method name ("/pkg.Service/Method").
+	Methods map[string]DescriptorMethod
+
+	messages map[string]*descriptor.DescriptorProto
+}
+
+// DescriptorMethod is a method of the Descriptors.
+type DescriptorMethod struct {
+	oracall.Function
+	// Input and Output are the full names of the input and output messages, with a leading dot.
+	Input, Output string
+}
+
+// NewDescriptors returns the descriptors of the functions, as SaveProtobuf writes them into the package pkg
+// (both are built from the NewProtoFile of the functions).
+//
+// The functions with missing TableOf info, or unknown types, are skipped if SkipMissingTableOf is set.
+func NewDescriptors(functions []oracall.Function, pkg string) (*Descriptors, error) {
+	pf, err := oracall.NewProtoFile(functions, pkg)
+	if err != nil {
+		return nil, err
+	}
+	d := &Descriptors{
+		File: &descriptor.FileDescriptorProto{
+			Name:   proto.String(pkg + ".proto"),
+			Syntax: proto.String("proto3"),
+		},
+		Methods:  make(map[string]DescriptorMethod, len(pf.Methods)),
+		messages: make(map[string]*descriptor.DescriptorProto, len(pf.Messages)),
+	}
+	prefix := "."
+	if pkg != "" {
+		d.File.Package = proto.String(pkg)
+		prefix += pkg + "."
+	}
+	for _, m := range pf.Messages {
+		msg := &descriptor.DescriptorProto{Name: proto.String(m.Name)}
+		for _, f := range m.Fields {
+			label := descriptor.FieldDescriptorProto_LABEL_OPTIONAL
+			if f.Repeated {
+				label = descriptor.FieldDescriptorProto_LABEL_REPEATED
+			}
+			field := &descriptor.FieldDescriptorProto{
+				Name:   proto.String(f.Name),
+				Number: proto.Int32(f.Number),
+				Label:  &label,
+			}
+			switch {
+			case f.Message:
+				field.Type = descriptor.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+				field.TypeName = proto.String(prefix + f.Type)
+			case f.Type == oracall.TimestampType:
+				field.Type = descriptor.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+				field.TypeName = proto.String(timestampTypeName)
+				if !hasDependency(d.File, TimestampProto) {
+					d.File.Dependency = append(d.File.Dependency, TimestampProto)
+				}
+			default:
+				t, ok := scalarTypes[f.Type]
+				if !ok {
+					return nil, errors.Errorf("%s.%s (%s): %w", m.Name, f.Name, f.Type, oracall.UnknownSimpleType)
+				}
+				field.Type = t.Enum()
+			}
+			if f.Sensitive {
+				if err := setSensitive(field); err != nil {
+					return nil, errors.Errorf("%s.%s: %w", m.Name, f.Name, err)
+				}
+				if !hasDependency(d.File, oracall.OptionsProto) {
+					d.File.Dependency = append(d.File.Dependency, oracall.OptionsProto)
+				}
+			}
+			msg.Field = append(msg.Field, field)
+		}
+		d.messages[prefix[1:]+m.Name] = msg
+		d.File.MessageType = append(d.File.MessageType, msg)
+	}
+
+	svc := &descriptor.ServiceDescriptorProto{Name: proto.String(pf.Service)}
+	fullSvc := prefix[1:] + pf.Service
+	for _, m := range pf.Methods {
+		method := &descriptor.MethodDescriptorProto{
+			Name:       proto.String(m.Name),
+			InputType:  proto.String(prefix + m.Input),
+			OutputType: proto.String(prefix + m.Output),
+		}
+		if m.Stream {
+			method.ServerStreaming = proto.Bool(true)
+		}
+		svc.Method = append(svc.Method, method)
+		d.Methods["/"+fullSvc+"/"+m.Name] = DescriptorMethod{
+			Function: m.Function, Input: method.GetInputType(), Output: method.GetOutputType(),
+		}
+	}
+	d.File.Service = []*descriptor.ServiceDescriptorProto{svc}
+	return d, nil
+}
+
+func hasDependency(fd *descriptor.FileDescriptorProto, name string) bool {
+	for _, dep := range fd.Dependency {
+		if dep == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ServiceName returns the full name of the service of the descriptors.
+func (d *Descriptors) ServiceName() string {
+	if d.File.GetPackage() == "" {
+		return d.File.Service[0].GetName()
+	}
+	return d.File.GetPackage() + "." + d.File.Service[0].GetName()
+}
+
+// HasSymbol reports whether the fully-qualified name (without the leading dot) of a service, method or message
+// is defined by the descriptors.
+func (d *Descriptors) HasSymbol(name string) bool {
+	if _, ok := d.messages[name]; ok {
+		return true
+	}
+	svc := d.ServiceName()
+	if name == svc {
+		return true
+	}
+	if !strings.HasPrefix(name, svc+".") {
+		return false
+	}
+	_, ok := d.Methods["/"+svc+"/"+name[len(svc)+1:]]
+	return ok
+}
+
+// scalarTypes are the descriptor types of the ProtoScalarTypes.
+var scalarTypes = map[string]descriptor.FieldDescriptorProto_Type{
+	"string": descriptor.FieldDescriptorProto_TYPE_STRING,
+	"bytes":  descriptor.FieldDescriptorProto_TYPE_BYTES,
+	"bool":   descriptor.FieldDescriptorProto_TYPE_BOOL,
+	"sint32": descriptor.FieldDescriptorProto_TYPE_SINT32,
+	"int32":  descriptor.FieldDescriptorProto_TYPE_INT32,
+	"int64":  descriptor.FieldDescriptorProto_TYPE_INT64,
+	"double": descriptor.FieldDescriptorProto_TYPE_DOUBLE,
+}
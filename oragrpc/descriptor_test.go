@@ -0,0 +1,166 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oragrpc
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	protoparser "github.com/emicklei/proto"
+	"github.com/gogo/protobuf/protoc-gen-gogo/descriptor"
+	"github.com/google/go-cmp/cmp"
+	"github.com/tgulacsi/go/loghlp/kitloghlp"
+	oracall "github.com/tgulacsi/oracall/lib"
+)
+
+const testCsv = `OBJECT_ID;SUBPROGRAM_ID;PACKAGE_NAME;OBJECT_NAME;DATA_LEVEL;POSITION;ARGUMENT_NAME;IN_OUT;DATA_TYPE;DATA_PRECISION;DATA_SCALE;CHARACTER_SET_NAME;PLS_TYPE;CHAR_LENGTH;TYPE_LINK;TYPE_OWNER;TYPE_NAME;TYPE_SUBNAME
+19734;35;DB_WEB;SENDPREOFFER_31101;0;1;P_SESSIONID;IN/OUT;VARCHAR2;;;CHAR_CS;VARCHAR2;;;;;
+19734;35;DB_WEB;SENDPREOFFER_31101;0;5;P_VONALKOD;IN/OUT;BINARY_INTEGER;;;;PLS_INTEGER;0;;;;
+19734;35;DB_WEB;SENDPREOFFER_31101;0;1;DIJKOD;IN/OUT;CHAR;;;CHAR_CS;CHAR;2;;;;
+19734;35;DB_WEB;SENDPREOFFER_31101;0;4;SZERKOT;IN/OUT;DATE;;;;DATE;0;;;;
+19734;35;DB_WEB;SENDPREOFFER_31101;0;16;AJANLATI_EVESDIJ;IN/OUT;NUMBER;12;2;;NUMBER;0;;;;
+19734;35;DB_WEB;SENDPREOFFER_31101;0;17;P_KEP;IN;RAW;;;;RAW;2000;;;;
+`
+
+func parseCsv(t *testing.T, r io.Reader) []oracall.Function {
+	functions, err := oracall.ParseCsv(r, nil)
+	if err != nil {
+		t.Fatalf("parse csv: %+v", err)
+	}
+	return functions
+}
+
+func TestNewDescriptors(t *testing.T) {
+	oracall.Log = kitloghlp.NewTestLogger(t).Log
+	functions := parseCsv(t, strings.NewReader(testCsv))
+	ds, err := NewDescriptors(functions, "db_web")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	svc := "db_web." + oracall.CamelCase("db_web")
+	if got := ds.ServiceName(); got != svc {
+		t.Errorf("service: got %q", got)
+	}
+	if len(ds.Methods) != 1 {
+		t.Fatalf("got %d methods, wanted 1", len(ds.Methods))
+	}
+	for fullMethod, m := range ds.Methods {
+		method := oracall.CamelCase("sendpreoffer_31101")
+		if fullMethod != "/"+svc+"/"+method {
+			t.Errorf("full method: got %q", fullMethod)
+		}
+		input := ds.messages[m.Input[1:]]
+		if input == nil {
+			t.Fatalf("no input message %q", m.Input)
+		}
+		types := make(map[string]descriptor.FieldDescriptorProto_Type, len(input.Field))
+		for _, f := range input.Field {
+			types[f.GetName()] = f.GetType()
+		}
+		for nm, want := range map[string]descriptor.FieldDescriptorProto_Type{
+			"p_sessionid":      descriptor.FieldDescriptorProto_TYPE_STRING,
+			"p_vonalkod":       descriptor.FieldDescriptorProto_TYPE_SINT32,
+			"szerkot":          descriptor.FieldDescriptorProto_TYPE_MESSAGE,
+			"ajanlati_evesdij": descriptor.FieldDescriptorProto_TYPE_STRING,
+			"p_kep":            descriptor.FieldDescriptorProto_TYPE_BYTES,
+		} {
+			if got := types[nm]; got != want {
+				t.Errorf("%s: got %s, wanted %s", nm, got, want)
+			}
+		}
+		if !ds.HasSymbol(m.Input[1:]) || !ds.HasSymbol(svc+"."+method) {
+			t.Error("HasSymbol failed")
+		}
+	}
+	if len(ds.File.Dependency) != 1 || ds.File.Dependency[0] != TimestampProto {
+		t.Errorf("dependencies: got %q", ds.File.Dependency)
+	}
+}
+
+// TestDescriptorsMatchProtobuf compares the descriptors with the parsed SaveProtobuf output.
+func TestDescriptorsMatchProtobuf(t *testing.T) {
+	oracall.Log = kitloghlp.NewTestLogger(t).Log
+	const pkg = "db_web"
+	fh, err := os.Open("../testdata/one.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+	for i, functions := range [][]oracall.Function{
+		parseCsv(t, strings.NewReader(testCsv)),
+		parseCsv(t, fh),
+	} {
+		var buf bytes.Buffer
+		if err := oracall.SaveProtobuf(&buf, functions, pkg); err != nil {
+			t.Fatalf("%d. %+v", i, err)
+		}
+		def, err := protoparser.NewParser(bytes.NewReader(buf.Bytes())).Parse()
+		if err != nil {
+			t.Fatalf("%d. parse %s: %+v", i, buf.String(), err)
+		}
+		want := make(map[string][]string)
+		protoparser.Walk(def,
+			protoparser.WithMessage(func(m *protoparser.Message) {
+				for _, e := range m.Elements {
+					if f, ok := e.(*protoparser.NormalField); ok {
+						want[m.Name] = append(want[m.Name], fmt.Sprintf("%d %s %s repeated=%t", f.Sequence, f.Name, f.Type, f.Repeated))
+					}
+				}
+			}),
+			protoparser.WithService(func(s *protoparser.Service) {
+				for _, e := range s.Elements {
+					if r, ok := e.(*protoparser.RPC); ok {
+						want[s.Name] = append(want[s.Name], fmt.Sprintf("%s(%s) %s stream=%t", r.Name, r.RequestType, r.ReturnsType, r.StreamsReturns))
+					}
+				}
+			}),
+		)
+
+		ds, err := NewDescriptors(functions, pkg)
+		if err != nil {
+			t.Fatalf("%d. %+v", i, err)
+		}
+		got := make(map[string][]string)
+		for _, m := range ds.File.MessageType {
+			for _, f := range m.Field {
+				typ := strings.ToLower(strings.TrimPrefix(f.GetType().String(), "TYPE_"))
+				if f.GetType() == descriptor.FieldDescriptorProto_TYPE_MESSAGE {
+					typ = strings.TrimPrefix(strings.TrimPrefix(f.GetTypeName(), "."+pkg+"."), ".")
+				}
+				got[m.GetName()] = append(got[m.GetName()], fmt.Sprintf("%d %s %s repeated=%t",
+					f.GetNumber(), f.GetName(), typ, f.GetLabel() == descriptor.FieldDescriptorProto_LABEL_REPEATED))
+			}
+		}
+		for _, svc := range ds.File.Service {
+			for _, m := range svc.Method {
+				got[svc.GetName()] = append(got[svc.GetName()], fmt.Sprintf("%s(%s) %s stream=%t", m.GetName(),
+					strings.TrimPrefix(m.GetInputType(), "."+pkg+"."), strings.TrimPrefix(m.GetOutputType(), "."+pkg+"."),
+					m.GetServerStreaming()))
+			}
+		}
+		if len(got) == 0 {
+			t.Errorf("%d. no messages", i)
+		}
+		if d := cmp.Diff(want, got); d != "" {
+			t.Errorf("%d. descriptors differ from the .proto:\n%s", i, d)
+		}
+	}
+}
@@ -0,0 +1,463 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oragrpc
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gogo/protobuf/protoc-gen-gogo/descriptor"
+	oracall "github.com/tgulacsi/oracall/lib"
+	errors "golang.org/x/xerrors"
+)
+
+// DynamicMessage is a protobuf message of the Descriptors, with its fields in a map,
+// in the same form as the input and output of InvokeMap:
+// the records are maps, the repeated fields are []interface{}, the Timestamps are time.Time values.
+//
+// It implements the proto.Message, proto.Marshaler and proto.Unmarshaler interfaces, for the gRPC codec.
+type DynamicMessage struct {
+	Fields map[string]interface{}
+
+	desc  *descriptor.DescriptorProto
+	descs *Descriptors
+}
+
+// NewMessage returns a new, empty message of the type (a full name, with or without the leading dot).
+func (d *Descriptors) NewMessage(typeName string) (*DynamicMessage, error) {
+	desc, ok := d.messages[strings.TrimPrefix(typeName, ".")]
+	if !ok {
+		return nil, errors.Errorf("%s: unknown message", typeName)
+	}
+	return &DynamicMessage{desc: desc, descs: d}, nil
+}
+
+func (m *DynamicMessage) ProtoMessage() {}
+func (m *DynamicMessage) Reset()        { m.Fields = nil }
+func (m *DynamicMessage) String() string {
+	b, _ := json.Marshal(m.Fields)
+	return string(b)
+}
+
+// XXX_MessageName returns the full name of the message (see oracall.MessageName).
+func (m *DynamicMessage) XXX_MessageName() string {
+	if pkg := m.descs.File.GetPackage(); pkg != "" {
+		return pkg + "." + m.desc.GetName()
+	}
+	return m.desc.GetName()
+}
+
+// MarshalJSON returns the JSON of the fields.
+func (m *DynamicMessage) MarshalJSON() ([]byte, error) { return json.Marshal(m.Fields) }
+
+// Marshal returns the protobuf wire format of the message.
+func (m *DynamicMessage) Marshal() ([]byte, error) {
+	return m.descs.marshal(nil, m.desc, m.Fields)
+}
+
+// Unmarshal decodes the protobuf wire format into the fields.
+func (m *DynamicMessage) Unmarshal(b []byte) error {
+	var err error
+	m.Fields, err = m.descs.unmarshal(b, m.desc)
+	return err
+}
+
+func (d *Descriptors) marshal(buf []byte, desc *descriptor.DescriptorProto, fields map[string]interface{}) ([]byte, error) {
+	var err error
+	for _, f := range desc.Field {
+		v := fields[f.GetName()]
+		if v == nil {
+			continue
+		}
+		if f.GetLabel() != descriptor.FieldDescriptorProto_LABEL_REPEATED {
+			if buf, err = d.marshalField(buf, f, v); err != nil {
+				return buf, errors.Errorf("%s: %w", f.GetName(), err)
+			}
+			continue
+		}
+		vv, ok := v.([]interface{})
+		if !ok {
+			return buf, errors.Errorf("%s: wanted array, got %T: %w", f.GetName(), v, oracall.ErrInvalidArgument)
+		}
+		if len(vv) == 0 {
+			continue
+		}
+		if wireType(f.GetType()) == wireBytes {
+			for i, v := range vv {
+				if buf, err = d.marshalField(buf, f, v); err != nil {
+					return buf, errors.Errorf("%s[%d]: %w", f.GetName(), i, err)
+				}
+			}
+			continue
+		}
+		// packed
+		var packed []byte
+		for i, v := range vv {
+			if packed, err = d.marshalValue(packed, f, v); err != nil {
+				return buf, errors.Errorf("%s[%d]: %w", f.GetName(), i, err)
+			}
+		}
+		buf = appendUvarint(buf, uint64(f.GetNumber())<<3|wireBytes)
+		buf = appendUvarint(buf, uint64(len(packed)))
+		buf = append(buf, packed...)
+	}
+	return buf, nil
+}
+
+func (d *Descriptors) marshalField(buf []byte, f *descriptor.FieldDescriptorProto, v interface{}) ([]byte, error) {
+	buf = appendUvarint(buf, uint64(f.GetNumber())<<3|wireType(f.GetType()))
+	return d.marshalValue(buf, f, v)
+}
+
+func (d *Descriptors) marshalValue(buf []byte, f *descriptor.FieldDescriptorProto, v interface{}) ([]byte, error) {
+	switch f.GetType() {
+	case descriptor.FieldDescriptorProto_TYPE_STRING:
+		s := dynString(v)
+		buf = appendUvarint(buf, uint64(len(s)))
+		return append(buf, s...), nil
+	case descriptor.FieldDescriptorProto_TYPE_BYTES:
+		var b []byte
+		switch x := v.(type) {
+		case []byte:
+			b = x
+		case string:
+			var err error
+			if b, err = base64.StdEncoding.DecodeString(x); err != nil {
+				return buf, errors.Errorf("%q: %v: %w", x, err, oracall.ErrInvalidArgument)
+			}
+		default:
+			return buf, errors.Errorf("wanted bytes, got %T: %w", v, oracall.ErrInvalidArgument)
+		}
+		buf = appendUvarint(buf, uint64(len(b)))
+		return append(buf, b...), nil
+	case descriptor.FieldDescriptorProto_TYPE_BOOL:
+		b, ok := v.(bool)
+		if !ok {
+			var err error
+			if b, err = strconv.ParseBool(dynString(v)); err != nil {
+				return buf, errors.Errorf("wanted bool, got %v: %w", v, oracall.ErrInvalidArgument)
+			}
+		}
+		if b {
+			return append(buf, 1), nil
+		}
+		return append(buf, 0), nil
+	case descriptor.FieldDescriptorProto_TYPE_SINT32:
+		i, err := dynInt64(v)
+		if err != nil {
+			return buf, err
+		}
+		return appendUvarint(buf, uint64(uint32((int32(i)<<1)^(int32(i)>>31)))), nil
+	case descriptor.FieldDescriptorProto_TYPE_INT32, descriptor.FieldDescriptorProto_TYPE_INT64:
+		i, err := dynInt64(v)
+		if err != nil {
+			return buf, err
+		}
+		return appendUvarint(buf, uint64(i)), nil
+	case descriptor.FieldDescriptorProto_TYPE_DOUBLE:
+		x, err := dynFloat64(v)
+		if err != nil {
+			return buf, err
+		}
+		return appendFixed64(buf, math.Float64bits(x)), nil
+	case descriptor.FieldDescriptorProto_TYPE_MESSAGE:
+		var sub []byte
+		if f.GetTypeName() == timestampTypeName {
+			t, err := dynTime(v)
+			if err != nil {
+				return buf, err
+			}
+			if !t.IsZero() {
+				sub = appendUvarint(sub, 1<<3|wireVarint)
+				sub = appendUvarint(sub, uint64(t.Unix()))
+				if ns := t.Nanosecond(); ns != 0 {
+					sub = appendUvarint(sub, 2<<3|wireVarint)
+					sub = appendUvarint(sub, uint64(ns))
+				}
+			}
+		} else {
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return buf, errors.Errorf("wanted object, got %T: %w", v, oracall.ErrInvalidArgument)
+			}
+			desc, ok := d.messages[strings.TrimPrefix(f.GetTypeName(), ".")]
+			if !ok {
+				return buf, errors.Errorf("%s: unknown message", f.GetTypeName())
+			}
+			var err error
+			if sub, err = d.marshal(nil, desc, m); err != nil {
+				return buf, err
+			}
+		}
+		buf = appendUvarint(buf, uint64(len(sub)))
+		return append(buf, sub...), nil
+	}
+	return buf, errors.Errorf("%s: unsupported type %s", f.GetName(), f.GetType())
+}
+
+var errTruncated = errors.New("truncated message")
+
+func (d *Descriptors) unmarshal(b []byte, desc *descriptor.DescriptorProto) (map[string]interface{}, error) {
+	fields := make(map[string]interface{}, len(desc.Field))
+	for len(b) != 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return fields, errTruncated
+		}
+		b = b[n:]
+		var x uint64
+		var raw []byte
+		switch wire := key & 7; wire {
+		case wireVarint:
+			if x, n = binary.Uvarint(b); n <= 0 {
+				return fields, errTruncated
+			}
+			b = b[n:]
+		case wireFixed64:
+			if len(b) < 8 {
+				return fields, errTruncated
+			}
+			x, b = binary.LittleEndian.Uint64(b), b[8:]
+		case wireFixed32:
+			if len(b) < 4 {
+				return fields, errTruncated
+			}
+			x, b = uint64(binary.LittleEndian.Uint32(b)), b[4:]
+		case wireBytes:
+			length, n := binary.Uvarint(b)
+			if n <= 0 || length > uint64(len(b)-n) {
+				return fields, errTruncated
+			}
+			raw, b = b[n:n+int(length)], b[n+int(length):]
+		default:
+			return fields, errors.Errorf("unsupported wire type %d", wire)
+		}
+
+		var f *descriptor.FieldDescriptorProto
+		for _, fd := range desc.Field {
+			if uint64(fd.GetNumber()) == key>>3 {
+				f = fd
+				break
+			}
+		}
+		if f == nil {
+			continue
+		}
+		if f.GetLabel() != descriptor.FieldDescriptorProto_LABEL_REPEATED {
+			v, err := d.unmarshalValue(f, x, raw)
+			if err != nil {
+				return fields, errors.Errorf("%s: %w", f.GetName(), err)
+			}
+			fields[f.GetName()] = v
+			continue
+		}
+		vv, _ := fields[f.GetName()].([]interface{})
+		if key&7 != wireBytes || wireType(f.GetType()) == wireBytes {
+			v, err := d.unmarshalValue(f, x, raw)
+			if err != nil {
+				return fields, errors.Errorf("%s: %w", f.GetName(), err)
+			}
+			fields[f.GetName()] = append(vv, v)
+			continue
+		}
+		// packed
+		for len(raw) != 0 {
+			if wireType(f.GetType()) == wireFixed64 {
+				if len(raw) < 8 {
+					return fields, errTruncated
+				}
+				x, raw = binary.LittleEndian.Uint64(raw), raw[8:]
+			} else {
+				if x, n = binary.Uvarint(raw); n <= 0 {
+					return fields, errTruncated
+				}
+				raw = raw[n:]
+			}
+			v, err := d.unmarshalValue(f, x, nil)
+			if err != nil {
+				return fields, errors.Errorf("%s: %w", f.GetName(), err)
+			}
+			vv = append(vv, v)
+		}
+		fields[f.GetName()] = vv
+	}
+	return fields, nil
+}
+
+func (d *Descriptors) unmarshalValue(f *descriptor.FieldDescriptorProto, x uint64, raw []byte) (interface{}, error) {
+	switch f.GetType() {
+	case descriptor.FieldDescriptorProto_TYPE_STRING:
+		return string(raw), nil
+	case descriptor.FieldDescriptorProto_TYPE_BYTES:
+		return append([]byte(nil), raw...), nil
+	case descriptor.FieldDescriptorProto_TYPE_BOOL:
+		return x != 0, nil
+	case descriptor.FieldDescriptorProto_TYPE_SINT32:
+		return int32(uint32(x)>>1) ^ -int32(x&1), nil
+	case descriptor.FieldDescriptorProto_TYPE_INT32:
+		return int32(x), nil
+	case descriptor.FieldDescriptorProto_TYPE_INT64:
+		return int64(x), nil
+	case descriptor.FieldDescriptorProto_TYPE_DOUBLE:
+		return math.Float64frombits(x), nil
+	case descriptor.FieldDescriptorProto_TYPE_MESSAGE:
+		if f.GetTypeName() != timestampTypeName {
+			desc, ok := d.messages[strings.TrimPrefix(f.GetTypeName(), ".")]
+			if !ok {
+				return nil, errors.Errorf("%s: unknown message", f.GetTypeName())
+			}
+			return d.unmarshal(raw, desc)
+		}
+		var sec, nsec int64
+		for len(raw) != 0 {
+			key, n := binary.Uvarint(raw)
+			if n <= 0 || key&7 != wireVarint {
+				return nil, errors.Errorf("bad Timestamp")
+			}
+			raw = raw[n:]
+			v, n := binary.Uvarint(raw)
+			if n <= 0 {
+				return nil, errTruncated
+			}
+			raw = raw[n:]
+			switch key >> 3 {
+			case 1:
+				sec = int64(v)
+			case 2:
+				nsec = int64(int32(v))
+			}
+		}
+		if sec == 0 && nsec == 0 {
+			// the zero time is sent as an empty Timestamp
+			return time.Time{}, nil
+		}
+		return time.Unix(sec, nsec), nil
+	}
+	return nil, errors.Errorf("%s: unsupported type %s", f.GetName(), f.GetType())
+}
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+func wireType(typ descriptor.FieldDescriptorProto_Type) uint64 {
+	switch typ {
+	case descriptor.FieldDescriptorProto_TYPE_STRING, descriptor.FieldDescriptorProto_TYPE_BYTES, descriptor.FieldDescriptorProto_TYPE_MESSAGE:
+		return wireBytes
+	case descriptor.FieldDescriptorProto_TYPE_DOUBLE:
+		return wireFixed64
+	default:
+		return wireVarint
+	}
+}
+
+// dynString returns the value as a string - the numbers and dates from the REF CURSORs can come in string fields.
+func dynString(v interface{}) string {
+	switch x := v.(type) {
+	case string:
+		return x
+	case []byte:
+		return string(x)
+	case time.Time:
+		return x.Format(time.RFC3339)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+func dynInt64(v interface{}) (int64, error) {
+	switch x := v.(type) {
+	case int64:
+		return x, nil
+	case int32:
+		return int64(x), nil
+	case int:
+		return int64(x), nil
+	case float64:
+		return int64(x), nil
+	case bool:
+		if x {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	s := dynString(v)
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i, nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, errors.Errorf("wanted integer, got %q: %w", s, oracall.ErrInvalidArgument)
+	}
+	return int64(f), nil
+}
+
+func dynFloat64(v interface{}) (float64, error) {
+	switch x := v.(type) {
+	case float64:
+		return x, nil
+	case int64:
+		return float64(x), nil
+	case int32:
+		return float64(x), nil
+	case int:
+		return float64(x), nil
+	}
+	s := dynString(v)
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, errors.Errorf("wanted number, got %q: %w", s, oracall.ErrInvalidArgument)
+	}
+	return f, nil
+}
+
+func dynTime(v interface{}) (time.Time, error) {
+	switch x := v.(type) {
+	case time.Time:
+		return x, nil
+	case string:
+		if x == "" {
+			return time.Time{}, nil
+		}
+		t, err := time.Parse(time.RFC3339, x)
+		if err != nil {
+			return t, errors.Errorf("%q: %v: %w", x, err, oracall.ErrInvalidArgument)
+		}
+		return t, nil
+	}
+	return time.Time{}, errors.Errorf("wanted time, got %T: %w", v, oracall.ErrInvalidArgument)
+}
+
+func appendUvarint(buf []byte, x uint64) []byte {
+	var a [binary.MaxVarintLen64]byte
+	return append(buf, a[:binary.PutUvarint(a[:], x)]...)
+}
+
+func appendFixed64(buf []byte, x uint64) []byte {
+	var a [8]byte
+	binary.LittleEndian.PutUint64(a[:], x)
+	return append(buf, a[:]...)
+}
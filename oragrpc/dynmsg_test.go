@@ -0,0 +1,203 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oragrpc
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/gogo/protobuf/protoc-gen-gogo/descriptor"
+	"github.com/gogo/protobuf/types"
+)
+
+func TestDynamicMessage(t *testing.T) {
+	rec := &descriptor.DescriptorProto{Name: proto.String("Rec"), Field: []*descriptor.FieldDescriptorProto{
+		{Name: proto.String("id"), Number: proto.Int32(1), Type: descriptor.FieldDescriptorProto_TYPE_INT64.Enum()},
+	}}
+	repeated := descriptor.FieldDescriptorProto_LABEL_REPEATED.Enum()
+	msg := &descriptor.DescriptorProto{Name: proto.String("Msg"), Field: []*descriptor.FieldDescriptorProto{
+		{Name: proto.String("s"), Number: proto.Int32(1), Type: descriptor.FieldDescriptorProto_TYPE_STRING.Enum()},
+		{Name: proto.String("i"), Number: proto.Int32(2), Type: descriptor.FieldDescriptorProto_TYPE_SINT32.Enum()},
+		{Name: proto.String("d"), Number: proto.Int32(3), Type: descriptor.FieldDescriptorProto_TYPE_DOUBLE.Enum()},
+		{Name: proto.String("t"), Number: proto.Int32(4), Type: descriptor.FieldDescriptorProto_TYPE_MESSAGE.Enum(), TypeName: proto.String(timestampTypeName)},
+		{Name: proto.String("ii"), Number: proto.Int32(5), Type: descriptor.FieldDescriptorProto_TYPE_SINT32.Enum(), Label: repeated},
+		{Name: proto.String("recs"), Number: proto.Int32(6), Type: descriptor.FieldDescriptorProto_TYPE_MESSAGE.Enum(), TypeName: proto.String(".pkg.Rec"), Label: repeated},
+		{Name: proto.String("b"), Number: proto.Int32(7), Type: descriptor.FieldDescriptorProto_TYPE_BYTES.Enum()},
+	}}
+	ds := &Descriptors{messages: map[string]*descriptor.DescriptorProto{"pkg.Rec": rec, "pkg.Msg": msg}}
+
+	m, err := ds.NewMessage(".pkg.Msg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().Truncate(time.Microsecond)
+	m.Fields = map[string]interface{}{
+		"s": "árvíztűrő", "i": int32(-3), "d": 3.14, "t": now,
+		"ii":   []interface{}{int32(1), int32(-2)},
+		"recs": []interface{}{map[string]interface{}{"id": int64(1)}, map[string]interface{}{"id": int64(2)}},
+		"b":    []byte("bytes"),
+	}
+	b, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := m.Fields
+	if err = m.Unmarshal(b); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.Fields["t"].(time.Time); !got.Equal(now) {
+		t.Errorf("t: got %v, wanted %v", got, now)
+	}
+	m.Fields["t"] = now
+	if !reflect.DeepEqual(m.Fields, want) {
+		t.Errorf("got %#v,\nwanted %#v", m.Fields, want)
+	}
+
+	// the numbers from the REF CURSORs can come as strings
+	m.Fields = map[string]interface{}{"i": "12", "d": "1.5"}
+	if b, err = m.Marshal(); err != nil {
+		t.Fatal(err)
+	}
+	if err = m.Unmarshal(b); err != nil {
+		t.Fatal(err)
+	}
+	if m.Fields["i"] != int32(12) || m.Fields["d"] != 1.5 {
+		t.Errorf("got %#v", m.Fields)
+	}
+}
+
+// gogoRow and gogoMessage are marshaled by gogo/protobuf, as the messages generated from the .proto,
+// with the same wire types (and packed repeated fields) as protoc-gen-gogo generates.
+type gogoRow struct {
+	Id   int32  `protobuf:"zigzag32,1,opt,name=id,proto3" json:"id,omitempty"`
+	Name string `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+}
+
+func (m *gogoRow) Reset()         { *m = gogoRow{} }
+func (m *gogoRow) String() string { return proto.CompactTextString(m) }
+func (*gogoRow) ProtoMessage()    {}
+
+type gogoMessage struct {
+	Num   int32            `protobuf:"varint,1,opt,name=num,proto3" json:"num,omitempty"`
+	Sint  int32            `protobuf:"zigzag32,2,opt,name=sint,proto3" json:"sint,omitempty"`
+	Long  int64            `protobuf:"varint,3,opt,name=long,proto3" json:"long,omitempty"`
+	Nums  []int32          `protobuf:"zigzag32,4,rep,packed,name=nums,proto3" json:"nums,omitempty"`
+	Dbls  []float64        `protobuf:"fixed64,5,rep,packed,name=dbls,proto3" json:"dbls,omitempty"`
+	Flags []bool           `protobuf:"varint,6,rep,packed,name=flags,proto3" json:"flags,omitempty"`
+	Ts    *types.Timestamp `protobuf:"bytes,7,opt,name=ts,proto3" json:"ts,omitempty"`
+	Rows  []*gogoRow       `protobuf:"bytes,8,rep,name=rows,proto3" json:"rows,omitempty"`
+	Names []string         `protobuf:"bytes,9,rep,name=names,proto3" json:"names,omitempty"`
+}
+
+func (m *gogoMessage) Reset()         { *m = gogoMessage{} }
+func (m *gogoMessage) String() string { return proto.CompactTextString(m) }
+func (*gogoMessage) ProtoMessage()    {}
+
+func TestDynamicMessageGogo(t *testing.T) {
+	field := func(name string, number int32, typ descriptor.FieldDescriptorProto_Type, repeated bool, typeName string) *descriptor.FieldDescriptorProto {
+		f := &descriptor.FieldDescriptorProto{Name: proto.String(name), Number: proto.Int32(number), Type: typ.Enum()}
+		if repeated {
+			f.Label = descriptor.FieldDescriptorProto_LABEL_REPEATED.Enum()
+		}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	row := &descriptor.DescriptorProto{Name: proto.String("Row"), Field: []*descriptor.FieldDescriptorProto{
+		field("id", 1, descriptor.FieldDescriptorProto_TYPE_SINT32, false, ""),
+		field("name", 2, descriptor.FieldDescriptorProto_TYPE_STRING, false, ""),
+	}}
+	msg := &descriptor.DescriptorProto{Name: proto.String("Msg"), Field: []*descriptor.FieldDescriptorProto{
+		field("num", 1, descriptor.FieldDescriptorProto_TYPE_INT32, false, ""),
+		field("sint", 2, descriptor.FieldDescriptorProto_TYPE_SINT32, false, ""),
+		field("long", 3, descriptor.FieldDescriptorProto_TYPE_INT64, false, ""),
+		field("nums", 4, descriptor.FieldDescriptorProto_TYPE_SINT32, true, ""),
+		field("dbls", 5, descriptor.FieldDescriptorProto_TYPE_DOUBLE, true, ""),
+		field("flags", 6, descriptor.FieldDescriptorProto_TYPE_BOOL, true, ""),
+		field("ts", 7, descriptor.FieldDescriptorProto_TYPE_MESSAGE, false, timestampTypeName),
+		field("rows", 8, descriptor.FieldDescriptorProto_TYPE_MESSAGE, true, ".pkg.Row"),
+		field("names", 9, descriptor.FieldDescriptorProto_TYPE_STRING, true, ""),
+	}}
+	ds := &Descriptors{messages: map[string]*descriptor.DescriptorProto{"pkg.Row": row, "pkg.Msg": msg}}
+
+	for i, ts := range []time.Time{
+		time.Date(1969, 12, 31, 23, 59, 59, 500000000, time.UTC), // negative seconds
+		time.Date(2020, 2, 29, 12, 34, 56, 789000000, time.UTC),
+	} {
+		pts, err := types.TimestampProto(ts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ref := &gogoMessage{
+			Num: -5, Sint: -7, Long: -1 << 40,
+			Nums:  []int32{-1, 0, 2147483647, -2147483648},
+			Dbls:  []float64{-1.5, 0, 1e300},
+			Flags: []bool{true, false, true},
+			Ts:    pts,
+			Rows:  []*gogoRow{{Id: -1, Name: "árvíztűrő"}, {Id: 2}},
+			Names: []string{"a", "", "c"},
+		}
+		fields := map[string]interface{}{
+			"num": int32(-5), "sint": int32(-7), "long": int64(-1 << 40),
+			"nums":  []interface{}{int32(-1), int32(0), int32(2147483647), int32(-2147483648)},
+			"dbls":  []interface{}{-1.5, 0.0, 1e300},
+			"flags": []interface{}{true, false, true},
+			"ts":    ts,
+			"rows": []interface{}{
+				map[string]interface{}{"id": int32(-1), "name": "árvíztűrő"},
+				map[string]interface{}{"id": int32(2)},
+			},
+			"names": []interface{}{"a", "", "c"},
+		}
+
+		// gogo -> dynamic
+		b, err := proto.Marshal(ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := ds.NewMessage("pkg.Msg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = m.Unmarshal(b); err != nil {
+			t.Fatalf("%d. %+v", i, err)
+		}
+		if got, ok := m.Fields["ts"].(time.Time); !ok || !got.Equal(ts) {
+			t.Errorf("%d. ts: got %v, wanted %v", i, m.Fields["ts"], ts)
+		}
+		m.Fields["ts"] = ts
+		if !reflect.DeepEqual(m.Fields, fields) {
+			t.Errorf("%d. got %#v,\nwanted %#v", i, m.Fields, fields)
+		}
+
+		// dynamic -> gogo
+		m.Fields = fields
+		if b, err = m.Marshal(); err != nil {
+			t.Fatal(err)
+		}
+		var got gogoMessage
+		if err = proto.Unmarshal(b, &got); err != nil {
+			t.Fatalf("%d. %+v", i, err)
+		}
+		if !proto.Equal(&got, ref) {
+			t.Errorf("%d. got %s,\nwanted %s", i, &got, ref)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oragrpc
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gogo/protobuf/proto"
+	oracall "github.com/tgulacsi/oracall/lib"
+	errors "golang.org/x/xerrors"
+	"google.golang.org/grpc/status"
+)
+
+// OraErrorDetail is the detail of the gRPC status of the calls failed with an Oracle error (added by orasrv),
+// from which the generated client returns an *OraError.
+type OraErrorDetail struct {
+	Code    int32  `protobuf:"varint,1,opt,name=code,proto3" json:"code,omitempty"`
+	Message string `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+}
+
+func (m OraErrorDetail) ProtoMessage()   {}
+func (m *OraErrorDetail) Reset()         { *m = OraErrorDetail{} }
+func (m *OraErrorDetail) String() string { return proto.CompactTextString(m) }
+
+// XXX_MessageName returns the name of the message, for the type URL of the detail.
+func (m *OraErrorDetail) XXX_MessageName() string { return oraErrorDetailName }
+
+const oraErrorDetailName = "oracall.OraErrorDetail"
+
+// NewOraErrorDetail returns the detail of the Oracle error (as returned by godror) in the chain of err, if there is one.
+func NewOraErrorDetail(err error) (*OraErrorDetail, bool) {
+	var oe interface {
+		Code() int
+		Message() string
+	}
+	if err == nil || !errors.As(err, &oe) {
+		return nil, false
+	}
+	return &OraErrorDetail{Code: int32(oe.Code()), Message: oe.Message()}, true
+}
+
+// FieldErrorDetail is the detail of the gRPC status of the calls failed with an oracall.FieldError (added by orasrv).
+type FieldErrorDetail struct {
+	Field  string `protobuf:"bytes,1,opt,name=field,proto3" json:"field,omitempty"`
+	Reason string `protobuf:"bytes,2,opt,name=reason,proto3" json:"reason,omitempty"`
+}
+
+func (m FieldErrorDetail) ProtoMessage()   {}
+func (m *FieldErrorDetail) Reset()         { *m = FieldErrorDetail{} }
+func (m *FieldErrorDetail) String() string { return proto.CompactTextString(m) }
+
+// XXX_MessageName returns the name of the message, for the type URL of the detail.
+func (m *FieldErrorDetail) XXX_MessageName() string { return "oracall.FieldErrorDetail" }
+
+// NewFieldErrorDetail returns the detail of the oracall.FieldError in the chain of err, if there is one.
+func NewFieldErrorDetail(err error) (*FieldErrorDetail, bool) {
+	var fe *oracall.FieldError
+	if err == nil || !errors.As(err, &fe) {
+		return nil, false
+	}
+	return &FieldErrorDetail{Field: fe.Field, Reason: fe.Reason}, true
+}
+
+// OraError is an Oracle error, as returned by the generated clients,
+// translated from the OraErrorDetail of the gRPC status.
+//
+// Its GRPCStatus returns the status, so status.Code works on it, and Unwrap returns the original error.
+type OraError struct {
+	Code    int
+	Message string
+
+	err error
+}
+
+func (e *OraError) Error() string {
+	if strings.HasPrefix(e.Message, "ORA-") {
+		return e.Message
+	}
+	return fmt.Sprintf("ORA-%05d: %s", e.Code, e.Message)
+}
+
+// Unwrap returns the status error.
+func (e *OraError) Unwrap() error { return e.err }
+
+// GRPCStatus returns the status of the call.
+func (e *OraError) GRPCStatus() *status.Status { return status.Convert(e.err) }
+
+// ClientError translates the status error with an OraErrorDetail into an *OraError,
+// and returns the other errors as is.
+func ClientError(err error) error {
+	if err == nil {
+		return nil
+	}
+	s, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	for _, d := range s.Proto().GetDetails() {
+		if !strings.HasSuffix(d.GetTypeUrl(), "/"+oraErrorDetailName) {
+			continue
+		}
+		var detail OraErrorDetail
+		if proto.Unmarshal(d.GetValue(), &detail) == nil {
+			return &OraError{Code: int(detail.Code), Message: detail.Message, err: err}
+		}
+	}
+	return err
+}
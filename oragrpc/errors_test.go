@@ -0,0 +1,60 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oragrpc
+
+import (
+	"testing"
+
+	oracall "github.com/tgulacsi/oracall/lib"
+	errors "golang.org/x/xerrors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestNewFieldErrorDetail(t *testing.T) {
+	err := errors.Errorf("check: %w", &oracall.FieldError{Field: "p_tab[1].name", Reason: "is required"})
+	detail, ok := NewFieldErrorDetail(err)
+	if !ok || detail.Field != "p_tab[1].name" || detail.Reason != "is required" {
+		t.Errorf("got %v (%t)", detail, ok)
+	}
+	if _, ok = NewFieldErrorDetail(oracall.ErrInvalidArgument); ok {
+		t.Error("detail of a plain ErrInvalidArgument")
+	}
+}
+
+func TestClientError(t *testing.T) {
+	s, err := status.New(codes.Unknown, "ORA-20001: bad").WithDetails(&OraErrorDetail{Code: 20001, Message: "ORA-20001: bad"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ClientError(s.Err())
+	var oe *OraError
+	if !errors.As(err, &oe) {
+		t.Fatalf("got %#v, wanted *OraError", err)
+	}
+	if oe.Code != 20001 || oe.Error() != "ORA-20001: bad" {
+		t.Errorf("got %d %q", oe.Code, oe.Error())
+	}
+	if status.Code(err) != codes.Unknown {
+		t.Errorf("got code %v, wanted Unknown", status.Code(err))
+	}
+
+	plain := status.Error(codes.NotFound, "nope")
+	if got := ClientError(plain); got != plain {
+		t.Errorf("got %#v, wanted the status error as is", got)
+	}
+}
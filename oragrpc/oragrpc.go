@@ -0,0 +1,54 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package oragrpc contains the gRPC and Protocol Buffers parts of the runtime of the generated servers and clients,
+// and of orasrv: the error details, the client call options, the stream adapter,
+// and the in-memory descriptors of the dynamic server.
+//
+// The plain Go API (see oracall.SaveGoAPI) does not use it.
+package oragrpc
+
+import (
+	"context"
+	"io"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// SendStream is a grpc.ServerStream calling SendFunc with each sent message,
+// for calling the streaming methods without gRPC.
+type SendStream struct {
+	Ctx      context.Context
+	SendFunc func(interface{}) error
+}
+
+// SetHeader does nothing.
+func (s SendStream) SetHeader(metadata.MD) error { return nil }
+
+// SendHeader does nothing.
+func (s SendStream) SendHeader(metadata.MD) error { return nil }
+
+// SetTrailer does nothing.
+func (s SendStream) SetTrailer(metadata.MD) {}
+
+// Context returns Ctx.
+func (s SendStream) Context() context.Context { return s.Ctx }
+
+// SendMsg calls SendFunc.
+func (s SendStream) SendMsg(m interface{}) error { return s.SendFunc(m) }
+
+// RecvMsg returns io.EOF, as the input is passed as an argument.
+func (s SendStream) RecvMsg(interface{}) error { return io.EOF }
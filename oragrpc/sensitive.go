@@ -0,0 +1,160 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oragrpc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/gogo/protobuf/protoc-gen-gogo/descriptor"
+	golangproto "github.com/golang/protobuf/proto"
+	oracall "github.com/tgulacsi/oracall/lib"
+)
+
+// DescriptorProto is the file of google.protobuf.FieldOptions, the dependency of oracall.OptionsProto.
+const DescriptorProto = "google/protobuf/descriptor.proto"
+
+// E_Sensitive is the (oracall.sensitive) field option of oracall.OptionsProto (oracall.proto in this directory),
+// marking the field to be redacted in the logs.
+var E_Sensitive = &proto.ExtensionDesc{
+	ExtendedType:  (*descriptor.FieldOptions)(nil),
+	ExtensionType: (*bool)(nil),
+	Field:         50601,
+	Name:          "oracall.sensitive",
+	Tag:           "varint,50601,opt,name=sensitive",
+	Filename:      oracall.OptionsProto,
+}
+
+// OptionsFile is the descriptor of oracall.OptionsProto.
+var OptionsFile = &descriptor.FileDescriptorProto{
+	Name:       proto.String(oracall.OptionsProto),
+	Package:    proto.String("oracall"),
+	Dependency: []string{DescriptorProto},
+	Extension: []*descriptor.FieldDescriptorProto{{
+		Name:     proto.String("sensitive"),
+		Number:   proto.Int32(E_Sensitive.Field),
+		Label:    descriptor.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		Type:     descriptor.FieldDescriptorProto_TYPE_BOOL.Enum(),
+		Extendee: proto.String(".google.protobuf.FieldOptions"),
+		JsonName: proto.String("sensitive"),
+	}},
+	Options: &descriptor.FileOptions{GoPackage: proto.String("github.com/tgulacsi/oracall/oragrpc")},
+	Syntax:  proto.String("proto3"),
+}
+
+func init() {
+	proto.RegisterExtension(E_Sensitive)
+	b, err := proto.Marshal(OptionsFile)
+	if err != nil {
+		panic(err)
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(b)
+	zw.Close()
+	// in the golang/protobuf registry, too, for the gRPC server reflection of the generated .proto files
+	proto.RegisterFile(oracall.OptionsProto, buf.Bytes())
+	golangproto.RegisterFile(oracall.OptionsProto, buf.Bytes())
+}
+
+// IsSensitive reports whether the field has the (oracall.sensitive) option.
+func IsSensitive(f *descriptor.FieldDescriptorProto) bool {
+	if f.GetOptions() == nil {
+		return false
+	}
+	v, err := proto.GetExtension(f.GetOptions(), E_Sensitive)
+	if err != nil {
+		return false
+	}
+	b, ok := v.(*bool)
+	return ok && b != nil && *b
+}
+
+// setSensitive sets the (oracall.sensitive) option of the field.
+func setSensitive(f *descriptor.FieldDescriptorProto) error {
+	if f.Options == nil {
+		f.Options = new(descriptor.FieldOptions)
+	}
+	return proto.SetExtension(f.Options, E_Sensitive, proto.Bool(true))
+}
+
+var sensitivePaths sync.Map // reflect.Type of the generated messages -> []string
+
+// SensitivePaths returns the paths (see oracall.RegisterSensitive) of the fields of the message
+// marked with the (oracall.sensitive) option, read from the descriptor of the message:
+// a DynamicMessage, or a generated message with a Descriptor method. It returns nil for other messages.
+func SensitivePaths(msg interface{}) []string {
+	switch m := msg.(type) {
+	case *DynamicMessage:
+		return m.descs.sensitivePaths(m.desc)
+	case descriptor.Message:
+		t := reflect.TypeOf(msg)
+		if paths, ok := sensitivePaths.Load(t); ok {
+			return paths.([]string)
+		}
+		fd, md := descriptor.ForMessage(m)
+		messages := make(map[string]*descriptor.DescriptorProto, len(fd.MessageType))
+		prefix := "."
+		if fd.GetPackage() != "" {
+			prefix += fd.GetPackage() + "."
+		}
+		for _, mt := range fd.MessageType {
+			messages[prefix+mt.GetName()] = mt
+		}
+		paths := walkSensitive(md, "", func(typeName string) *descriptor.DescriptorProto { return messages[typeName] }, nil)
+		sensitivePaths.Store(t, paths)
+		return paths
+	}
+	return nil
+}
+
+// sensitivePaths returns the paths of the sensitive fields of the message of the descriptors.
+func (d *Descriptors) sensitivePaths(desc *descriptor.DescriptorProto) []string {
+	return walkSensitive(desc, "", func(typeName string) *descriptor.DescriptorProto {
+		return d.messages[strings.TrimPrefix(typeName, ".")]
+	}, nil)
+}
+
+// walkSensitive returns the paths of the sensitive fields of the message, and of its sub-messages found by lookup,
+// prefixed with prefix. The messages on the stack are not walked again.
+func walkSensitive(desc *descriptor.DescriptorProto, prefix string, lookup func(string) *descriptor.DescriptorProto, stack []*descriptor.DescriptorProto) []string {
+	for _, m := range stack {
+		if m == desc {
+			return nil
+		}
+	}
+	stack = append(stack, desc)
+	var paths []string
+	for _, f := range desc.Field {
+		path := prefix + f.GetName()
+		if IsSensitive(f) {
+			paths = append(paths, path)
+			continue
+		}
+		if f.GetType() != descriptor.FieldDescriptorProto_TYPE_MESSAGE {
+			continue
+		}
+		if sub := lookup(f.GetTypeName()); sub != nil {
+			paths = append(paths, walkSensitive(sub, path+".", lookup, stack)...)
+		}
+	}
+	return paths
+}
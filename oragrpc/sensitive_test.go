@@ -0,0 +1,125 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oragrpc
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	protoparser "github.com/emicklei/proto"
+	"github.com/gogo/protobuf/proto"
+	"github.com/tgulacsi/go/loghlp/kitloghlp"
+	oracall "github.com/tgulacsi/oracall/lib"
+)
+
+// TestSensitiveOption checks that the sensitive arguments get the (oracall.sensitive) option,
+// both in the .proto and in the descriptors, and that SensitivePaths reads it.
+func TestSensitiveOption(t *testing.T) {
+	oracall.Log = kitloghlp.NewTestLogger(t).Log
+	functions := parseCsv(t, strings.NewReader(testCsv))
+	for i, arg := range functions[0].Args {
+		if arg.Name == "p_sessionid" {
+			functions[0].Args[i].Sensitive = true
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := oracall.SaveProtobuf(&buf, functions, "db_web"); err != nil {
+		t.Fatal(err)
+	}
+	src := buf.String()
+	if !strings.Contains(src, `import "`+oracall.OptionsProto+`";`) {
+		t.Errorf("no import of %s in\n%s", oracall.OptionsProto, src)
+	}
+	if !strings.Contains(src, "p_sessionid = 1 [(oracall.sensitive)=true];") {
+		t.Errorf("no sensitive option in\n%s", src)
+	}
+	if _, err := protoparser.NewParser(strings.NewReader(src)).Parse(); err != nil {
+		t.Fatalf("parse %s: %+v", src, err)
+	}
+
+	ds, err := NewDescriptors(functions, "db_web")
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if !hasDependency(ds.File, oracall.OptionsProto) {
+		t.Errorf("dependencies: got %q", ds.File.Dependency)
+	}
+	// the option survives the serialization, as the reflection clients get it
+	b, err := proto.Marshal(ds.File)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds.File.Reset()
+	if err = proto.Unmarshal(b, ds.File); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range ds.Methods {
+		for _, typeName := range []string{m.Input, m.Output} {
+			msg, err := ds.NewMessage(typeName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := SensitivePaths(msg), []string{"p_sessionid"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: got %q, wanted %q", typeName, got, want)
+			}
+		}
+	}
+}
+
+// TestOptionsFile checks that OptionsFile describes oracall.proto.
+func TestOptionsFile(t *testing.T) {
+	fh, err := os.Open("oracall.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+	def, err := protoparser.NewParser(fh).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pkg string
+	for _, e := range def.Elements {
+		if p, ok := e.(*protoparser.Package); ok {
+			pkg = p.Name
+		}
+	}
+	var fields []string
+	protoparser.Walk(def,
+		protoparser.WithMessage(func(m *protoparser.Message) {
+			if !m.IsExtend {
+				return
+			}
+			for _, e := range m.Elements {
+				if f, ok := e.(*protoparser.NormalField); ok {
+					fields = append(fields, m.Name+" "+f.Type+" "+f.Name+" "+strconv.Itoa(f.Sequence))
+				}
+			}
+		}),
+	)
+	if pkg != OptionsFile.GetPackage() {
+		t.Errorf("package: got %q, wanted %q", pkg, OptionsFile.GetPackage())
+	}
+	ext := OptionsFile.Extension[0]
+	if want := []string{"google.protobuf.FieldOptions bool " + ext.GetName() + " " + strconv.Itoa(int(ext.GetNumber()))}; !reflect.DeepEqual(fields, want) {
+		t.Errorf("got %q, wanted %q", fields, want)
+	}
+}
@@ -0,0 +1,182 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package orasrv
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sync/atomic"
+	"time"
+
+	oracall "github.com/tgulacsi/oracall/lib"
+	errors "golang.org/x/xerrors"
+)
+
+// DefaultAuditTable is the default name of the audit table.
+const DefaultAuditTable = "oracall_audit"
+
+// DefaultAuditOutputLimit is the default maximum length of the recorded output summary.
+const DefaultAuditOutputLimit = 2000
+
+// AuditLog writes the calls into an audit table (see DDL), asynchronously,
+// through a bounded queue: when the queue is full, the records are dropped (and counted),
+// so the calls are never blocked by the audit log.
+//
+// Use its DBLog method as the DBLog of the generated server to record the inputs only,
+// or its AfterCall method with the WithAfterCall option to record the outputs, errors and durations, too.
+// Run must be running to write the queued records.
+type AuditLog struct {
+	db    *sql.DB
+	table string
+	queue chan auditRecord
+	// Redact lists the (JSON) field names whose values are redacted in the recorded input and output,
+	// besides the sensitive fields of the messages (registered by the generated code, or marked with the (oracall.sensitive) option).
+	Redact []string
+	// OutputLimit is the maximum length of the recorded output summary.
+	OutputLimit int
+	// Log is called with the errors of the insertion, if not nil.
+	Log func(...interface{}) error
+
+	dropped uint64
+}
+
+type auditRecord struct {
+	FunName, ReqID, User string
+	Input, Output        string
+	OraCode              int
+	Err                  string
+	Duration             time.Duration
+}
+
+var rTableName = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_$#]*(\.[A-Za-z][A-Za-z0-9_$#]*)?$`)
+
+// NewAuditLog returns a new AuditLog writing into the table (DefaultAuditTable if empty) of db,
+// with a queue of queueSize records.
+func NewAuditLog(db *sql.DB, table string, queueSize int) (*AuditLog, error) {
+	if table == "" {
+		table = DefaultAuditTable
+	}
+	if !rTableName.MatchString(table) {
+		return nil, errors.Errorf("bad table name %q: %w", table, oracall.ErrInvalidArgument)
+	}
+	if queueSize <= 0 {
+		queueSize = 1024
+	}
+	return &AuditLog{db: db, table: table, queue: make(chan auditRecord, queueSize), OutputLimit: DefaultAuditOutputLimit}, nil
+}
+
+// DDL returns the CREATE TABLE statement of the audit table.
+func (a *AuditLog) DDL() string {
+	return fmt.Sprintf(`CREATE TABLE %s (
+  created     TIMESTAMP WITH TIME ZONE DEFAULT SYSTIMESTAMP NOT NULL,
+  fun_name    VARCHAR2(128) NOT NULL,
+  req_id      VARCHAR2(64),
+  username    VARCHAR2(128),
+  input       CLOB,
+  output      VARCHAR2(4000),
+  ora_code    NUMBER(5),
+  error       VARCHAR2(4000),
+  duration_ms NUMBER
+)`, a.table)
+}
+
+// Dropped returns the number of records dropped because of the full queue.
+func (a *AuditLog) Dropped() uint64 { return atomic.LoadUint64(&a.dropped) }
+
+// DBLog records the call with its input - usable as the DBLog of the generated server.
+func (a *AuditLog) DBLog(ctx context.Context, _ *sql.DB, funName string, input interface{}) error {
+	a.enqueue(a.newRecord(ctx, funName, input))
+	return nil
+}
+
+// AfterCall records the call with its input, output, error and duration - usable with WithAfterCall.
+func (a *AuditLog) AfterCall(ctx context.Context, ci *oracall.CallInfo) error {
+	rec := a.newRecord(ctx, ci.FunName, ci.Input)
+	rec.Duration = ci.Duration
+	if ci.Err != nil {
+		rec.Err = oracall.Truncate(ci.Err.Error(), 4000)
+		rec.OraCode = OraCode(ci.Err)
+	} else if ci.Output != nil {
+		if b, err := json.Marshal(ci.Output); err == nil {
+			rec.Output = oracall.Truncate(string(redactSensitive(ci.Output, b, a.Redact...)), a.OutputLimit)
+		}
+	}
+	a.enqueue(rec)
+	return nil
+}
+
+func (a *AuditLog) newRecord(ctx context.Context, funName string, input interface{}) auditRecord {
+	rec := auditRecord{FunName: funName, ReqID: oracall.ContextGetReqID(ctx)}
+	if id, ok := oracall.ContextGetIdentity(ctx); ok {
+		rec.User = id.User
+	}
+	if input != nil {
+		if b, err := json.Marshal(input); err == nil {
+			rec.Input = string(redactSensitive(input, b, a.Redact...))
+		}
+	}
+	return rec
+}
+
+func (a *AuditLog) enqueue(rec auditRecord) {
+	select {
+	case a.queue <- rec:
+	default:
+		atomic.AddUint64(&a.dropped, 1)
+	}
+}
+
+// Run writes the queued records into the audit table, till ctx is canceled -
+// then writes the remaining ones, for at most 10 seconds.
+func (a *AuditLog) Run(ctx context.Context) error {
+	qry := "INSERT INTO " + a.table + " (fun_name, req_id, username, input, output, ora_code, error, duration_ms) VALUES (:1, :2, :3, :4, :5, :6, :7, :8)"
+	write := func(ctx context.Context, rec auditRecord) {
+		var oraCode sql.NullInt64
+		if rec.OraCode != 0 {
+			oraCode = sql.NullInt64{Int64: int64(rec.OraCode), Valid: true}
+		}
+		if _, err := a.db.ExecContext(ctx, qry,
+			rec.FunName, rec.ReqID, rec.User, rec.Input, rec.Output, oraCode, rec.Err,
+			float64(rec.Duration)/float64(time.Millisecond),
+		); err != nil && a.Log != nil {
+			a.Log("msg", "audit", "function", rec.FunName, "reqID", rec.ReqID, "error", err)
+		}
+	}
+	for {
+		select {
+		case rec := <-a.queue:
+			write(ctx, rec)
+		case <-ctx.Done():
+			drainCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			for {
+				select {
+				case rec := <-a.queue:
+					write(drainCtx, rec)
+				default:
+					return ctx.Err()
+				}
+				if drainCtx.Err() != nil {
+					return ctx.Err()
+				}
+			}
+		}
+	}
+}
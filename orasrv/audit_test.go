@@ -0,0 +1,111 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package orasrv
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	oracall "github.com/tgulacsi/oracall/lib"
+	"github.com/tgulacsi/oracall/oragrpc"
+	errors "golang.org/x/xerrors"
+)
+
+func TestAuditLog(t *testing.T) {
+	if _, err := NewAuditLog(nil, "x; DROP TABLE y", 1); err == nil {
+		t.Error("wanted error for bad table name")
+	}
+	a, err := NewAuditLog(nil, "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ddl := a.DDL(); !strings.HasPrefix(ddl, "CREATE TABLE "+DefaultAuditTable+" (") {
+		t.Errorf("bad DDL: %s", ddl)
+	}
+	a.Redact = []string{"password"}
+
+	ctx := oracall.ContextWithReqID(context.Background(), "req-1")
+	ctx = oracall.ContextWithIdentity(ctx, oracall.Identity{User: "scott"})
+	input := map[string]string{"name": "x", "password": "secret"}
+	if err := a.AfterCall(ctx, &oracall.CallInfo{
+		FunName: "pkg.fun", Input: input,
+		Err: errors.Errorf("call: %w", oraErr(1403)), Duration: time.Second,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	a.DBLog(ctx, nil, "pkg.fun", input)
+	if got := a.Dropped(); got != 1 {
+		t.Errorf("dropped %d, wanted 1", got)
+	}
+
+	rec := <-a.queue
+	if rec.FunName != "pkg.fun" || rec.ReqID != "req-1" || rec.User != "scott" || rec.OraCode != 1403 || rec.Duration != time.Second {
+		t.Errorf("got %+v", rec)
+	}
+	if strings.Contains(rec.Input, "secret") {
+		t.Errorf("password is not redacted: %s", rec.Input)
+	}
+}
+
+type auditTest_Input struct {
+	Card string `json:"card"`
+	Name string `json:"name"`
+}
+
+// TestRedactSensitive checks that the fields registered by the generated code,
+// and the fields with the (oracall.sensitive) option are redacted - only in their own messages.
+func TestRedactSensitive(t *testing.T) {
+	oracall.RegisterSensitive("auditTest_Input", "card")
+	b, _ := json.Marshal(auditTest_Input{Card: "1234", Name: "x"})
+	if got, want := string(redactSensitive(&auditTest_Input{}, b)), `{"card":"***","name":"x"}`; got != want {
+		t.Errorf("registered: got %s, wanted %s", got, want)
+	}
+	if got := string(redactSensitive(map[string]string{"card": "1234"}, []byte(`{"card":"1234"}`))); got != `{"card":"1234"}` {
+		t.Errorf("other message: got %s", got)
+	}
+
+	functions, err := oracall.ParseCsv(strings.NewReader(dynamicTestCsv), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	functions[0].Args[0].Sensitive = true
+	ds, err := oragrpc.NewDescriptors(functions, "db_pkg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range ds.Methods {
+		msg, err := ds.NewMessage(m.Input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg.Fields = map[string]interface{}{"p_name": "secret"}
+		b, _ := json.Marshal(msg)
+		if got := string(redactSensitive(msg, b)); strings.Contains(got, "secret") {
+			t.Errorf("option: got %s", got)
+		}
+	}
+	// the reflection clients get the file of the option, too
+	if _, err := (dynamicReflection{&Dynamic{}}).fileByName(oracall.OptionsProto); err != nil {
+		t.Error(err)
+	}
+	if _, err := (dynamicReflection{&Dynamic{}}).fileByName(oragrpc.DescriptorProto); err != nil {
+		t.Error(err)
+	}
+}
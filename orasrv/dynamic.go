@@ -0,0 +1,461 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package orasrv
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/gogo/protobuf/protoc-gen-gogo/descriptor"
+	_ "github.com/gogo/protobuf/types" // registers google/protobuf/timestamp.proto
+	oracall "github.com/tgulacsi/oracall/lib"
+	"github.com/tgulacsi/oracall/oragrpc"
+	errors "golang.org/x/xerrors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultDynamicMinReload is the default minimum time between the reloads of Dynamic triggered by unknown methods.
+const DefaultDynamicMinReload = 10 * time.Second
+
+// dynamicBatchSize is the number of REF CURSOR rows sent in one message, as in the generated code.
+const dynamicBatchSize = 128
+
+// Dynamic serves the PL/SQL functions read from the database at runtime, without generated code:
+// the messages are described by the protobuf descriptors built from the functions (the same as SaveProtobuf writes),
+// and the calls are made with InvokeMap.
+//
+// Each PL/SQL package is a service of its own, in a proto package of the lowercase package name
+// (as "oracall -pb-out=pkg:my_pkg" generates it).
+//
+// Handler serves the methods unknown to the grpc.Server (set it with grpc.UnknownServiceHandler),
+// thus the calls go through the stream interceptor of the server (authentication, logging, transactions, metrics).
+// The functions are reloaded every Interval by Run, and when an unknown method is called (at most once in MinReload),
+// so a new procedure becomes callable as soon as it is compiled into the database.
+type Dynamic struct {
+	// DB is the database of the calls.
+	DB *sql.DB
+	// Load reads the functions to be served.
+	Load func(ctx context.Context) ([]oracall.Function, error)
+	// Interval is the period of the reloads of Run.
+	Interval time.Duration
+	// MinReload is the minimum time between the reloads triggered by unknown methods.
+	MinReload time.Duration
+	// SetIdentity is called in the transaction of the call, as the SetIdentity of the generated server.
+	SetIdentity func(context.Context, *sql.Tx, oracall.Identity) error
+	// Log is called with the errors of the reloads, if not nil.
+	// The packages and functions which cannot be described are skipped, the others are served.
+	Log func(...interface{}) error
+
+	loadMu   sync.Mutex
+	lastLoad time.Time
+
+	mu    sync.RWMutex
+	descs map[string]*oragrpc.Descriptors
+}
+
+// Reload reads the functions with Load, and replaces the served descriptors.
+func (d *Dynamic) Reload(ctx context.Context) error {
+	d.loadMu.Lock()
+	defer d.loadMu.Unlock()
+	return d.reload(ctx)
+}
+
+func (d *Dynamic) reload(ctx context.Context) error {
+	d.lastLoad = time.Now()
+	functions, err := d.Load(ctx)
+	if err != nil {
+		return err
+	}
+	byPkg := make(map[string][]oracall.Function)
+	for _, f := range functions {
+		pkg := strings.ToLower(f.Package)
+		if pkg == "" {
+			pkg = "main"
+		}
+		byPkg[pkg] = append(byPkg[pkg], f)
+	}
+	descs := make(map[string]*oragrpc.Descriptors, len(byPkg))
+	for pkg, functions := range byPkg {
+		ds, err := d.newDescriptors(functions, pkg)
+		if err != nil {
+			d.log("msg", "reload", "package", pkg, "error", err)
+			continue
+		}
+		descs[ds.File.GetName()] = ds
+	}
+	d.mu.Lock()
+	d.descs = descs
+	d.mu.Unlock()
+	return nil
+}
+
+// newDescriptors returns the descriptors of the functions of pkg, without the functions which cannot be described.
+func (d *Dynamic) newDescriptors(functions []oracall.Function, pkg string) (*oragrpc.Descriptors, error) {
+	ds, err := oragrpc.NewDescriptors(functions, pkg)
+	if err == nil {
+		return ds, nil
+	}
+	ok := make([]oracall.Function, 0, len(functions))
+	for _, f := range functions {
+		if _, fErr := oragrpc.NewDescriptors([]oracall.Function{f}, pkg); fErr != nil {
+			d.log("msg", "reload", "function", f.Name(), "error", fErr)
+			continue
+		}
+		ok = append(ok, f)
+	}
+	if len(ok) == 0 || len(ok) == len(functions) {
+		return nil, errors.Errorf("%s: %w", pkg, err)
+	}
+	return oragrpc.NewDescriptors(ok, pkg)
+}
+
+func (d *Dynamic) log(keyvals ...interface{}) {
+	if d.Log != nil {
+		d.Log(keyvals...)
+	}
+}
+
+// Run reloads the functions every Interval, till the context is canceled.
+func (d *Dynamic) Run(ctx context.Context) error {
+	if d.Interval <= 0 {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := d.Reload(ctx); err != nil {
+				d.log("msg", "reload", "error", err)
+			}
+		}
+	}
+}
+
+// method returns the method of the full method name, reloading the functions if it is unknown.
+func (d *Dynamic) method(ctx context.Context, fullMethod string) (*oragrpc.Descriptors, oragrpc.DescriptorMethod, error) {
+	if ds, m, ok := d.lookup(fullMethod); ok {
+		return ds, m, nil
+	}
+	minReload := d.MinReload
+	if minReload <= 0 {
+		minReload = DefaultDynamicMinReload
+	}
+	d.loadMu.Lock()
+	var err error
+	if time.Since(d.lastLoad) >= minReload {
+		err = d.reload(ctx)
+	}
+	d.loadMu.Unlock()
+	if err != nil {
+		return nil, oragrpc.DescriptorMethod{}, status.Errorf(codes.Unavailable, "reload: %v", err)
+	}
+	if ds, m, ok := d.lookup(fullMethod); ok {
+		return ds, m, nil
+	}
+	return nil, oragrpc.DescriptorMethod{}, status.Errorf(codes.Unimplemented, "unknown method %q", fullMethod)
+}
+
+func (d *Dynamic) lookup(fullMethod string) (*oragrpc.Descriptors, oragrpc.DescriptorMethod, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, ds := range d.descs {
+		if m, ok := ds.Methods[fullMethod]; ok {
+			return ds, m, true
+		}
+	}
+	return nil, oragrpc.DescriptorMethod{}, false
+}
+
+// Handler serves the call of the stream, as a grpc.StreamHandler.
+func (d *Dynamic) Handler(_ interface{}, stream grpc.ServerStream) error {
+	fullMethod, ok := grpc.MethodFromServerStream(stream)
+	if !ok {
+		return status.Error(codes.Internal, "no method in the stream")
+	}
+	ctx := stream.Context()
+	ds, m, err := d.method(ctx, fullMethod)
+	if err != nil {
+		return err
+	}
+	input, err := ds.NewMessage(m.Input)
+	if err != nil {
+		return err
+	}
+	if err = stream.RecvMsg(input); err != nil {
+		return err
+	}
+
+	tx, finish, err := d.beginTx(ctx, m.IsSessionBound())
+	if err != nil {
+		return err
+	}
+	defer finish(false)
+	fields, err := m.InvokeMap(ctx, tx, input.Fields)
+	if err != nil {
+		return err
+	}
+	output, err := ds.NewMessage(m.Output)
+	if err != nil {
+		return err
+	}
+	if !m.HasCursorOut() {
+		output.Fields = fields
+		if err = finish(true); err != nil {
+			return err
+		}
+		return stream.SendMsg(output)
+	}
+
+	// send the rows of the REF CURSORs in batches, with the other outputs, as the generated code.
+	cursors := make(map[string][]interface{})
+	rest := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		if !isCursor(m.Function, k) {
+			rest[k] = v
+		} else if rows, _ := v.([]interface{}); len(rows) != 0 {
+			cursors[k] = rows
+		}
+	}
+	for first := true; first || len(cursors) != 0; first = false {
+		output.Fields = make(map[string]interface{}, len(fields))
+		for k, v := range rest {
+			output.Fields[k] = v
+		}
+		for k, rows := range cursors {
+			n := len(rows)
+			if n > dynamicBatchSize {
+				n = dynamicBatchSize
+			}
+			output.Fields[k] = rows[:n]
+			if cursors[k] = rows[n:]; len(cursors[k]) == 0 {
+				delete(cursors, k)
+			}
+		}
+		if err = stream.SendMsg(output); err != nil {
+			return err
+		}
+	}
+	return finish(true)
+}
+
+func isCursor(fun oracall.Function, name string) bool {
+	if fun.Returns != nil && fun.Returns.Name == name {
+		return fun.Returns.Type == "REF CURSOR"
+	}
+	for _, a := range fun.Args {
+		if a.Name == name {
+			return a.Type == "REF CURSOR"
+		}
+	}
+	return false
+}
+
+// beginTx begins the transaction of the call, as the beginTx of the generated server.
+func (d *Dynamic) beginTx(ctx context.Context, sessionBound bool) (*sql.Tx, func(commit bool) error, error) {
+	if tx := oracall.ContextGetTx(ctx); tx != nil {
+		if sessionBound {
+			return nil, nil, errors.Errorf("session-bound call in a shared transaction: %w", oracall.ErrInvalidArgument)
+		}
+		return tx, func(bool) error { return nil }, nil
+	}
+	var tx *sql.Tx
+	var err error
+	if sessionBound {
+		conn := oracall.ContextGetConn(ctx)
+		if conn == nil {
+			return nil, nil, oracall.ErrNoSession
+		}
+		tx, err = conn.BeginTx(ctx, nil)
+	} else {
+		tx, err = d.DB.BeginTx(oracall.ContextWithProxyUser(ctx), nil)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	var done bool
+	finish := func(commit bool) error {
+		if done {
+			return nil
+		}
+		done = true
+		if commit && !oracall.IsDryRun(ctx) {
+			return tx.Commit()
+		}
+		err := tx.Rollback()
+		if commit && err == nil {
+			oracall.MarkRolledBack(ctx)
+		}
+		return err
+	}
+	if err = oracall.ApplyIdentity(ctx, tx, d.SetIdentity); err != nil {
+		tx.Rollback()
+		return nil, nil, err
+	}
+	return tx, finish, nil
+}
+
+// Register the server reflection service of the dynamic services on srv - which must not have the standard one
+// (Config.Reflection must be false).
+func (d *Dynamic) Register(srv *grpc.Server) {
+	rpb.RegisterServerReflectionServer(srv, dynamicReflection{d})
+}
+
+const reflectionServiceName = "grpc.reflection.v1alpha.ServerReflection"
+
+// dynamicReflection serves the descriptors of the dynamic services.
+type dynamicReflection struct {
+	*Dynamic
+}
+
+func (r dynamicReflection) ServerReflectionInfo(stream rpb.ServerReflection_ServerReflectionInfoServer) error {
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		resp := &rpb.ServerReflectionResponse{ValidHost: req.Host, OriginalRequest: req}
+		var fd []byte
+		switch mr := req.MessageRequest.(type) {
+		case *rpb.ServerReflectionRequest_FileByFilename:
+			fd, err = r.fileByName(mr.FileByFilename)
+		case *rpb.ServerReflectionRequest_FileContainingSymbol:
+			fd, err = r.fileBySymbol(mr.FileContainingSymbol)
+		case *rpb.ServerReflectionRequest_FileContainingExtension:
+			err = status.Errorf(codes.NotFound, "no extensions")
+		case *rpb.ServerReflectionRequest_AllExtensionNumbersOfType:
+			resp.MessageResponse = &rpb.ServerReflectionResponse_AllExtensionNumbersResponse{
+				AllExtensionNumbersResponse: &rpb.ExtensionNumberResponse{BaseTypeName: mr.AllExtensionNumbersOfType},
+			}
+		case *rpb.ServerReflectionRequest_ListServices:
+			names := append(r.services(), reflectionServiceName)
+			services := make([]*rpb.ServiceResponse, len(names))
+			for i, nm := range names {
+				services[i] = &rpb.ServiceResponse{Name: nm}
+			}
+			resp.MessageResponse = &rpb.ServerReflectionResponse_ListServicesResponse{
+				ListServicesResponse: &rpb.ListServiceResponse{Service: services},
+			}
+		default:
+			return status.Errorf(codes.InvalidArgument, "invalid MessageRequest: %v", req.MessageRequest)
+		}
+		if err != nil {
+			resp.MessageResponse = &rpb.ServerReflectionResponse_ErrorResponse{
+				ErrorResponse: &rpb.ErrorResponse{ErrorCode: int32(status.Code(err)), ErrorMessage: err.Error()},
+			}
+		} else if fd != nil {
+			resp.MessageResponse = &rpb.ServerReflectionResponse_FileDescriptorResponse{
+				FileDescriptorResponse: &rpb.FileDescriptorResponse{FileDescriptorProto: [][]byte{fd}},
+			}
+		}
+		if err = stream.Send(resp); err != nil {
+			return err
+		}
+	}
+}
+
+// services returns the names of the dynamic services, sorted.
+func (r dynamicReflection) services() []string {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.descs))
+	for _, ds := range r.descs {
+		names = append(names, ds.ServiceName())
+	}
+	r.mu.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+// fileByName returns the serialized descriptor of the file, which can be a dependency:
+// google/protobuf/timestamp.proto, or the oracall.OptionsProto of the sensitive fields, with google/protobuf/descriptor.proto.
+func (r dynamicReflection) fileByName(name string) ([]byte, error) {
+	switch name {
+	case oracall.OptionsProto:
+		return proto.Marshal(oragrpc.OptionsFile)
+	case oragrpc.DescriptorProto:
+		// registered as "descriptor.proto" by gogo
+		b, err := registeredFile("descriptor.proto")
+		if err != nil {
+			return nil, err
+		}
+		var fd descriptor.FileDescriptorProto
+		if err = proto.Unmarshal(b, &fd); err != nil {
+			return nil, err
+		}
+		fd.Name = proto.String(name)
+		return proto.Marshal(&fd)
+	case oragrpc.TimestampProto:
+		return registeredFile(name)
+	}
+	r.mu.RLock()
+	ds := r.descs[name]
+	r.mu.RUnlock()
+	if ds == nil {
+		return nil, status.Errorf(codes.NotFound, "unknown file %q", name)
+	}
+	return proto.Marshal(ds.File)
+}
+
+// registeredFile returns the serialized descriptor of the file registered in the gogo/protobuf registry.
+func registeredFile(name string) ([]byte, error) {
+	gz := proto.FileDescriptor(name)
+	if gz == nil {
+		return nil, status.Errorf(codes.NotFound, "%s not registered", name)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(gz))
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(zr)
+}
+
+func (r dynamicReflection) fileBySymbol(name string) ([]byte, error) {
+	name = strings.TrimPrefix(name, ".")
+	if name == "google.protobuf.Timestamp" {
+		return r.fileByName(oragrpc.TimestampProto)
+	}
+	r.mu.RLock()
+	var found *oragrpc.Descriptors
+	for _, ds := range r.descs {
+		if ds.HasSymbol(name) {
+			found = ds
+			break
+		}
+	}
+	r.mu.RUnlock()
+	if found == nil {
+		return nil, status.Errorf(codes.NotFound, "unknown symbol %q", name)
+	}
+	return proto.Marshal(found.File)
+}
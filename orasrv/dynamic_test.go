@@ -0,0 +1,130 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package orasrv
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/gogo/protobuf/protoc-gen-gogo/descriptor"
+	oracall "github.com/tgulacsi/oracall/lib"
+	"github.com/tgulacsi/oracall/oragrpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const dynamicTestCsv = `OBJECT_ID;SUBPROGRAM_ID;PACKAGE_NAME;OBJECT_NAME;DATA_LEVEL;POSITION;ARGUMENT_NAME;IN_OUT;DATA_TYPE;DATA_PRECISION;DATA_SCALE;CHARACTER_SET_NAME;PLS_TYPE;CHAR_LENGTH;TYPE_LINK;TYPE_OWNER;TYPE_NAME;TYPE_SUBNAME
+1;1;DB_PKG;FUN;0;1;P_NAME;IN;VARCHAR2;;;CHAR_CS;VARCHAR2;10;;;;
+1;1;DB_PKG;FUN;0;2;P_DATE;OUT;DATE;;;;DATE;0;;;;
+`
+
+func TestDynamic(t *testing.T) {
+	ctx := context.Background()
+	var loads int
+	d := &Dynamic{Load: func(context.Context) ([]oracall.Function, error) {
+		loads++
+		return oracall.ParseCsv(strings.NewReader(dynamicTestCsv), nil)
+	}}
+	if err := d.Reload(ctx); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	r := dynamicReflection{d}
+	services := r.services()
+	if len(services) != 1 || !strings.HasPrefix(services[0], "db_pkg.") {
+		t.Fatalf("services: got %q", services)
+	}
+	svc := services[0]
+
+	var fullMethod string
+	for _, ds := range d.descs {
+		for k := range ds.Methods {
+			fullMethod = k
+		}
+	}
+	ds, m, err := d.method(ctx, fullMethod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ds.NewMessage(m.Input); err != nil {
+		t.Error(err)
+	}
+
+	// an unknown method triggers a reload, at most once in MinReload
+	if _, _, err = d.method(ctx, "/"+svc+"/Unknown"); status.Code(err) != codes.Unimplemented {
+		t.Errorf("unknown method: got %v", err)
+	}
+	if _, _, err = d.method(ctx, "/"+svc+"/Unknown"); status.Code(err) != codes.Unimplemented {
+		t.Errorf("unknown method: got %v", err)
+	}
+	if loads != 1 {
+		t.Errorf("got %d loads, wanted 1", loads)
+	}
+
+	b, err := r.fileBySymbol(svc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fd descriptor.FileDescriptorProto
+	if err = proto.Unmarshal(b, &fd); err != nil {
+		t.Fatal(err)
+	}
+	if fd.GetName() != "db_pkg.proto" || len(fd.Service) != 1 {
+		t.Errorf("got %s", proto.MarshalTextString(&fd))
+	}
+	if _, err = r.fileByName(oragrpc.TimestampProto); err != nil {
+		t.Errorf("%s: %+v", oragrpc.TimestampProto, err)
+	}
+	if _, err = r.fileBySymbol("no.Such"); status.Code(err) != codes.NotFound {
+		t.Errorf("unknown symbol: got %v", err)
+	}
+}
+
+func TestDynamicReloadSkips(t *testing.T) {
+	defer func(skip bool) { oracall.SkipMissingTableOf = skip }(oracall.SkipMissingTableOf)
+	oracall.SkipMissingTableOf = false
+	const csv = dynamicTestCsv + `2;1;DB_PKG;BAD;0;1;P_FILE;IN;BFILE;;;;BFILE;0;;;;
+3;1;BAD_PKG;BAD;0;1;P_FILE;IN;BFILE;;;;BFILE;0;;;;
+`
+	var logged int
+	d := &Dynamic{
+		Load: func(context.Context) ([]oracall.Function, error) {
+			return oracall.ParseCsv(strings.NewReader(csv), nil)
+		},
+		Log: func(...interface{}) error { logged++; return nil },
+	}
+	if err := d.Reload(context.Background()); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if len(d.descs) != 1 {
+		t.Fatalf("got %d packages, wanted only db_pkg", len(d.descs))
+	}
+	for _, ds := range d.descs {
+		if len(ds.Methods) != 1 {
+			t.Errorf("got %d methods, wanted only FUN", len(ds.Methods))
+		}
+		for _, m := range ds.Methods {
+			if !strings.EqualFold(m.Function.Name(), "DB_PKG.FUN") {
+				t.Errorf("got %s, wanted DB_PKG.FUN", m.Function.Name())
+			}
+		}
+	}
+	if logged == 0 {
+		t.Error("the skipped function and package are not logged")
+	}
+}
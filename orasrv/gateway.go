@@ -0,0 +1,267 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package orasrv
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+	oracall "github.com/tgulacsi/oracall/lib"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultGatewayMaxBodySize is the default maximum size of the request body of the Gateway.
+const DefaultGatewayMaxBodySize = 32 << 20
+
+// Gateway is an HTTP/JSON gateway for the generated services, without gRPC:
+// it calls the method of the PL/SQL function for
+//
+//	POST /{package}/{function}
+//
+// with the JSON of the input message (the same as the generated structs) as the body,
+// and responds with the JSON of the output message, or, for the functions returning REF CURSORs,
+// with the stream of the output messages as NDJSON (one JSON per line, flushed after each).
+//
+// The calls go through the same interceptors (authentication, logging, transactions, metrics) as the gRPC calls,
+// with the HTTP headers as the incoming metadata. The response metadata is returned in the HTTP headers
+// (and trailers, for the streams).
+//
+// The errors are returned as {"code":5,"status":"NotFound","message":"..."}, with the HTTP status mapped from the gRPC code;
+// an error after the start of a stream is returned as the last line, {"error":{...}}.
+type Gateway struct {
+	// MaxBodySize is the maximum size of the request body.
+	MaxBodySize int64
+
+	unary  grpc.UnaryServerInterceptor
+	stream grpc.StreamServerInterceptor
+
+	mu      sync.RWMutex
+	methods map[string]gatewayMethod
+}
+
+type gatewayMethod struct {
+	oracall.MethodDesc
+	fullMethod string
+}
+
+// Gateway returns a new Gateway, with the same logging, authentication and features as the GRPCServer with the same arguments.
+func (conf Config) Gateway(globalCtx context.Context, logger log.Logger, verbose bool, checkAuth func(ctx context.Context, path string) error) *Gateway {
+	unary, stream := conf.interceptors(globalCtx, logger, verbose, checkAuth)
+	return &Gateway{MaxBodySize: DefaultGatewayMaxBodySize, unary: unary, stream: stream, methods: make(map[string]gatewayMethod)}
+}
+
+// Register the methods (see the MethodDescs method of the generated server) of the gRPC service (such as "pkg.Service"),
+// whose full method names are used for the authorization and the logging.
+func (g *Gateway) Register(service string, methods []oracall.MethodDesc) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, m := range methods {
+		g.methods[strings.ToLower(m.Path)] = gatewayMethod{MethodDesc: m, fullMethod: "/" + service + "/" + m.Name}
+	}
+}
+
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "only POST is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	path := strings.ToLower(strings.TrimSuffix(r.URL.Path, "/"))
+	g.mu.RLock()
+	m, ok := g.methods[path]
+	g.mu.RUnlock()
+	if !ok {
+		writeHTTPError(w, status.Errorf(codes.NotFound, "unknown function %q", path))
+		return
+	}
+
+	input := m.NewInput()
+	maxBody := g.MaxBodySize
+	if maxBody <= 0 {
+		maxBody = DefaultGatewayMaxBodySize
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBody)).Decode(input); err != nil && err != io.EOF {
+		writeHTTPError(w, status.Errorf(codes.InvalidArgument, "decode input: %v", err))
+		return
+	}
+
+	md := make(metadata.MD, len(r.Header))
+	for k, vv := range r.Header {
+		md[strings.ToLower(k)] = vv
+	}
+	ts := &gatewayTransportStream{method: m.fullMethod, header: metadata.MD{}, trailer: metadata.MD{}}
+	ctx := grpc.NewContextWithServerTransportStream(metadata.NewIncomingContext(r.Context(), md), ts)
+	ctx = peer.NewContext(ctx, &peer.Peer{Addr: gatewayAddr(r.RemoteAddr)})
+
+	if m.Unary != nil {
+		res, err := g.unary(ctx, input, &grpc.UnaryServerInfo{FullMethod: m.fullMethod},
+			func(ctx context.Context, req interface{}) (interface{}, error) { return m.Unary(ctx, req) })
+		copyMetadata(w.Header(), "", ts.header)
+		copyMetadata(w.Header(), "", ts.trailer)
+		if err != nil {
+			writeHTTPError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(res)
+		return
+	}
+
+	gs := &gatewayStream{ctx: ctx, w: w, ts: ts, enc: json.NewEncoder(w)}
+	err := g.stream(nil, gs, &grpc.StreamServerInfo{FullMethod: m.fullMethod, IsServerStream: true},
+		func(_ interface{}, ss grpc.ServerStream) error { return m.Stream(ss.Context(), input, ss.SendMsg) })
+	if !gs.started {
+		copyMetadata(w.Header(), "", ts.header)
+		copyMetadata(w.Header(), "", ts.trailer)
+		if err != nil {
+			writeHTTPError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if err != nil {
+		_ = gs.enc.Encode(struct {
+			Error httpError `json:"error"`
+		}{newHTTPError(err)})
+	}
+	copyMetadata(w.Header(), http.TrailerPrefix, ts.trailer)
+}
+
+// gatewayStream is the grpc.ServerStream of the streaming calls of the Gateway, writing the messages as NDJSON.
+type gatewayStream struct {
+	ctx     context.Context
+	w       http.ResponseWriter
+	ts      *gatewayTransportStream
+	enc     *json.Encoder
+	started bool
+}
+
+func (s *gatewayStream) SetHeader(md metadata.MD) error  { return s.ts.SetHeader(md) }
+func (s *gatewayStream) SendHeader(md metadata.MD) error { return s.ts.SendHeader(md) }
+func (s *gatewayStream) SetTrailer(md metadata.MD)       { _ = s.ts.SetTrailer(md) }
+func (s *gatewayStream) Context() context.Context        { return s.ctx }
+func (s *gatewayStream) RecvMsg(interface{}) error       { return io.EOF }
+func (s *gatewayStream) SendMsg(m interface{}) error {
+	if !s.started {
+		s.started = true
+		copyMetadata(s.w.Header(), "", s.ts.header)
+		s.w.Header().Set("Content-Type", "application/x-ndjson")
+		s.w.WriteHeader(http.StatusOK)
+	}
+	if err := s.enc.Encode(m); err != nil {
+		return err
+	}
+	if f, ok := s.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// gatewayTransportStream collects the metadata set with grpc.SetHeader and grpc.SetTrailer.
+type gatewayTransportStream struct {
+	method          string
+	mu              sync.Mutex
+	header, trailer metadata.MD
+}
+
+func (ts *gatewayTransportStream) Method() string { return ts.method }
+func (ts *gatewayTransportStream) SetHeader(md metadata.MD) error {
+	ts.mu.Lock()
+	ts.header = metadata.Join(ts.header, md)
+	ts.mu.Unlock()
+	return nil
+}
+func (ts *gatewayTransportStream) SendHeader(md metadata.MD) error { return ts.SetHeader(md) }
+func (ts *gatewayTransportStream) SetTrailer(md metadata.MD) error {
+	ts.mu.Lock()
+	ts.trailer = metadata.Join(ts.trailer, md)
+	ts.mu.Unlock()
+	return nil
+}
+
+func copyMetadata(h http.Header, prefix string, md metadata.MD) {
+	for k, vv := range md {
+		for _, v := range vv {
+			h.Add(prefix+k, v)
+		}
+	}
+}
+
+// gatewayAddr is the address of the HTTP client, as a net.Addr.
+type gatewayAddr string
+
+func (a gatewayAddr) Network() string { return "tcp" }
+func (a gatewayAddr) String() string  { return string(a) }
+
+type httpError struct {
+	Code    codes.Code `json:"code"`
+	Status  string     `json:"status"`
+	Message string     `json:"message"`
+}
+
+func newHTTPError(err error) httpError {
+	s := status.Convert(StatusError(err))
+	return httpError{Code: s.Code(), Status: s.Code().String(), Message: s.Message()}
+}
+
+func writeHTTPError(w http.ResponseWriter, err error) {
+	e := newHTTPError(err)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(HTTPStatusFromCode(e.Code))
+	_ = json.NewEncoder(w).Encode(e)
+}
+
+// HTTPStatusFromCode returns the HTTP status of the gRPC code, the same as grpc-gateway.
+func HTTPStatusFromCode(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499 // Client Closed Request
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package orasrv
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	oracall "github.com/tgulacsi/oracall/lib"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type gwInput struct {
+	Name string `json:"p_name,omitempty"`
+}
+type gwOutput struct {
+	Greeting string `json:"greeting,omitempty"`
+}
+
+func TestGateway(t *testing.T) {
+	g := &Gateway{
+		methods: make(map[string]gatewayMethod),
+		unary: func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			_ = grpc.SetHeader(ctx, metadata.Pairs(ReqIDHeader, "42"))
+			return handler(ctx, req)
+		},
+		stream: func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			return handler(srv, ss)
+		},
+	}
+	g.Register("pkg.Svc", []oracall.MethodDesc{
+		{Name: "Hello", Path: "/db_pkg/hello", NewInput: func() interface{} { return new(gwInput) },
+			Unary: func(ctx context.Context, input interface{}) (interface{}, error) {
+				in := input.(*gwInput)
+				if in.Name == "" {
+					return nil, status.Error(codes.InvalidArgument, "empty name")
+				}
+				return &gwOutput{Greeting: "Hello, " + in.Name}, nil
+			}},
+		{Name: "List", Path: "/db_pkg/list", NewInput: func() interface{} { return new(gwInput) },
+			Stream: func(ctx context.Context, input interface{}, send func(interface{}) error) error {
+				for _, s := range []string{"a", "b"} {
+					if err := send(&gwOutput{Greeting: s}); err != nil {
+						return err
+					}
+				}
+				return status.Error(codes.Aborted, "stop")
+			}},
+	})
+
+	for _, tc := range []struct {
+		Method, Path, Body string
+		Code               int
+		Want               string
+	}{
+		{"POST", "/DB_PKG/hello", `{"p_name":"world"}`, http.StatusOK, `{"greeting":"Hello, world"}` + "\n"},
+		{"POST", "/db_pkg/hello", ``, http.StatusBadRequest, `{"code":3,"status":"InvalidArgument","message":"empty name"}` + "\n"},
+		{"POST", "/db_pkg/hello", `{`, http.StatusBadRequest, ``},
+		{"GET", "/db_pkg/hello", ``, http.StatusMethodNotAllowed, ``},
+		{"POST", "/db_pkg/nothing", `{}`, http.StatusNotFound, ``},
+		{"POST", "/db_pkg/list", `{}`, http.StatusOK, `{"greeting":"a"}` + "\n" + `{"greeting":"b"}` + "\n" +
+			`{"error":{"code":10,"status":"Aborted","message":"stop"}}` + "\n"},
+	} {
+		rec := httptest.NewRecorder()
+		g.ServeHTTP(rec, httptest.NewRequest(tc.Method, tc.Path, strings.NewReader(tc.Body)))
+		if rec.Code != tc.Code {
+			t.Errorf("%s %s: got %d, wanted %d", tc.Method, tc.Path, rec.Code, tc.Code)
+		}
+		if tc.Want != "" && rec.Body.String() != tc.Want {
+			t.Errorf("%s %s: got %q, wanted %q", tc.Method, tc.Path, rec.Body.String(), tc.Want)
+		}
+		if tc.Path == "/DB_PKG/hello" && rec.Header().Get(ReqIDHeader) != "42" {
+			t.Errorf("%s %s: missing header, got %v", tc.Method, tc.Path, rec.Header())
+		}
+	}
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package orasrv
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	errors "golang.org/x/xerrors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// DefaultHealthInterval is the default interval of the database pings of Health.
+const DefaultHealthInterval = 10 * time.Second
+
+const healthServicePrefix = "/grpc.health.v1.Health/"
+
+// Health serves the standard grpc.health.v1.Health service,
+// with the status driven by the periodic pinging of the databases.
+//
+// The status of each service (as added with AddDB) follows the pings of its database,
+// and the overall status (the empty service name) is SERVING only if all the databases are reachable.
+type Health struct {
+	// Interval is the interval of the pings.
+	Interval time.Duration
+	// Timeout is the timeout of a ping, Interval/2 if zero.
+	Timeout time.Duration
+	// Log is called with the status changes, if not nil.
+	Log func(...interface{}) error
+
+	srv *health.Server
+
+	mu  sync.Mutex
+	dbs map[string]*sql.DB
+}
+
+// NewHealth returns a new Health, with DefaultHealthInterval.
+//
+// Run must be running to ping the databases - till then, all the services are NOT_SERVING.
+func NewHealth() *Health {
+	h := &Health{Interval: DefaultHealthInterval, srv: health.NewServer(), dbs: make(map[string]*sql.DB)}
+	h.srv.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	return h
+}
+
+// AddDB registers the database of the service (such as "pkg.Service").
+func (h *Health) AddDB(service string, db *sql.DB) {
+	h.mu.Lock()
+	h.dbs[service] = db
+	h.mu.Unlock()
+	h.srv.SetServingStatus(service, healthpb.HealthCheckResponse_NOT_SERVING)
+}
+
+// Register the health service on the server.
+func (h *Health) Register(srv *grpc.Server) { healthpb.RegisterHealthServer(srv, h.srv) }
+
+// Shutdown sets all the services to NOT_SERVING, and ignores the further pings.
+func (h *Health) Shutdown() { h.srv.Shutdown() }
+
+// Run pings the databases in every Interval, till ctx is canceled.
+func (h *Health) Run(ctx context.Context) error {
+	interval := h.Interval
+	if interval <= 0 {
+		interval = DefaultHealthInterval
+	}
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = interval / 2
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	last := make(map[string]healthpb.HealthCheckResponse_ServingStatus)
+	for {
+		h.check(ctx, timeout, last)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (h *Health) check(ctx context.Context, timeout time.Duration, last map[string]healthpb.HealthCheckResponse_ServingStatus) {
+	h.mu.Lock()
+	dbs := make(map[string]*sql.DB, len(h.dbs))
+	for k, v := range h.dbs {
+		dbs[k] = v
+	}
+	h.mu.Unlock()
+
+	overall := healthpb.HealthCheckResponse_SERVING
+	for service, db := range dbs {
+		st := healthpb.HealthCheckResponse_SERVING
+		pingCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := db.PingContext(pingCtx)
+		cancel()
+		if err != nil {
+			st, overall = healthpb.HealthCheckResponse_NOT_SERVING, healthpb.HealthCheckResponse_NOT_SERVING
+		}
+		h.setStatus(last, service, st, err)
+	}
+	if _, ok := dbs[""]; !ok {
+		h.setStatus(last, "", overall, nil)
+	}
+}
+
+func (h *Health) setStatus(last map[string]healthpb.HealthCheckResponse_ServingStatus, service string, st healthpb.HealthCheckResponse_ServingStatus, err error) {
+	if prev, ok := last[service]; ok && prev == st {
+		return
+	}
+	last[service] = st
+	h.srv.SetServingStatus(service, st)
+	if h.Log != nil {
+		h.Log("msg", "health", "service", service, "status", st.String(), "error", err)
+	}
+}
+
+// Drain shuts down the server gracefully: sets the health services to NOT_SERVING,
+// waits for the in-flight calls (including the streams) till ctx is done - then stops the server forcibly,
+// rolls back the pending transactions, closes the sessions, and finally closes the databases.
+//
+// It returns ctx.Err() if the server had to be stopped forcibly.
+func (conf Config) Drain(ctx context.Context, srv *grpc.Server, dbs ...*sql.DB) error {
+	if conf.Health != nil {
+		conf.Health.Shutdown()
+	}
+	done := make(chan struct{})
+	go func() { srv.GracefulStop(); close(done) }()
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+		srv.Stop()
+		<-done
+	}
+	if conf.TxManager != nil {
+		conf.TxManager.Close()
+	}
+	if conf.SessionManager != nil {
+		conf.SessionManager.CloseAll()
+	}
+	for _, db := range dbs {
+		if closeErr := db.Close(); closeErr != nil && err == nil {
+			err = errors.Errorf("close db: %w", closeErr)
+		}
+	}
+	return err
+}
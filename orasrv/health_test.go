@@ -0,0 +1,49 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package orasrv
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestHealth(t *testing.T) {
+	ctx := context.Background()
+	h := NewHealth()
+	status := func() healthpb.HealthCheckResponse_ServingStatus {
+		resp, err := h.srv.Check(ctx, &healthpb.HealthCheckRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.Status
+	}
+	if st := status(); st != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("before Run: got %s", st)
+	}
+	h.check(ctx, time.Second, make(map[string]healthpb.HealthCheckResponse_ServingStatus))
+	if st := status(); st != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("after check: got %s", st)
+	}
+	h.Shutdown()
+	h.check(ctx, time.Second, make(map[string]healthpb.HealthCheckResponse_ServingStatus))
+	if st := status(); st != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("after Shutdown: got %s", st)
+	}
+}
@@ -0,0 +1,288 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package orasrv
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gogo/protobuf/proto"
+	oracall "github.com/tgulacsi/oracall/lib"
+	"google.golang.org/grpc"
+)
+
+// LogPolicy decides the log level of the calls.
+type LogPolicy interface {
+	// Level returns the log level of the call of fullMethod.
+	Level(fullMethod string) oracall.LogLevel
+	// Observe is called with the result of the call.
+	Observe(fullMethod string, err error)
+}
+
+// LogConfig combines the logging policies: the level of a call is the highest of their levels.
+type LogConfig struct {
+	// Methods holds the per-method levels, which can be changed with the oracall.Admin service.
+	Methods *MethodLevels
+	// Policies are the additional policies, such as Sampler and ErroredEscalation.
+	Policies []LogPolicy
+	// MaxPayload is the maximum length of a logged payload, unlimited if 0.
+	MaxPayload int
+	// LogRequests logs the (redacted) inputs of the calls at LogInfo, too - not only at LogDebug -,
+	// for "oracall replay".
+	LogRequests bool
+}
+
+// logRequest reports whether the inputs of the calls are logged with the policy.
+func (c *LogConfig) logRequest(lp oracall.LogPolicy) bool {
+	return lp.Enabled(oracall.LogDebug) || c.LogRequests && lp.Enabled(oracall.LogInfo)
+}
+
+// NewLogConfig returns a LogConfig with LogInfo (LogTrace if verbose) as the default level,
+// and the escalation of the errored methods to LogTrace.
+func NewLogConfig(verbose bool) *LogConfig {
+	lvl := oracall.LogInfo
+	if verbose {
+		lvl = oracall.LogTrace
+	}
+	return &LogConfig{
+		Methods:    NewMethodLevels(lvl),
+		Policies:   []LogPolicy{NewErroredEscalation(oracall.LogTrace)},
+		MaxPayload: oracall.DefaultLogPolicy.MaxPayload,
+	}
+}
+
+func (c *LogConfig) policy(fullMethod string) oracall.LogPolicy {
+	lvl := c.Methods.Level(fullMethod)
+	for _, p := range c.Policies {
+		if l := p.Level(fullMethod); l > lvl {
+			lvl = l
+		}
+	}
+	return oracall.LogPolicy{Level: lvl, MaxPayload: c.MaxPayload}
+}
+
+func (c *LogConfig) observe(fullMethod string, err error) {
+	for _, p := range c.Policies {
+		p.Observe(fullMethod, err)
+	}
+}
+
+// Register the oracall.Admin service on the server, for changing the per-method log levels:
+//
+//	syntax = "proto3";
+//	package oracall;
+//
+//	service Admin {
+//		// SetLogLevel sets the level of the method ("/pkg.Service/Method"),
+//		// or of all the methods of the service ("/pkg.Service/"), or the default level (empty method).
+//		// An empty level removes the method's own level.
+//		rpc SetLogLevel(LogLevelSetting) returns (LogLevelSettings) {}
+//		rpc GetLogLevels(AdminEmpty) returns (LogLevelSettings) {}
+//	}
+//	message AdminEmpty {}
+//	message LogLevelSetting { string method = 1; string level = 2; }
+//	message LogLevelSettings { repeated LogLevelSetting settings = 1; }
+//
+// The calls of this service are authorized by checkAuth, as any other.
+func (c *LogConfig) Register(srv *grpc.Server) { srv.RegisterService(&adminServiceDesc, c) }
+
+// MethodLevels holds the log levels per method.
+type MethodLevels struct {
+	mu     sync.RWMutex
+	def    oracall.LogLevel
+	levels map[string]oracall.LogLevel
+}
+
+// NewMethodLevels returns a new MethodLevels with the default level.
+func NewMethodLevels(def oracall.LogLevel) *MethodLevels {
+	return &MethodLevels{def: def, levels: make(map[string]oracall.LogLevel)}
+}
+
+// Level returns the level of the method, or of its service, or the default level.
+func (m *MethodLevels) Level(fullMethod string) oracall.LogLevel {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if lvl, ok := m.levels[fullMethod]; ok {
+		return lvl
+	}
+	if i := strings.LastIndexByte(fullMethod, '/'); i > 0 {
+		if lvl, ok := m.levels[fullMethod[:i+1]]; ok {
+			return lvl
+		}
+	}
+	return m.def
+}
+
+// Observe does nothing.
+func (m *MethodLevels) Observe(string, error) {}
+
+// Set the level of the method ("/pkg.Service/Method"), or of all the methods of the service ("/pkg.Service/"),
+// or the default level (empty method).
+func (m *MethodLevels) Set(method string, lvl oracall.LogLevel) {
+	m.mu.Lock()
+	if method == "" {
+		m.def = lvl
+	} else {
+		m.levels[method] = lvl
+	}
+	m.mu.Unlock()
+}
+
+// Unset removes the own level of the method.
+func (m *MethodLevels) Unset(method string) {
+	m.mu.Lock()
+	delete(m.levels, method)
+	m.mu.Unlock()
+}
+
+// Levels returns the levels - the default under the empty method.
+func (m *MethodLevels) Levels() map[string]oracall.LogLevel {
+	m.mu.RLock()
+	levels := make(map[string]oracall.LogLevel, len(m.levels)+1)
+	for k, v := range m.levels {
+		levels[k] = v
+	}
+	levels[""] = m.def
+	m.mu.RUnlock()
+	return levels
+}
+
+// Sampler escalates the given fraction (0..1) of the calls of the methods with the Prefix to Escalate.
+type Sampler struct {
+	Prefix   string
+	Rate     float64
+	Escalate oracall.LogLevel
+}
+
+// Level returns the sampled level, or LogOff.
+func (s Sampler) Level(fullMethod string) oracall.LogLevel {
+	if strings.HasPrefix(fullMethod, s.Prefix) && rand.Float64() < s.Rate {
+		return s.Escalate
+	}
+	return oracall.LogOff
+}
+
+// Observe does nothing.
+func (s Sampler) Observe(string, error) {}
+
+// ErroredEscalation escalates the calls of the methods whose previous call has failed, to its level.
+type ErroredEscalation struct {
+	level   oracall.LogLevel
+	mu      sync.RWMutex
+	errored map[string]struct{}
+}
+
+// NewErroredEscalation returns a new ErroredEscalation, escalating to level.
+func NewErroredEscalation(level oracall.LogLevel) *ErroredEscalation {
+	return &ErroredEscalation{level: level, errored: make(map[string]struct{})}
+}
+
+// Level returns the escalated level if the previous call of the method has failed, LogOff otherwise.
+func (e *ErroredEscalation) Level(fullMethod string) oracall.LogLevel {
+	e.mu.RLock()
+	_, ok := e.errored[fullMethod]
+	e.mu.RUnlock()
+	if ok {
+		return e.level
+	}
+	return oracall.LogOff
+}
+
+// Observe records whether the call of the method has failed.
+func (e *ErroredEscalation) Observe(fullMethod string, err error) {
+	e.mu.RLock()
+	_, ok := e.errored[fullMethod]
+	e.mu.RUnlock()
+	if ok == (err != nil) {
+		return
+	}
+	e.mu.Lock()
+	if err != nil {
+		e.errored[fullMethod] = struct{}{}
+	} else {
+		delete(e.errored, fullMethod)
+	}
+	e.mu.Unlock()
+}
+
+// AdminEmpty is the empty message of the oracall.Admin service.
+type AdminEmpty struct{}
+
+func (m AdminEmpty) ProtoMessage()   {}
+func (m *AdminEmpty) Reset()         {}
+func (m *AdminEmpty) String() string { return proto.MarshalTextString(m) }
+
+// LogLevelSetting is the log level of a method.
+type LogLevelSetting struct {
+	Method string `protobuf:"bytes,1,opt,name=method,proto3" json:"method,omitempty"`
+	Level  string `protobuf:"bytes,2,opt,name=level,proto3" json:"level,omitempty"`
+}
+
+func (m LogLevelSetting) ProtoMessage()   {}
+func (m *LogLevelSetting) Reset()         { *m = LogLevelSetting{} }
+func (m *LogLevelSetting) String() string { return proto.MarshalTextString(m) }
+
+// LogLevelSettings is the list of the log levels.
+type LogLevelSettings struct {
+	Settings []*LogLevelSetting `protobuf:"bytes,1,rep,name=settings,proto3" json:"settings,omitempty"`
+}
+
+func (m LogLevelSettings) ProtoMessage()   {}
+func (m *LogLevelSettings) Reset()         { *m = LogLevelSettings{} }
+func (m *LogLevelSettings) String() string { return proto.MarshalTextString(m) }
+
+func (c *LogConfig) settings() *LogLevelSettings {
+	levels := c.Methods.Levels()
+	res := &LogLevelSettings{Settings: make([]*LogLevelSetting, 0, len(levels))}
+	for k, v := range levels {
+		res.Settings = append(res.Settings, &LogLevelSetting{Method: k, Level: v.String()})
+	}
+	sort.Slice(res.Settings, func(i, j int) bool { return res.Settings[i].Method < res.Settings[j].Method })
+	return res
+}
+
+const adminServiceName = "oracall.Admin"
+
+var adminServiceDesc = grpc.ServiceDesc{
+	ServiceName: adminServiceName,
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "SetLogLevel", Handler: unaryHandler("/"+adminServiceName+"/SetLogLevel", func() interface{} { return new(LogLevelSetting) },
+			func(ctx context.Context, srv, req interface{}) (interface{}, error) {
+				c, s := srv.(*LogConfig), req.(*LogLevelSetting)
+				if s.Level == "" {
+					c.Methods.Unset(s.Method)
+					return c.settings(), nil
+				}
+				lvl, err := oracall.ParseLogLevel(s.Level)
+				if err != nil {
+					return nil, err
+				}
+				c.Methods.Set(s.Method, lvl)
+				return c.settings(), nil
+			})},
+		{MethodName: "GetLogLevels", Handler: unaryHandler("/"+adminServiceName+"/GetLogLevels", func() interface{} { return new(AdminEmpty) },
+			func(ctx context.Context, srv, _ interface{}) (interface{}, error) {
+				return srv.(*LogConfig).settings(), nil
+			})},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "oracall_admin.proto",
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package orasrv
+
+import (
+	"testing"
+
+	oracall "github.com/tgulacsi/oracall/lib"
+	errors "golang.org/x/xerrors"
+)
+
+func TestLogConfig(t *testing.T) {
+	const method = "/pkg.Service/Method"
+	c := NewLogConfig(false)
+	if lvl := c.policy(method).Level; lvl != oracall.LogInfo {
+		t.Errorf("default level: got %s, wanted %s", lvl, oracall.LogInfo)
+	}
+
+	c.Methods.Set("/pkg.Service/", oracall.LogError)
+	if lvl := c.policy(method).Level; lvl != oracall.LogError {
+		t.Errorf("service level: got %s, wanted %s", lvl, oracall.LogError)
+	}
+	c.Methods.Set(method, oracall.LogDebug)
+	if lvl := c.policy(method).Level; lvl != oracall.LogDebug {
+		t.Errorf("method level: got %s, wanted %s", lvl, oracall.LogDebug)
+	}
+	c.Methods.Unset(method)
+	if lvl := c.policy(method).Level; lvl != oracall.LogError {
+		t.Errorf("unset method level: got %s, wanted %s", lvl, oracall.LogError)
+	}
+
+	c.observe(method, errors.New("failed"))
+	if lvl := c.policy(method).Level; lvl != oracall.LogTrace {
+		t.Errorf("errored level: got %s, wanted %s", lvl, oracall.LogTrace)
+	}
+	c.observe(method, nil)
+	if lvl := c.policy(method).Level; lvl != oracall.LogError {
+		t.Errorf("recovered level: got %s, wanted %s", lvl, oracall.LogError)
+	}
+
+	c.Policies = append(c.Policies, Sampler{Prefix: "/pkg.", Rate: 1, Escalate: oracall.LogDebug})
+	if lvl := c.policy(method).Level; lvl != oracall.LogDebug {
+		t.Errorf("sampled level: got %s, wanted %s", lvl, oracall.LogDebug)
+	}
+	if lvl := c.policy("/other.Service/Method").Level; lvl != oracall.LogInfo {
+		t.Errorf("not sampled level: got %s, wanted %s", lvl, oracall.LogInfo)
+	}
+
+	settings := c.settings().Settings
+	if len(settings) != 2 || settings[0].Method != "" || settings[1].Method != "/pkg.Service/" || settings[1].Level != oracall.LogError.String() {
+		t.Errorf("settings: got %v", settings)
+	}
+}
+
+func TestLogConfigLogRequests(t *testing.T) {
+	const method = "/pkg.Service/Method"
+	c := NewLogConfig(false)
+	if c.logRequest(c.policy(method)) {
+		t.Error("the inputs are logged at info level")
+	}
+	c.LogRequests = true
+	if !c.logRequest(c.policy(method)) {
+		t.Error("the inputs are not logged at info level with LogRequests")
+	}
+	c.Methods.Set(method, oracall.LogError)
+	if c.logRequest(c.policy(method)) {
+		t.Error("the inputs are logged at error level")
+	}
+}
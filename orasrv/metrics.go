@@ -0,0 +1,312 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package orasrv
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	errors "golang.org/x/xerrors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultBuckets are the default latency histogram buckets, in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+
+// Metrics collects per-method statistics of the calls served by GRPCServer,
+// and the connection pool statistics of the registered databases.
+//
+// It exposes them in the Prometheus text exposition format.
+type Metrics struct {
+	buckets []float64
+
+	mu      sync.Mutex
+	methods map[string]*methodMetrics
+	dbs     map[string]*sql.DB
+}
+
+type methodMetrics struct {
+	requests, streamed uint64
+	grpcCodes          map[codes.Code]uint64
+	oraCodes           map[int]uint64
+	buckets            []uint64
+	sum                float64
+	count              uint64
+}
+
+// NewMetrics returns a new Metrics, with the given histogram buckets (DefaultBuckets if empty).
+func NewMetrics(buckets ...float64) *Metrics {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &Metrics{
+		buckets: buckets,
+		methods: make(map[string]*methodMetrics),
+		dbs:     make(map[string]*sql.DB),
+	}
+}
+
+// RegisterDB registers the db, to expose its pool statistics under the given name.
+func (m *Metrics) RegisterDB(name string, db *sql.DB) {
+	m.mu.Lock()
+	m.dbs[name] = db
+	m.mu.Unlock()
+}
+
+func (m *Metrics) method(fullMethod string) *methodMetrics {
+	mm := m.methods[fullMethod]
+	if mm == nil {
+		mm = &methodMetrics{
+			grpcCodes: make(map[codes.Code]uint64),
+			oraCodes:  make(map[int]uint64),
+			buckets:   make([]uint64, len(m.buckets)),
+		}
+		m.methods[fullMethod] = mm
+	}
+	return mm
+}
+
+// Observe records a finished call of fullMethod.
+func (m *Metrics) Observe(fullMethod string, dur time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	code := status.Code(StatusError(err))
+	oraCode := OraCode(err)
+	secs := dur.Seconds()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mm := m.method(fullMethod)
+	mm.requests++
+	if code != codes.OK {
+		mm.grpcCodes[code]++
+	}
+	if oraCode != 0 {
+		mm.oraCodes[oraCode]++
+	}
+	for i, le := range m.buckets {
+		if secs <= le {
+			mm.buckets[i]++
+		}
+	}
+	mm.sum += secs
+	mm.count++
+}
+
+// streamedMessage records a message sent on the stream of fullMethod.
+func (m *Metrics) streamedMessage(fullMethod string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.method(fullMethod).streamed++
+	m.mu.Unlock()
+}
+
+// OraCode returns the ORA-xxxxx error code of the error, or 0.
+func OraCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var oc interface{ Code() int }
+	if errors.As(err, &oc) {
+		return oc.Code()
+	}
+	return 0
+}
+
+// WriteTo writes the metrics in Prometheus text exposition format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	cw := &countWriter{w: bufio.NewWriter(w)}
+
+	m.mu.Lock()
+	names := make([]string, 0, len(m.methods))
+	for nm := range m.methods {
+		names = append(names, nm)
+	}
+	sort.Strings(names)
+
+	cw.printf("# HELP oracall_requests_total Number of calls, per method.\n# TYPE oracall_requests_total counter\n")
+	for _, nm := range names {
+		cw.printf("oracall_requests_total{method=%q} %d\n", nm, m.methods[nm].requests)
+	}
+	cw.printf("# HELP oracall_errors_total Number of failed calls, per method and gRPC code.\n# TYPE oracall_errors_total counter\n")
+	for _, nm := range names {
+		mm := m.methods[nm]
+		keys := make([]int, 0, len(mm.grpcCodes))
+		for k := range mm.grpcCodes {
+			keys = append(keys, int(k))
+		}
+		sort.Ints(keys)
+		for _, k := range keys {
+			cw.printf("oracall_errors_total{method=%q,code=%q} %d\n", nm, codes.Code(k).String(), mm.grpcCodes[codes.Code(k)])
+		}
+	}
+	cw.printf("# HELP oracall_ora_errors_total Number of calls failed with an ORA error, per method and ORA code.\n# TYPE oracall_ora_errors_total counter\n")
+	for _, nm := range names {
+		mm := m.methods[nm]
+		keys := make([]int, 0, len(mm.oraCodes))
+		for k := range mm.oraCodes {
+			keys = append(keys, k)
+		}
+		sort.Ints(keys)
+		for _, k := range keys {
+			cw.printf("oracall_ora_errors_total{method=%q,ora=\"ORA-%05d\"} %d\n", nm, k, mm.oraCodes[k])
+		}
+	}
+	cw.printf("# HELP oracall_stream_messages_total Number of messages sent on REF CURSOR streams, per method.\n# TYPE oracall_stream_messages_total counter\n")
+	for _, nm := range names {
+		if mm := m.methods[nm]; mm.streamed != 0 {
+			cw.printf("oracall_stream_messages_total{method=%q} %d\n", nm, mm.streamed)
+		}
+	}
+	cw.printf("# HELP oracall_request_duration_seconds Latency of the calls, per method.\n# TYPE oracall_request_duration_seconds histogram\n")
+	for _, nm := range names {
+		mm := m.methods[nm]
+		for i, le := range m.buckets {
+			cw.printf("oracall_request_duration_seconds_bucket{method=%q,le=%q} %d\n", nm, formatFloat(le), mm.buckets[i])
+		}
+		cw.printf("oracall_request_duration_seconds_bucket{method=%q,le=\"+Inf\"} %d\n", nm, mm.count)
+		cw.printf("oracall_request_duration_seconds_sum{method=%q} %s\n", nm, formatFloat(mm.sum))
+		cw.printf("oracall_request_duration_seconds_count{method=%q} %d\n", nm, mm.count)
+	}
+
+	dbNames := make([]string, 0, len(m.dbs))
+	for nm := range m.dbs {
+		dbNames = append(dbNames, nm)
+	}
+	sort.Strings(dbNames)
+	stats := make([]sql.DBStats, len(dbNames))
+	for i, nm := range dbNames {
+		stats[i] = m.dbs[nm].Stats()
+	}
+	m.mu.Unlock()
+
+	for _, g := range []struct {
+		Name, Help, Type string
+		Value            func(sql.DBStats) string
+	}{
+		{"oracall_db_max_open_connections", "Maximum number of open connections to the database.", "gauge",
+			func(s sql.DBStats) string { return strconv.Itoa(s.MaxOpenConnections) }},
+		{"oracall_db_open_connections", "The number of established connections both in use and idle.", "gauge",
+			func(s sql.DBStats) string { return strconv.Itoa(s.OpenConnections) }},
+		{"oracall_db_in_use_connections", "The number of connections currently in use.", "gauge",
+			func(s sql.DBStats) string { return strconv.Itoa(s.InUse) }},
+		{"oracall_db_idle_connections", "The number of idle connections.", "gauge",
+			func(s sql.DBStats) string { return strconv.Itoa(s.Idle) }},
+		{"oracall_db_wait_count_total", "The total number of connections waited for.", "counter",
+			func(s sql.DBStats) string { return strconv.FormatInt(s.WaitCount, 10) }},
+		{"oracall_db_wait_duration_seconds_total", "The total time blocked waiting for a new connection.", "counter",
+			func(s sql.DBStats) string { return formatFloat(s.WaitDuration.Seconds()) }},
+	} {
+		if len(dbNames) == 0 {
+			break
+		}
+		cw.printf("# HELP %s %s\n# TYPE %s %s\n", g.Name, g.Help, g.Name, g.Type)
+		for i, nm := range dbNames {
+			cw.printf("%s{db=%q} %s\n", g.Name, nm, g.Value(stats[i]))
+		}
+	}
+	if cw.err == nil {
+		cw.err = cw.w.(*bufio.Writer).Flush()
+	}
+	return cw.n, cw.err
+}
+
+// ServeHTTP serves the metrics in Prometheus text exposition format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if _, err := m.WriteTo(w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// ListenAndServe serves the metrics on addr, under /metrics, till ctx is canceled.
+func (m *Metrics) ListenAndServe(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m)
+	srv := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		shutCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutCtx)
+	}()
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return errors.Errorf("listen on %s: %w", addr, err)
+	}
+	return nil
+}
+
+// countingStream counts the messages sent on the stream.
+type countingStream struct {
+	grpc.ServerStream
+	onSend func()
+}
+
+func (s countingStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.onSend()
+	}
+	return err
+}
+
+// recvLoggingStream calls onRecv with each received message.
+type recvLoggingStream struct {
+	grpc.ServerStream
+	onRecv func(interface{})
+}
+
+func (s recvLoggingStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.onRecv(m)
+	}
+	return err
+}
+
+type countWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (cw *countWriter) printf(format string, args ...interface{}) {
+	if cw.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(cw.w, format, args...)
+	cw.n += int64(n)
+	cw.err = err
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
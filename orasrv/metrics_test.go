@@ -0,0 +1,59 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package orasrv
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	errors "golang.org/x/xerrors"
+)
+
+type oraErr int
+
+func (e oraErr) Code() int     { return int(e) }
+func (e oraErr) Error() string { return fmt.Sprintf("ORA-%05d", int(e)) }
+
+func TestMetricsWriteTo(t *testing.T) {
+	m := NewMetrics(0.1, 1)
+	m.Observe("/pkg.Pkg/Fun", 50*time.Millisecond, nil)
+	m.Observe("/pkg.Pkg/Fun", 500*time.Millisecond, errors.Errorf("call: %w", oraErr(6502)))
+	m.streamedMessage("/pkg.Pkg/Cur")
+
+	var buf strings.Builder
+	if _, err := m.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+	t.Log(got)
+	for _, want := range []string{
+		`oracall_requests_total{method="/pkg.Pkg/Fun"} 2`,
+		`oracall_errors_total{method="/pkg.Pkg/Fun",code="Unknown"} 1`,
+		`oracall_ora_errors_total{method="/pkg.Pkg/Fun",ora="ORA-06502"} 1`,
+		`oracall_stream_messages_total{method="/pkg.Pkg/Cur"} 1`,
+		`oracall_request_duration_seconds_bucket{method="/pkg.Pkg/Fun",le="0.1"} 1`,
+		`oracall_request_duration_seconds_bucket{method="/pkg.Pkg/Fun",le="1"} 2`,
+		`oracall_request_duration_seconds_bucket{method="/pkg.Pkg/Fun",le="+Inf"} 2`,
+		`oracall_request_duration_seconds_count{method="/pkg.Pkg/Fun"} 2`,
+	} {
+		if !strings.Contains(got, want+"\n") {
+			t.Errorf("missing %q", want)
+		}
+	}
+}
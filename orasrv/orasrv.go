@@ -5,13 +5,16 @@ import (
 	"crypto/rand"
 	"encoding/json"
 	"fmt"
+	"net"
 	"reflect"
-	"sync"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gogo/protobuf/proto"
 	bp "github.com/tgulacsi/go/bufpool"
 	oracall "github.com/tgulacsi/oracall/lib"
+	"github.com/tgulacsi/oracall/oragrpc"
 	errors "golang.org/x/xerrors"
 
 	"github.com/go-kit/kit/log"
@@ -22,6 +25,9 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	_ "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
 
 	godror "github.com/godror/godror"
@@ -33,136 +39,324 @@ const DefaultTimeout = time.Hour
 
 var bufpool = bp.New(4096)
 
+// Config holds the optional features of the server returned by GRPCServer.
+type Config struct {
+	// Metrics collects the per-method metrics, if not nil.
+	Metrics *Metrics
+	// Tracer starts the spans of the calls, if not nil.
+	// It is passed in the context to the generated code, too.
+	Tracer oracall.Tracer
+	// Identify returns the identity of the caller, if not nil.
+	// It is called after checkAuth, and the returned oracall.Identity is put into the context,
+	// thus the generated code acquires the Oracle session (and the DBLog sees it) as that identity.
+	Identify func(ctx context.Context, path string) (oracall.Identity, error)
+	// TxManager serves the transactions spanning several calls, if not nil.
+	// Its service must be registered on the returned server, with TxManager.Register.
+	TxManager *TxManager
+	// SessionManager serves the dedicated sessions of the session-bound calls, if not nil.
+	// Its service must be registered on the returned server, with SessionManager.Register.
+	SessionManager *SessionManager
+	// Logging decides the log level of the calls - NewLogConfig(verbose) if nil.
+	// Its service can be registered on the returned server, with LogConfig.Register.
+	Logging *LogConfig
+	// Health serves the standard health service, if not nil - it is registered on the returned server,
+	// and its calls need no authentication. Its Run must be running to update the statuses.
+	Health *Health
+	// Reflection registers the server reflection service on the returned server, for grpcurl and alike.
+	// The gogo generated services need the goproto_registration option, which SaveProtobuf emits.
+	Reflection bool
+}
+
+// GRPCServer returns a new grpc.Server with the zero Config.
 func GRPCServer(globalCtx context.Context, logger log.Logger, verbose bool, checkAuth func(ctx context.Context, path string) error, options ...grpc.ServerOption) *grpc.Server {
-	erroredMethods := make(map[string]struct{})
-	var erroredMethodsMu sync.RWMutex
+	return Config{}.GRPCServer(globalCtx, logger, verbose, checkAuth, options...)
+}
+
+// interceptors returns the unary and stream interceptors doing the logging, authentication and the features of conf.
+func (conf Config) interceptors(globalCtx context.Context, logger log.Logger, verbose bool, checkAuth func(ctx context.Context, path string) error) (grpc.UnaryServerInterceptor, grpc.StreamServerInterceptor) {
+	logConf := conf.Logging
+	if logConf == nil {
+		logConf = NewLogConfig(verbose)
+	}
 
 	getLogger := func(ctx context.Context, fullMethod string) (log.Logger, func(error), context.Context, context.CancelFunc) {
-		var cancel context.CancelFunc = func() {} 
+		var cancel context.CancelFunc = func() {}
 		if Timeout != 0 {
 			ctx, cancel = context.WithTimeout(ctx, Timeout) //nolint:govet
 		}
-		reqID := ContextGetReqID(ctx)
+		md, _ := metadata.FromIncomingContext(ctx)
+		reqID := reqIDFromMetadata(md)
+		if reqID == "" {
+			reqID = ContextGetReqID(ctx)
+		}
 		ctx = ContextWithReqID(ctx, reqID)
+		_ = grpc.SetHeader(ctx, metadata.Pairs(ReqIDHeader, reqID))
 		lgr := log.With(logger, "reqID", reqID)
+		if md != nil {
+			if vv := md.Get("traceparent"); len(vv) != 0 {
+				if tc, err := oracall.ParseTraceParent(vv[0]); err != nil {
+					lgr.Log("msg", "parse traceparent", "traceparent", vv[0], "error", err)
+				} else {
+					if vv = md.Get("tracestate"); len(vv) != 0 {
+						tc.State = vv[0]
+					}
+					ctx = oracall.ContextWithTraceContext(ctx, tc)
+					lgr = log.With(lgr, "traceID", tc.TraceIDString())
+				}
+			}
+		}
+		if conf.Tracer != nil {
+			ctx = oracall.ContextWithTracer(ctx, conf.Tracer)
+		}
+		if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+			ip := p.Addr.String()
+			if host, _, err := net.SplitHostPort(ip); err == nil {
+				ip = host
+			}
+			ctx = oracall.ContextWithClientIP(ctx, ip)
+		}
+		if vv := md.Get("accept-language"); len(vv) != 0 {
+			// the first, most preferred language tag
+			locale := vv[0]
+			if i := strings.IndexAny(locale, ",;"); i >= 0 {
+				locale = locale[:i]
+			}
+			ctx = oracall.ContextWithLocale(ctx, strings.TrimSpace(locale))
+		}
 		ctx = ContextWithLogger(ctx, lgr)
-		verbose := verbose
-		var wasThere bool
-		if !verbose {
-			erroredMethodsMu.RLock()
-			_, verbose = erroredMethods[fullMethod]
-			erroredMethodsMu.RUnlock()
-			wasThere = verbose
-		}
-		if verbose {
+		lp := logConf.policy(fullMethod)
+		ctx = oracall.ContextWithLogPolicy(ctx, lp)
+		if lp.Enabled(oracall.LogTrace) {
 			ctx = godror.ContextWithLog(ctx, log.With(lgr, "lib", "godror").Log)
 		}
-		commit := func(err error) {
-			if wasThere && err == nil {
-				erroredMethodsMu.Lock()
-				delete(erroredMethods, fullMethod)
-				erroredMethodsMu.Unlock()
-			} else if err != nil && !wasThere {
-				erroredMethodsMu.Lock()
-				erroredMethods[fullMethod] = struct{}{}
-				erroredMethodsMu.Unlock()
+		commit := func(err error) { logConf.observe(fullMethod, err) }
+		return lgr, commit, ctx, cancel
+	}
+
+	authenticate := func(ctx context.Context, fullMethod string) (context.Context, error) {
+		if conf.Health != nil && strings.HasPrefix(fullMethod, healthServicePrefix) {
+			// the health checks (load balancers, orchestrators) are anonymous
+			return ctx, nil
+		}
+		_, endAuthSpan := oracall.StartSpan(ctx, conf.Tracer, "checkAuth")
+		err := checkAuth(ctx, fullMethod)
+		if err == nil && conf.Identify != nil {
+			var id oracall.Identity
+			if id, err = conf.Identify(ctx, fullMethod); err == nil {
+				ctx = oracall.ContextWithIdentity(ctx, id)
 			}
 		}
-		return lgr, commit, ctx, cancel
+		endAuthSpan(err)
+		if err != nil {
+			return ctx, status.Error(codes.Unauthenticated, err.Error())
+		}
+		md, _ := metadata.FromIncomingContext(ctx)
+		if vv := md.Get(DryRunHeader); len(vv) == 0 || !isTrue(vv[0]) {
+			return ctx, nil
+		}
+		if err = checkAuth(ctx, fullMethod+DryRunPathSuffix); err != nil {
+			return ctx, status.Error(codes.PermissionDenied, err.Error())
+		}
+		if vv := md.Get(TxHeader); len(vv) != 0 && vv[0] != "" {
+			return ctx, status.Error(codes.InvalidArgument, "dry-run is not possible in a shared transaction")
+		}
+		return oracall.ContextWithDryRun(ctx), nil
 	}
 
-	opts := []grpc.ServerOption{
-		grpc.StreamInterceptor(
-			func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
-				defer func() {
-					if r := recover(); r != nil {
-						trace := stack.Trace().String()
-						var ok bool
-						if err, ok = r.(error); ok {
-							logger.Log("PANIC", err, "trace", trace)
-							return
-						}
-						err = errors.Errorf("%+v", r)
-						logger.Log("PANIC", fmt.Sprintf("%+v", err), "trace", trace)
-					}
-				}()
-				lgr, commit, ctx, cancel := getLogger(ss.Context(), info.FullMethod)
-				defer cancel()
+	// pin the transaction and the session of the call, if there are any.
+	pin := func(ctx context.Context, fullMethod string) (context.Context, func(), error) {
+		ctx, releaseTx, err := conf.TxManager.contextWithTx(ctx, fullMethod)
+		if err != nil {
+			return ctx, nil, err
+		}
+		ctx, releaseConn, err := conf.SessionManager.contextWithConn(ctx, fullMethod)
+		if err != nil {
+			releaseTx()
+			return ctx, nil, err
+		}
+		return ctx, func() { releaseConn(); releaseTx() }, nil
+	}
 
-				buf := bufpool.Get()
-				defer bufpool.Put(buf)
-				jenc := json.NewEncoder(buf)
-				if err = jenc.Encode(srv); err != nil {
-					lgr.Log("marshal error", err, "srv", srv)
+	stream := func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				trace := stack.Trace().String()
+				var ok bool
+				if err, ok = r.(error); ok {
+					logger.Log("PANIC", err, "trace", trace)
+					return
 				}
-				lgr.Log("REQ", info.FullMethod, "srv", buf.String())
-				if err = checkAuth(ctx, info.FullMethod); err != nil {
-					return status.Error(codes.Unauthenticated, err.Error())
-				}
-
-				wss := grpc_middleware.WrapServerStream(ss)
-				wss.WrappedContext = ctx
-				start := time.Now()
-				err = handler(srv, wss)
-				lgr.Log("RESP", info.FullMethod, "dur", time.Since(start), "error", err)
-				commit(err)
-				return StatusError(err)
-			}),
-
-		grpc.UnaryInterceptor(
-			func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (_ interface{}, err error) {
-				defer func() {
-					if r := recover(); r != nil {
-						trace := stack.Trace().String()
-						var ok bool
-						if err, ok = r.(error); ok {
-							logger.Log("PANIC", err, "trace", trace)
-							return
-						}
-						err = errors.Errorf("%+v", r)
-						logger.Log("PANIC", fmt.Sprintf("%+v", err), "trace", trace)
-					}
-				}()
-				logger, commit, ctx, cancel := getLogger(ctx, info.FullMethod)
-				defer cancel()
+				err = errors.Errorf("%+v", r)
+				logger.Log("PANIC", fmt.Sprintf("%+v", err), "trace", trace)
+			}
+		}()
+		lgr, commit, ctx, cancel := getLogger(ss.Context(), info.FullMethod)
+		defer cancel()
+		ctx, endSpan := oracall.StartSpan(ctx, conf.Tracer, info.FullMethod)
+		defer func() { endSpan(err) }()
 
-				if err = checkAuth(ctx, info.FullMethod); err != nil {
-					return nil, status.Error(codes.Unauthenticated, err.Error())
-				}
+		lp := oracall.ContextGetLogPolicy(ctx)
+		if lp.Enabled(oracall.LogDebug) {
+			_, endLogSpan := oracall.StartSpan(ctx, conf.Tracer, "logRequest")
+			buf := bufpool.Get()
+			if jErr := json.NewEncoder(buf).Encode(srv); jErr != nil {
+				lgr.Log("marshal error", jErr)
+			}
+			lgr.Log("REQ", info.FullMethod, "srv", lp.Payload(buf.Bytes()))
+			bufpool.Put(buf)
+			endLogSpan(nil)
+		} else if lp.Enabled(oracall.LogInfo) {
+			lgr.Log("REQ", info.FullMethod)
+		}
+		if ctx, err = authenticate(ctx, info.FullMethod); err != nil {
+			return err
+		}
+		var unpin func()
+		if ctx, unpin, err = pin(ctx, info.FullMethod); err != nil {
+			return err
+		}
+		defer unpin()
 
+		wss := grpc_middleware.WrapServerStream(ss)
+		wss.WrappedContext = ctx
+		var hss grpc.ServerStream = wss
+		if conf.Metrics != nil {
+			hss = countingStream{ServerStream: wss, onSend: func() { conf.Metrics.streamedMessage(info.FullMethod) }}
+		}
+		if logConf.logRequest(lp) {
+			// log the input as the unary calls' are, for replaying
+			hss = recvLoggingStream{ServerStream: hss, onRecv: func(m interface{}) {
 				buf := bufpool.Get()
 				defer bufpool.Put(buf)
-				jenc := json.NewEncoder(buf)
-				if err = jenc.Encode(req); err != nil {
-					logger.Log("marshal error", err, "req", req)
+				if jErr := json.NewEncoder(buf).Encode(m); jErr != nil {
+					lgr.Log("marshal error", jErr)
 				}
-				logger.Log("REQ", info.FullMethod, "req", buf.String())
+				lgr.Log("REQ", info.FullMethod, "req", lp.Payload(redactSensitive(m, buf.Bytes())))
+			}}
+		}
+		start := time.Now()
+		err = handler(srv, hss)
+		dur := time.Since(start)
+		if oracall.IsRolledBack(ctx) {
+			ss.SetTrailer(metadata.Pairs(RolledBackTrailer, "true"))
+		}
+		if lp.Enabled(oracall.LogInfo) || err != nil && lp.Enabled(oracall.LogError) {
+			lgr.Log("RESP", info.FullMethod, "dur", dur, "error", err)
+		}
+		conf.Metrics.Observe(info.FullMethod, dur, err)
+		commit(err)
+		return StatusError(err)
+	}
 
-				// Fill PArgsHidden
-				if r := reflect.ValueOf(req).Elem(); r.Kind() != reflect.Struct {
-					logger.Log("error", "not struct", "req", fmt.Sprintf("%T %#v", req, req))
-				} else {
-					if f := r.FieldByName("PArgsHidden"); f.IsValid() {
-						f.Set(reflect.ValueOf(buf.String()))
-					}
+	unary := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (_ interface{}, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				trace := stack.Trace().String()
+				var ok bool
+				if err, ok = r.(error); ok {
+					logger.Log("PANIC", err, "trace", trace)
+					return
 				}
+				err = errors.Errorf("%+v", r)
+				logger.Log("PANIC", fmt.Sprintf("%+v", err), "trace", trace)
+			}
+		}()
+		logger, commit, ctx, cancel := getLogger(ctx, info.FullMethod)
+		defer cancel()
+		ctx, endSpan := oracall.StartSpan(ctx, conf.Tracer, info.FullMethod)
+		defer func() { endSpan(err) }()
 
-				start := time.Now()
-				res, err := handler(ctx, req)
+		if ctx, err = authenticate(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		var unpin func()
+		if ctx, unpin, err = pin(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		defer unpin()
 
-				logger.Log("RESP", info.FullMethod, "dur", time.Since(start), "error", err)
-				commit(err)
+		lp := oracall.ContextGetLogPolicy(ctx)
+		var hidden reflect.Value
+		if r := reflect.ValueOf(req).Elem(); r.Kind() != reflect.Struct {
+			if lp.Enabled(oracall.LogDebug) {
+				logger.Log("error", "not struct", "req", fmt.Sprintf("%T %#v", req, req))
+			}
+		} else {
+			hidden = r.FieldByName("PArgsHidden")
+		}
 
-				buf.Reset()
-				if jErr := jenc.Encode(res); err != nil {
-					logger.Log("marshal error", jErr, "res", res)
-				}
-				logger.Log("RESP", res, "error", err)
+		buf := bufpool.Get()
+		defer bufpool.Put(buf)
+		jenc := json.NewEncoder(buf)
+		// Encode the request only if it is logged or PArgsHidden needs it.
+		logReq := logConf.logRequest(lp)
+		if logReq || hidden.IsValid() {
+			_, endLogSpan := oracall.StartSpan(ctx, conf.Tracer, "logRequest")
+			if jErr := jenc.Encode(req); jErr != nil {
+				logger.Log("marshal error", jErr)
+			}
+			endLogSpan(nil)
+		}
+		if logReq {
+			logger.Log("REQ", info.FullMethod, "req", lp.Payload(redactSensitive(req, buf.Bytes())))
+		} else if lp.Enabled(oracall.LogInfo) {
+			logger.Log("REQ", info.FullMethod)
+		}
+
+		// Fill PArgsHidden
+		if hidden.IsValid() {
+			hidden.Set(reflect.ValueOf(buf.String()))
+		}
+
+		start := time.Now()
+		res, err := handler(ctx, req)
+		dur := time.Since(start)
+		if oracall.IsRolledBack(ctx) {
+			_ = grpc.SetTrailer(ctx, metadata.Pairs(RolledBackTrailer, "true"))
+		}
+
+		if lp.Enabled(oracall.LogInfo) || err != nil && lp.Enabled(oracall.LogError) {
+			logger.Log("RESP", info.FullMethod, "dur", dur, "error", err)
+		}
+		conf.Metrics.Observe(info.FullMethod, dur, err)
+		commit(err)
+
+		if lp.Enabled(oracall.LogDebug) {
+			buf.Reset()
+			if jErr := jenc.Encode(res); jErr != nil {
+				logger.Log("marshal error", jErr)
+			}
+			logger.Log("RESP", lp.Payload(redactSensitive(res, buf.Bytes())), "error", err)
+		}
 
-				return res, StatusError(err)
-			}),
+		return res, StatusError(err)
 	}
-	return grpc.NewServer(append(opts, options...)...)
+	return unary, stream
+}
+
+// GRPCServer returns a new grpc.Server, with logging, authentication and the features of conf.
+func (conf Config) GRPCServer(globalCtx context.Context, logger log.Logger, verbose bool, checkAuth func(ctx context.Context, path string) error, options ...grpc.ServerOption) *grpc.Server {
+	unary, stream := conf.interceptors(globalCtx, logger, verbose, checkAuth)
+	opts := []grpc.ServerOption{grpc.StreamInterceptor(stream), grpc.UnaryInterceptor(unary)}
+	srv := grpc.NewServer(append(opts, options...)...)
+	if conf.Health != nil {
+		conf.Health.Register(srv)
+	}
+	if conf.Reflection {
+		reflection.Register(srv)
+	}
+	return srv
+}
+
+// redactSensitive returns the JSON data of the message v, with the values of its sensitive fields redacted:
+// the ones registered by the generated code (see oracall.RegisterSensitive),
+// and the ones marked with the (oracall.sensitive) option in its descriptor - and of the extra keys.
+func redactSensitive(v interface{}, data []byte, extra ...string) []byte {
+	paths := oracall.SensitivePaths(oracall.MessageName(v))
+	if optPaths := oragrpc.SensitivePaths(v); len(optPaths) != 0 {
+		paths = append(append(make([]string, 0, len(paths)+len(optPaths)), paths...), optPaths...)
+	}
+	return oracall.RedactPaths(data, paths, extra...)
 }
 
 func StatusError(err error) error {
@@ -175,14 +369,32 @@ func StatusError(err error) error {
 	}
 	if errors.Is(err, oracall.ErrInvalidArgument) {
 		code = codes.InvalidArgument
+	} else if errors.Is(err, oracall.ErrNoSession) {
+		code = codes.FailedPrecondition
 	} else if errors.As(err, &sc) {
 		code = sc.Code()
 	}
+	// the Oracle errors are returned in the details, for the generated clients
+	oraDetail, isOra := oragrpc.NewOraErrorDetail(err)
 	if code == 0 {
-		return err
+		if !isOra {
+			return err
+		}
+		code = codes.Unknown
 	}
 	s := status.New(code, err.Error())
-	if sd, sErr := s.WithDetails(&pbMessage{Message: fmt.Sprintf("%+v", err)}); sErr == nil {
+	msg := &pbMessage{Message: fmt.Sprintf("%+v", err)}
+	var sd *status.Status
+	var sErr error
+	if isOra {
+		sd, sErr = s.WithDetails(msg, oraDetail)
+	} else if fieldDetail, isField := oragrpc.NewFieldErrorDetail(err); isField {
+		// the path of the invalid field of the input
+		sd, sErr = s.WithDetails(msg, fieldDetail)
+	} else {
+		sd, sErr = s.WithDetails(msg)
+	}
+	if sErr == nil {
 		s = sd
 	}
 	return s.Err()
@@ -198,9 +410,47 @@ func (m *pbMessage) String() string { return proto.MarshalTextString(m) }
 
 type ctxKey string
 
-const reqIDCtxKey = ctxKey("reqID")
 const loggerCtxKey = ctxKey("logger")
 
+// ReqIDHeader is the metadata key of the request ID,
+// read from the incoming and set in the response header.
+const ReqIDHeader = "x-request-id"
+
+const (
+	// DryRunHeader is the metadata key which requests dry-run mode: the transaction of the call
+	// is rolled back instead of committing it, and the RolledBackTrailer is set.
+	//
+	// It is honored only if checkAuth allows the method's path with the DryRunPathSuffix.
+	DryRunHeader = "x-oracall-dry-run"
+	// DryRunPathSuffix is appended to the method's path for checking the permission of dry-run.
+	DryRunPathSuffix = "#dry-run"
+	// RolledBackTrailer is set in the trailer of the dry-run calls which have been rolled back.
+	RolledBackTrailer = "x-oracall-rolled-back"
+)
+
+func isTrue(s string) bool {
+	b, err := strconv.ParseBool(strings.TrimSpace(s))
+	return err == nil && b
+}
+
+// reqIDFromMetadata returns the request ID from the metadata, if it's sane.
+func reqIDFromMetadata(md metadata.MD) string {
+	vv := md.Get(ReqIDHeader)
+	if len(vv) == 0 {
+		return ""
+	}
+	reqID := strings.TrimSpace(vv[0])
+	if len(reqID) > 64 {
+		return ""
+	}
+	for _, r := range reqID {
+		if r <= ' ' || r > '~' {
+			return ""
+		}
+	}
+	return reqID
+}
+
 func ContextWithLogger(ctx context.Context, logger log.Logger) context.Context {
 	return context.WithValue(ctx, loggerCtxKey, logger)
 }
@@ -214,10 +464,10 @@ func ContextWithReqID(ctx context.Context, reqID string) context.Context {
 	if reqID == "" {
 		reqID = NewULID()
 	}
-	return context.WithValue(ctx, reqIDCtxKey, reqID)
+	return oracall.ContextWithReqID(ctx, reqID)
 }
 func ContextGetReqID(ctx context.Context) string {
-	if reqID, ok := ctx.Value(reqIDCtxKey).(string); ok {
+	if reqID := oracall.ContextGetReqID(ctx); reqID != "" {
 		return reqID
 	}
 	return NewULID()
@@ -0,0 +1,191 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package orasrv
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	oracall "github.com/tgulacsi/oracall/lib"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// registry holds the resources (transactions, sessions) pinned to a token, spanning several calls.
+type registry struct {
+	kind string
+
+	mu     sync.Mutex
+	pinned map[string]*pinned
+}
+
+type pinned struct {
+	// lock is a one-slot semaphore serializing the calls using the resource,
+	// which - unlike a sync.Mutex - can be waited for till the context of the call is done.
+	lock chan struct{}
+	// value is the pinned resource.
+	value interface{}
+	// close releases the resource.
+	close    func()
+	user     string
+	lastUsed time.Time
+	inUse    int
+}
+
+func newRegistry(kind string) *registry {
+	return &registry{kind: kind, pinned: make(map[string]*pinned)}
+}
+
+func newPinned(value interface{}, closeFn func(), user string) *pinned {
+	return &pinned{lock: make(chan struct{}, 1), value: value, close: closeFn, user: user, lastUsed: time.Now()}
+}
+
+// add the value, owned by the user of the Identity of ctx, returning its new token.
+func (r *registry) add(ctx context.Context, value interface{}, closeFn func()) (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b[:])
+	id, _ := oracall.ContextGetIdentity(ctx)
+	r.mu.Lock()
+	r.pinned[token] = newPinned(value, closeFn, id.User)
+	r.mu.Unlock()
+	return token, nil
+}
+
+// remove the token. The resource is not closed.
+func (r *registry) remove(token string) {
+	r.mu.Lock()
+	delete(r.pinned, token)
+	r.mu.Unlock()
+}
+
+// acquire the resource of the token, for exclusive use till release is called.
+//
+// It waits for the other calls using the resource till ctx is done - then returns an Aborted error.
+func (r *registry) acquire(ctx context.Context, token string) (*pinned, func(), error) {
+	r.mu.Lock()
+	p := r.pinned[token]
+	if p != nil {
+		p.inUse++
+	}
+	r.mu.Unlock()
+	if p == nil {
+		return nil, nil, status.Errorf(codes.NotFound, "%s %q not found", r.kind, token)
+	}
+	release := func() {
+		r.mu.Lock()
+		p.inUse--
+		p.lastUsed = time.Now()
+		r.mu.Unlock()
+	}
+	if id, _ := oracall.ContextGetIdentity(ctx); id.User != p.user {
+		release()
+		return nil, nil, status.Errorf(codes.PermissionDenied, "%s %q belongs to another user", r.kind, token)
+	}
+	select {
+	case p.lock <- struct{}{}:
+	case <-ctx.Done():
+		release()
+		return nil, nil, status.Errorf(codes.Aborted, "%s %q is in use: %v", r.kind, token, ctx.Err())
+	}
+	return p, func() { <-p.lock; release() }, nil
+}
+
+// fromMetadata acquires the resource of the token in the header of the incoming metadata.
+// It returns a nil resource if there is no such header.
+func (r *registry) fromMetadata(ctx context.Context, header string) (interface{}, func(), error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	vv := md.Get(header)
+	if len(vv) == 0 || vv[0] == "" {
+		return nil, func() {}, nil
+	}
+	p, release, err := r.acquire(ctx, vv[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	return p.value, release, nil
+}
+
+// run expires the resources idle for more than idleTimeout, till ctx is canceled - then closes all of them.
+func (r *registry) run(ctx context.Context, idleTimeout time.Duration) error {
+	tick := idleTimeout / 2
+	if tick <= 0 {
+		tick = time.Minute
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			r.closeAll()
+			return ctx.Err()
+		case <-ticker.C:
+			r.expire(time.Now().Add(-idleTimeout))
+		}
+	}
+}
+
+// expire closes the resources not in use, and last used before the given time.
+func (r *registry) expire(before time.Time) {
+	r.mu.Lock()
+	expired := make([]*pinned, 0, len(r.pinned))
+	for token, p := range r.pinned {
+		if p.inUse == 0 && p.lastUsed.Before(before) {
+			delete(r.pinned, token)
+			expired = append(expired, p)
+		}
+	}
+	r.mu.Unlock()
+	for _, p := range expired {
+		p.close()
+	}
+}
+
+// closeAll closes all the resources.
+func (r *registry) closeAll() {
+	r.mu.Lock()
+	all := r.pinned
+	r.pinned = make(map[string]*pinned)
+	r.mu.Unlock()
+	for _, p := range all {
+		p.close()
+	}
+}
+
+// unaryHandler returns a grpc.MethodDesc handler for a hand-written service.
+func unaryHandler(fullMethod string, newReq func() interface{}, f func(ctx context.Context, srv, req interface{}) (interface{}, error)) func(interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor) (interface{}, error) {
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		req := newReq()
+		if err := dec(req); err != nil {
+			return nil, err
+		}
+		if interceptor == nil {
+			return f(ctx, srv, req)
+		}
+		info := &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod}
+		return interceptor(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return f(ctx, srv, req)
+		})
+	}
+}
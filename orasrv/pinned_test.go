@@ -0,0 +1,81 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package orasrv
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	oracall "github.com/tgulacsi/oracall/lib"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestRegistry(t *testing.T) {
+	r := newRegistry("thing")
+	var closed int
+	ctx := oracall.ContextWithIdentity(context.Background(), oracall.Identity{User: "scott"})
+	token, err := r.add(ctx, "value", func() { closed++ })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := r.acquire(ctx, "nothing"); status.Code(err) != codes.NotFound {
+		t.Errorf("unknown token: got %v", err)
+	}
+	if _, _, err := r.acquire(context.Background(), token); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("other user: got %v", err)
+	}
+
+	if v, release, err := r.fromMetadata(ctx, TxHeader); err != nil || v != nil {
+		t.Errorf("no header: got %v, %v", v, err)
+	} else {
+		release()
+	}
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(TxHeader, token))
+	v, release, err := r.fromMetadata(ctx, TxHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != "value" {
+		t.Errorf("got %v, wanted value", v)
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	_, _, err = r.acquire(waitCtx, token)
+	cancel()
+	if status.Code(err) != codes.Aborted {
+		t.Errorf("in use: got %v", err)
+	}
+	r.expire(time.Now().Add(time.Hour))
+	if closed != 0 {
+		t.Error("expired an in-use resource")
+	}
+	release()
+	r.expire(time.Now().Add(-time.Hour))
+	if closed != 0 {
+		t.Error("expired a recently used resource")
+	}
+	r.expire(time.Now().Add(time.Hour))
+	if closed != 1 {
+		t.Errorf("closed=%d, wanted 1", closed)
+	}
+	if _, _, err := r.acquire(ctx, token); status.Code(err) != codes.NotFound {
+		t.Errorf("expired token: got %v", err)
+	}
+}
@@ -0,0 +1,197 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package orasrv
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	oracall "github.com/tgulacsi/oracall/lib"
+	errors "golang.org/x/xerrors"
+	"google.golang.org/grpc"
+)
+
+// SessionHeader is the metadata key of the session token,
+// which makes the session-bound calls execute in that session.
+const SessionHeader = "x-oracall-session"
+
+// DefaultSessionIdleTimeout is the default idle timeout of the sessions.
+const DefaultSessionIdleTimeout = 15 * time.Minute
+
+// DefaultSessionReset is the default PL/SQL block which resets the session before returning it to the pool.
+const DefaultSessionReset = "BEGIN DBMS_SESSION.RESET_PACKAGE; END;"
+
+// SessionManager pins a dedicated connection (Oracle session) to each client session,
+// for the packages which keep state in package variables between the calls,
+// serving the oracall.Session service:
+//
+//	syntax = "proto3";
+//	package oracall;
+//
+//	service Session {
+//		rpc Open(SessionEmpty) returns (SessionToken) {}
+//		rpc Close(SessionToken) returns (SessionEmpty) {}
+//	}
+//	message SessionEmpty {}
+//	message SessionToken { string token = 1; }
+//
+// The functions annotated with
+//
+//	--oracall:session-bound function_name
+//
+// execute in the session of the token in the SessionHeader metadata, one at a time,
+// and fail with FailedPrecondition without it.
+// Sessions idle for more than IdleTimeout are reset and returned to the pool.
+type SessionManager struct {
+	db *sql.DB
+	// IdleTimeout is the maximum idle time of a session.
+	IdleTimeout time.Duration
+	// Init is called on the newly opened session, such as
+	//
+	//	func(ctx context.Context, conn *sql.Conn, id oracall.Identity) error {
+	//		_, err := conn.ExecContext(ctx, "BEGIN pkg.init_session(:1); END;", id.User)
+	//		return err
+	//	}
+	Init func(context.Context, *sql.Conn, oracall.Identity) error
+	// Reset is executed on the session before returning it to the pool,
+	// to drop the package state - DefaultSessionReset if empty.
+	Reset string
+
+	sessions *registry
+}
+
+// NewSessionManager returns a new SessionManager for db, with DefaultSessionIdleTimeout.
+//
+// Run must be called to expire the idle sessions.
+func NewSessionManager(db *sql.DB) *SessionManager {
+	return &SessionManager{db: db, IdleTimeout: DefaultSessionIdleTimeout, sessions: newRegistry("session")}
+}
+
+// Register the oracall.Session service on the server.
+func (m *SessionManager) Register(srv *grpc.Server) { srv.RegisterService(&sessionServiceDesc, m) }
+
+// Open a new session, returning its token.
+func (m *SessionManager) Open(ctx context.Context) (string, error) {
+	// The session must outlive the Open call.
+	connCtx, cancel := context.WithCancel(context.Background())
+	id, _ := oracall.ContextGetIdentity(ctx)
+	if id.User != "" {
+		connCtx = oracall.ContextWithIdentity(connCtx, id)
+	}
+	conn, err := m.db.Conn(oracall.ContextWithProxyUser(connCtx))
+	if err != nil {
+		cancel()
+		return "", errors.Errorf("open session: %w", err)
+	}
+	closeConn := func() {
+		reset := m.Reset
+		if reset == "" {
+			reset = DefaultSessionReset
+		}
+		resetCtx, resetCancel := context.WithTimeout(connCtx, 10*time.Second)
+		_, _ = conn.ExecContext(resetCtx, reset)
+		resetCancel()
+		conn.Close()
+		cancel()
+	}
+	if m.Init != nil {
+		if err = m.Init(ctx, conn, id); err != nil {
+			closeConn()
+			return "", errors.Errorf("init session: %w", err)
+		}
+	}
+	token, err := m.sessions.add(ctx, conn, closeConn)
+	if err != nil {
+		closeConn()
+	}
+	return token, err
+}
+
+// Close the session of the token, returning its connection to the pool.
+func (m *SessionManager) Close(ctx context.Context, token string) error {
+	p, release, err := m.sessions.acquire(ctx, token)
+	if err != nil {
+		return err
+	}
+	defer release()
+	m.sessions.remove(token)
+	p.close()
+	return nil
+}
+
+// contextWithConn returns the context with the session of the token in the incoming metadata.
+// The returned function must be called at the end of the call.
+func (m *SessionManager) contextWithConn(ctx context.Context, fullMethod string) (context.Context, func(), error) {
+	if m == nil || strings.HasPrefix(fullMethod, "/"+sessionServiceName+"/") {
+		return ctx, func() {}, nil
+	}
+	conn, release, err := m.sessions.fromMetadata(ctx, SessionHeader)
+	if err != nil || conn == nil {
+		return ctx, release, err
+	}
+	return oracall.ContextWithConn(ctx, conn.(*sql.Conn)), release, nil
+}
+
+// Run expires the idle sessions, till ctx is canceled - then closes all of them.
+func (m *SessionManager) Run(ctx context.Context) error {
+	return m.sessions.run(ctx, m.IdleTimeout)
+}
+
+// CloseAll closes all the sessions.
+func (m *SessionManager) CloseAll() error {
+	m.sessions.closeAll()
+	return nil
+}
+
+// SessionEmpty is the empty message of the oracall.Session service.
+type SessionEmpty struct{}
+
+func (m SessionEmpty) ProtoMessage()   {}
+func (m *SessionEmpty) Reset()         {}
+func (m *SessionEmpty) String() string { return proto.MarshalTextString(m) }
+
+// SessionToken is the session token message of the oracall.Session service.
+type SessionToken struct {
+	Token string `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
+}
+
+func (m SessionToken) ProtoMessage()   {}
+func (m *SessionToken) Reset()         { m.Token = "" }
+func (m *SessionToken) String() string { return proto.MarshalTextString(m) }
+
+const sessionServiceName = "oracall.Session"
+
+var sessionServiceDesc = grpc.ServiceDesc{
+	ServiceName: sessionServiceName,
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Open", Handler: unaryHandler("/"+sessionServiceName+"/Open", func() interface{} { return new(SessionEmpty) },
+			func(ctx context.Context, srv, _ interface{}) (interface{}, error) {
+				token, err := srv.(*SessionManager).Open(ctx)
+				return &SessionToken{Token: token}, err
+			})},
+		{MethodName: "Close", Handler: unaryHandler("/"+sessionServiceName+"/Close", func() interface{} { return new(SessionToken) },
+			func(ctx context.Context, srv, req interface{}) (interface{}, error) {
+				return &SessionEmpty{}, srv.(*SessionManager).Close(ctx, req.(*SessionToken).Token)
+			})},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "oracall_session.proto",
+}
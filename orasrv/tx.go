@@ -0,0 +1,192 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package orasrv
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	oracall "github.com/tgulacsi/oracall/lib"
+	errors "golang.org/x/xerrors"
+	"google.golang.org/grpc"
+)
+
+// TxHeader is the metadata key of the transaction token,
+// which makes the call execute in that transaction.
+const TxHeader = "x-oracall-tx"
+
+// DefaultTxIdleTimeout is the default idle timeout of the transactions.
+const DefaultTxIdleTimeout = 5 * time.Minute
+
+// TxManager manages the transactions spanning several calls,
+// serving the oracall.Tx service:
+//
+//	syntax = "proto3";
+//	package oracall;
+//
+//	service Tx {
+//		rpc Begin(TxEmpty) returns (TxToken) {}
+//		rpc Commit(TxToken) returns (TxEmpty) {}
+//		rpc Rollback(TxToken) returns (TxEmpty) {}
+//	}
+//	message TxEmpty {}
+//	message TxToken { string token = 1; }
+//
+// The calls with the token in the TxHeader metadata execute in that transaction,
+// one at a time. Transactions idle for more than IdleTimeout are rolled back.
+type TxManager struct {
+	db *sql.DB
+	// IdleTimeout is the maximum idle time of a transaction.
+	IdleTimeout time.Duration
+	// SetIdentity is called with the oracall.Identity of the context (or the empty Identity),
+	// in the newly begun transaction.
+	SetIdentity func(context.Context, *sql.Tx, oracall.Identity) error
+
+	txs *registry
+}
+
+// NewTxManager returns a new TxManager for db, with DefaultTxIdleTimeout.
+//
+// Run must be called to expire the idle transactions.
+func NewTxManager(db *sql.DB) *TxManager {
+	return &TxManager{db: db, IdleTimeout: DefaultTxIdleTimeout, txs: newRegistry("transaction")}
+}
+
+// Register the oracall.Tx service on the server.
+func (m *TxManager) Register(srv *grpc.Server) { srv.RegisterService(&txServiceDesc, m) }
+
+// Begin a new transaction, returning its token.
+func (m *TxManager) Begin(ctx context.Context) (string, error) {
+	// The transaction must outlive the Begin call.
+	txCtx, cancel := context.WithCancel(context.Background())
+	id, _ := oracall.ContextGetIdentity(ctx)
+	if id.User != "" {
+		txCtx = oracall.ContextWithIdentity(txCtx, id)
+	}
+	tx, err := m.db.BeginTx(oracall.ContextWithProxyUser(txCtx), nil)
+	if err != nil {
+		cancel()
+		return "", errors.Errorf("begin: %w", err)
+	}
+	if err = oracall.ApplyIdentity(ctx, tx, m.SetIdentity); err != nil {
+		tx.Rollback()
+		cancel()
+		return "", err
+	}
+	token, err := m.txs.add(ctx, tx, func() { tx.Rollback(); cancel() })
+	if err != nil {
+		tx.Rollback()
+		cancel()
+	}
+	return token, err
+}
+
+// Commit the transaction of the token.
+func (m *TxManager) Commit(ctx context.Context, token string) error {
+	return m.finish(ctx, token, true)
+}
+
+// Rollback the transaction of the token.
+func (m *TxManager) Rollback(ctx context.Context, token string) error {
+	return m.finish(ctx, token, false)
+}
+
+func (m *TxManager) finish(ctx context.Context, token string, commit bool) error {
+	p, release, err := m.txs.acquire(ctx, token)
+	if err != nil {
+		return err
+	}
+	defer release()
+	m.txs.remove(token)
+	defer p.close()
+	if commit {
+		err = p.value.(*sql.Tx).Commit()
+	} else {
+		err = p.value.(*sql.Tx).Rollback()
+	}
+	if err != nil && !errors.Is(err, sql.ErrTxDone) {
+		return err
+	}
+	return nil
+}
+
+// contextWithTx returns the context with the transaction of the token in the incoming metadata.
+// The returned function must be called at the end of the call.
+func (m *TxManager) contextWithTx(ctx context.Context, fullMethod string) (context.Context, func(), error) {
+	if m == nil || strings.HasPrefix(fullMethod, "/"+txServiceName+"/") {
+		return ctx, func() {}, nil
+	}
+	tx, release, err := m.txs.fromMetadata(ctx, TxHeader)
+	if err != nil || tx == nil {
+		return ctx, release, err
+	}
+	return oracall.ContextWithTx(ctx, tx.(*sql.Tx)), release, nil
+}
+
+// Run expires the idle transactions, till ctx is canceled - then rolls back all of them.
+func (m *TxManager) Run(ctx context.Context) error {
+	return m.txs.run(ctx, m.IdleTimeout)
+}
+
+// Close rolls back all the transactions.
+func (m *TxManager) Close() error {
+	m.txs.closeAll()
+	return nil
+}
+
+// TxEmpty is the empty message of the oracall.Tx service.
+type TxEmpty struct{}
+
+func (m TxEmpty) ProtoMessage()   {}
+func (m *TxEmpty) Reset()         {}
+func (m *TxEmpty) String() string { return proto.MarshalTextString(m) }
+
+// TxToken is the transaction token message of the oracall.Tx service.
+type TxToken struct {
+	Token string `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
+}
+
+func (m TxToken) ProtoMessage()   {}
+func (m *TxToken) Reset()         { m.Token = "" }
+func (m *TxToken) String() string { return proto.MarshalTextString(m) }
+
+const txServiceName = "oracall.Tx"
+
+var txServiceDesc = grpc.ServiceDesc{
+	ServiceName: txServiceName,
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Begin", Handler: unaryHandler("/"+txServiceName+"/Begin", func() interface{} { return new(TxEmpty) },
+			func(ctx context.Context, srv, _ interface{}) (interface{}, error) {
+				token, err := srv.(*TxManager).Begin(ctx)
+				return &TxToken{Token: token}, err
+			})},
+		{MethodName: "Commit", Handler: unaryHandler("/"+txServiceName+"/Commit", func() interface{} { return new(TxToken) },
+			func(ctx context.Context, srv, req interface{}) (interface{}, error) {
+				return &TxEmpty{}, srv.(*TxManager).Commit(ctx, req.(*TxToken).Token)
+			})},
+		{MethodName: "Rollback", Handler: unaryHandler("/"+txServiceName+"/Rollback", func() interface{} { return new(TxToken) },
+			func(ctx context.Context, srv, req interface{}) (interface{}, error) {
+				return &TxEmpty{}, srv.(*TxManager).Rollback(ctx, req.(*TxToken).Token)
+			})},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "oracall_tx.proto",
+}
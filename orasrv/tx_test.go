@@ -0,0 +1,83 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package orasrv
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	oracall "github.com/tgulacsi/oracall/lib"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestTxManagerAcquire(t *testing.T) {
+	m := NewTxManager(nil)
+	m.txs.pinned["tok"] = newPinned(new(sql.Tx), func() {}, "scott")
+
+	ctx := context.Background()
+	if _, _, err := m.txs.acquire(ctx, "nothing"); status.Code(err) != codes.NotFound {
+		t.Errorf("unknown token: got %v", err)
+	}
+	if _, _, err := m.txs.acquire(ctx, "tok"); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("other user: got %v", err)
+	}
+
+	ctx = oracall.ContextWithIdentity(ctx, oracall.Identity{User: "scott"})
+	if _, release, err := m.contextWithTx(ctx, "/pkg.Pkg/Fun"); err != nil {
+		t.Fatal(err)
+	} else {
+		release()
+	}
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(TxHeader, "tok"))
+	if _, release, err := m.contextWithTx(ctx, "/"+txServiceName+"/Commit"); err != nil {
+		t.Fatal(err)
+	} else {
+		release()
+	}
+	_, release, err := m.contextWithTx(ctx, "/pkg.Pkg/Fun")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := m.txs.pinned["tok"]; p.inUse != 1 {
+		t.Errorf("inUse=%d, wanted 1", p.inUse)
+	}
+	m.txs.expire(time.Now().Add(time.Hour))
+	if _, ok := m.txs.pinned["tok"]; !ok {
+		t.Error("expired an in-use transaction")
+	}
+	release()
+	if p := m.txs.pinned["tok"]; p.inUse != 0 {
+		t.Errorf("inUse=%d, wanted 0", p.inUse)
+	}
+}
+
+func TestTxManagerSkipsOwnService(t *testing.T) {
+	m := NewTxManager(nil)
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(TxHeader, "tok"))
+	if _, release, err := m.contextWithTx(ctx, "/"+txServiceName+"/Commit"); err != nil {
+		t.Fatal(err)
+	} else {
+		release()
+	}
+	if _, _, err := m.contextWithTx(ctx, "/pkg.Pkg/Fun"); status.Code(err) != codes.NotFound {
+		t.Errorf("got %v, wanted NotFound", err)
+	}
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package otel adapts an OpenTelemetry tracer to an oracall.Tracer.
+//
+// It is a separate module, so oracall does not depend on OpenTelemetry.
+package otel
+
+import (
+	"context"
+	"fmt"
+
+	oracall "github.com/tgulacsi/oracall/lib"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// NewTracer returns an oracall.Tracer starting the spans with tracer.
+//
+// Without an OpenTelemetry span in the context, the span is started as the child of
+// the oracall.TraceContext of the context (the "traceparent" of the call), if there is one.
+// The trace context of the new span is put into the returned context as the oracall.TraceContext,
+// for the godror.TraceTag of the calls.
+func NewTracer(tracer trace.Tracer) oracall.Tracer {
+	return oracall.TracerFunc(func(ctx context.Context, name string) (context.Context, oracall.Span) {
+		if !trace.SpanContextFromContext(ctx).IsValid() {
+			if tc, ok := oracall.ContextGetTraceContext(ctx); ok {
+				state, _ := trace.ParseTraceState(tc.State)
+				ctx = trace.ContextWithRemoteSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{
+					TraceID: tc.TraceID, SpanID: tc.SpanID, TraceFlags: trace.TraceFlags(tc.Flags),
+					TraceState: state, Remote: true,
+				}))
+			}
+		}
+		ctx, s := tracer.Start(ctx, name)
+		sc := s.SpanContext()
+		ctx = oracall.ContextWithTraceContext(ctx, oracall.TraceContext{
+			TraceID: sc.TraceID(), SpanID: sc.SpanID(), Flags: byte(sc.TraceFlags()),
+			State: sc.TraceState().String(),
+		})
+		return ctx, span{span: s}
+	})
+}
+
+// span is an OpenTelemetry span as an oracall.Span.
+type span struct {
+	span trace.Span
+}
+
+// SetAttribute sets the attribute on the span.
+func (s span) SetAttribute(key string, value interface{}) { s.span.SetAttributes(keyValue(key, value)) }
+
+// RecordError records the error, and sets the status of the span to Error.
+func (s span) RecordError(err error) {
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+// End the span.
+func (s span) End() { s.span.End() }
+
+func keyValue(key string, value interface{}) attribute.KeyValue {
+	switch x := value.(type) {
+	case string:
+		return attribute.String(key, x)
+	case bool:
+		return attribute.Bool(key, x)
+	case int:
+		return attribute.Int(key, x)
+	case int32:
+		return attribute.Int64(key, int64(x))
+	case int64:
+		return attribute.Int64(key, x)
+	case float64:
+		return attribute.Float64(key, x)
+	case []string:
+		return attribute.StringSlice(key, x)
+	case fmt.Stringer:
+		return attribute.Stringer(key, x)
+	default:
+		return attribute.String(key, fmt.Sprint(value))
+	}
+}
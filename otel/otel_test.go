@@ -0,0 +1,84 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package otel
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	oracall "github.com/tgulacsi/oracall/lib"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestNewTracer(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	defer tp.Shutdown(context.Background())
+	tracer := NewTracer(tp.Tracer("oracall"))
+
+	parent, err := oracall.ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := oracall.ContextWithTraceContext(context.Background(), parent)
+	ctx, s := tracer.Start(ctx, "/pkg.Pkg/GetX")
+	s.SetAttribute("rows", 3)
+	s.SetAttribute("user", "scott")
+	_, endSpan := oracall.StartSpan(ctx, tracer, "ExecContext")
+	endSpan(errors.New("ORA-01403"))
+	s.End()
+
+	tc, ok := oracall.ContextGetTraceContext(ctx)
+	if !ok || tc.TraceID != parent.TraceID || tc.SpanID == parent.SpanID {
+		t.Errorf("got trace context %s, wanted a child of %s", tc, parent)
+	}
+
+	spans := rec.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, wanted 2", len(spans))
+	}
+	exec, call := spans[0], spans[1]
+	if call.Name() != "/pkg.Pkg/GetX" || exec.Name() != "ExecContext" {
+		t.Errorf("got %q and %q", call.Name(), exec.Name())
+	}
+	if p := call.Parent(); !p.IsRemote() || p.TraceID() != parent.TraceID || p.SpanID() != parent.SpanID {
+		t.Errorf("got parent %v of the call, wanted %s", p, parent)
+	}
+	if got, want := exec.Parent().SpanID(), call.SpanContext().SpanID(); got != want {
+		t.Errorf("got parent %s of ExecContext, wanted %s", got, want)
+	}
+	if st := exec.Status(); st.Code != codes.Error || st.Description != "ORA-01403" {
+		t.Errorf("got status %+v", st)
+	}
+	want := map[attribute.Key]attribute.Value{
+		"rows": attribute.Int64Value(3),
+		"user": attribute.StringValue("scott"),
+	}
+	for _, kv := range call.Attributes() {
+		if w, ok := want[kv.Key]; !ok || w != kv.Value {
+			t.Errorf("got %s=%v, wanted %v", kv.Key, kv.Value.Emit(), w.Emit())
+		}
+		delete(want, kv.Key)
+	}
+	if len(want) != 0 {
+		t.Errorf("missing attributes %v", want)
+	}
+}
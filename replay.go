@@ -0,0 +1,196 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	godror "github.com/godror/godror"
+	oracall "github.com/tgulacsi/oracall/lib"
+	errors "golang.org/x/xerrors"
+)
+
+// replayMain is the "replay" subcommand: calls the requests logged by orasrv on two databases,
+// reporting the differences of the results (both calls are rolled back).
+func replayMain(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	flagConnect := fs.String("connect", os.Getenv("ORACALL_DSN"), "the baseline database (default: $ORACALL_DSN)")
+	flagAgainst := fs.String("against", "", "the database compared to the baseline")
+	flagIgnore := fs.String("ignore", "timestamps", "comma-separated list of the ignored fields (timestamps: all the timestamps)")
+	flagTimeout := fs.Duration("timeout", time.Minute, "timeout of each call")
+	flagPbPkg := fs.String("pb-pkg", "", "the Protocol Buffers package of the logged server, as in -pb-out (default: the PL/SQL package, as oracall serve names it)")
+	flagVerbose := fs.Bool("v", false, "verbose logging")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage:\n\t%s replay [flags] -against OTHER_DSN 'PKG.%%' [log files]\n\n", os.Args[0])
+		fmt.Fprintln(fs.Output(), "Reads the logs from stdin if no file is given.")
+		fmt.Fprintln(fs.Output(), "The server logs the inputs at debug level, or at info level with orasrv.LogConfig.LogRequests.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	pattern := fs.Arg(0)
+	if pattern == "" {
+		fs.Usage()
+		return errors.Errorf("the pattern of the functions is required: %w", oracall.ErrInvalidArgument)
+	}
+	if *flagConnect == "" || *flagAgainst == "" {
+		return errors.Errorf("both -connect and -against are required: %w", oracall.ErrInvalidArgument)
+	}
+	rules := oracall.ParseIgnoreRules(*flagIgnore)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt)
+	go func() { <-sigCh; cancel() }()
+	if *flagVerbose {
+		godror.Log = log.With(logger, "lib", "godror").Log
+	}
+
+	var dbs [2]replayDB
+	for i, dsn := range []string{*flagConnect, *flagAgainst} {
+		db, err := openReplayDB(ctx, dsn, pattern, *flagPbPkg)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		dbs[i] = db
+	}
+
+	var r io.Reader = os.Stdin
+	if fs.NArg() > 1 {
+		readers := make([]io.Reader, 0, fs.NArg()-1)
+		for _, fn := range fs.Args()[1:] {
+			fh, err := os.Open(fn)
+			if err != nil {
+				return err
+			}
+			defer fh.Close()
+			readers = append(readers, fh)
+		}
+		r = io.MultiReader(readers...)
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+	seen := make(map[string]int)
+	var calls, diffs, skipped int
+	err := oracall.ReadReplayLog(r, func(rec oracall.ReplayRecord) error {
+		name := rec.Method
+		seen[name]++
+		var in map[string]interface{}
+		dec := json.NewDecoder(bytes.NewReader(rec.Input))
+		dec.UseNumber()
+		if err := dec.Decode(&in); err != nil {
+			fmt.Fprintf(w, "SKIP %s #%d: decode input: %v\n", name, seen[name], err)
+			skipped++
+			return nil
+		}
+		if rec.Redacted() {
+			fmt.Fprintf(w, "SKIP %s #%d: the input contains redacted values\n", name, seen[name])
+			skipped++
+			return nil
+		}
+		var results [2]oracall.ReplayResult
+		for i, db := range dbs {
+			fun, ok := db.functions[rec.Method]
+			if !ok {
+				results[i] = oracall.ReplayResult{Error: "function not found"}
+				continue
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			results[i] = db.call(ctx, *flagTimeout, fun, in)
+		}
+		calls++
+		d, err := rules.Compare(results[0], results[1])
+		if err != nil {
+			return err
+		}
+		if d != "" {
+			diffs++
+			fmt.Fprintf(w, "DIFF %s #%d %s\n%s\n", name, seen[name], rec.Input, d)
+		}
+		return nil
+	})
+	fmt.Fprintf(w, "%d calls replayed, %d differ, %d skipped\n", calls, diffs, skipped)
+	if err != nil {
+		return err
+	}
+	if calls == 0 && skipped == 0 {
+		return errors.Errorf("no logged request found - orasrv logs the inputs at debug level, or with LogConfig.LogRequests: %w", oracall.ErrInvalidArgument)
+	}
+	if diffs != 0 {
+		return errors.Errorf("%d calls differ", diffs)
+	}
+	return nil
+}
+
+// replayDB is a database the logged calls are replayed on, with the functions read from it.
+type replayDB struct {
+	*sql.DB
+	functions map[string]oracall.Function
+}
+
+// openReplayDB connects to the database, and reads the functions matching the pattern,
+// keyed by their full gRPC method in the pbPkg Protocol Buffers package.
+func openReplayDB(ctx context.Context, dsn, pattern, pbPkg string) (replayDB, error) {
+	cx, err := sql.Open("godror", dsn)
+	if err != nil {
+		return replayDB{}, errors.Errorf("connect to %s: %w", dsn, err)
+	}
+	if err = cx.PingContext(ctx); err != nil {
+		cx.Close()
+		return replayDB{}, errors.Errorf("ping %s: %w", dsn, err)
+	}
+	functions, annotations, err := parseDB(ctx, cx, pattern, "", func(string) bool { return true })
+	if err != nil {
+		cx.Close()
+		return replayDB{}, errors.Errorf("read %s from %s: %w", pattern, dsn, err)
+	}
+	db := replayDB{DB: cx, functions: make(map[string]oracall.Function, len(functions))}
+	for _, f := range oracall.ApplyAnnotations(functions, annotations) {
+		db.functions[f.FullMethod(pbPkg)] = f
+	}
+	return db, nil
+}
+
+// call calls the function in a transaction, rolled back.
+func (db replayDB) call(ctx context.Context, timeout time.Duration, fun oracall.Function, input map[string]interface{}) oracall.ReplayResult {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return oracall.NewReplayResult(nil, err)
+	}
+	defer tx.Rollback()
+	output, err := fun.InvokeMap(ctx, tx, input)
+	return oracall.NewReplayResult(output, err)
+}
@@ -0,0 +1,199 @@
+/*
+Copyright 2020 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	godror "github.com/godror/godror"
+	oracall "github.com/tgulacsi/oracall/lib"
+	"github.com/tgulacsi/oracall/orasrv"
+	errors "golang.org/x/xerrors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// serveMain is the "serve" subcommand: serves the PL/SQL functions matching the pattern over gRPC,
+// with the descriptors built from the metadata read at runtime, and the server reflection of them.
+//
+// The calls are authenticated by a bearer token and/or a client certificate - it refuses to start without either.
+func serveMain(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	flagConnect := fs.String("connect", os.Getenv("ORACALL_DSN"), "database to connect to (default: $ORACALL_DSN)")
+	flagListen := fs.String("listen", "localhost:9090", "address to listen on")
+	flagToken := fs.String("token", os.Getenv("ORACALL_TOKEN"), "the bearer token required in the authorization header of the calls (default: $ORACALL_TOKEN)")
+	flagCert := fs.String("tls-cert", "", "TLS certificate file of the server")
+	flagKey := fs.String("tls-key", "", "TLS key file of the server")
+	flagClientCA := fs.String("tls-client-ca", "", "CA certificates file to verify the required client certificates with")
+	flagRefresh := fs.Duration("refresh", 5*time.Minute, "reload the functions this often")
+	flagVerbose := fs.Bool("v", false, "verbose logging")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage:\n\t%s serve [flags] 'PKG.%%'\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	pattern := fs.Arg(0)
+	if pattern == "" || fs.NArg() > 1 {
+		fs.Usage()
+		return errors.Errorf("the pattern of the functions is required: %w", oracall.ErrInvalidArgument)
+	}
+	if *flagConnect == "" {
+		return errors.Errorf("-connect is required: %w", oracall.ErrInvalidArgument)
+	}
+	if *flagToken == "" && *flagClientCA == "" {
+		return errors.Errorf("either -token or -tls-client-ca is required, as anybody reaching the server could call the functions: %w", oracall.ErrInvalidArgument)
+	}
+	var options []grpc.ServerOption
+	if *flagCert != "" || *flagKey != "" || *flagClientCA != "" {
+		tlsConf, err := serverTLSConfig(*flagCert, *flagKey, *flagClientCA)
+		if err != nil {
+			return err
+		}
+		options = append(options, grpc.Creds(credentials.NewTLS(tlsConf)))
+	} else {
+		logger.Log("msg", "the token is sent in plain text without -tls-cert and -tls-key")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt)
+	go func() { <-sigCh; cancel() }()
+
+	cx, err := sql.Open("godror", *flagConnect)
+	if err != nil {
+		return errors.Errorf("connect to %s: %w", *flagConnect, err)
+	}
+	defer cx.Close()
+	if *flagVerbose {
+		godror.Log = log.With(logger, "lib", "godror").Log
+	}
+	if err = cx.PingContext(ctx); err != nil {
+		return errors.Errorf("ping %s: %w", *flagConnect, err)
+	}
+
+	dyn := &orasrv.Dynamic{
+		DB:       cx,
+		Interval: *flagRefresh,
+		Log:      log.With(logger, "lib", "dynamic").Log,
+		Load: func(ctx context.Context) ([]oracall.Function, error) {
+			functions, annotations, err := parseDB(ctx, cx, pattern, "", func(string) bool { return true })
+			if err != nil {
+				return nil, err
+			}
+			return oracall.ApplyAnnotations(functions, annotations), nil
+		},
+	}
+	if err = dyn.Reload(ctx); err != nil {
+		return err
+	}
+
+	health := orasrv.NewHealth()
+	health.Log = log.With(logger, "lib", "health").Log
+	health.AddDB("", cx)
+	conf := orasrv.Config{Health: health}
+	options = append(options, grpc.UnknownServiceHandler(dyn.Handler))
+	srv := conf.GRPCServer(ctx, logger, *flagVerbose, serveAuth(*flagToken, *flagClientCA != ""), options...)
+	dyn.Register(srv)
+
+	lis, err := net.Listen("tcp", *flagListen)
+	if err != nil {
+		return errors.Errorf("listen on %s: %w", *flagListen, err)
+	}
+	go health.Run(ctx)
+	go dyn.Run(ctx)
+	go func() {
+		<-ctx.Done()
+		drainCtx, drainCancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer drainCancel()
+		if err := conf.Drain(drainCtx, srv); err != nil {
+			logger.Log("msg", "drain", "error", err)
+		}
+	}()
+	logger.Log("msg", "serving", "pattern", pattern, "address", lis.Addr())
+	return srv.Serve(lis)
+}
+
+// serverTLSConfig returns the TLS configuration of the server, requiring verified client certificates
+// if clientCAFile is given.
+func serverTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, errors.Errorf("both -tls-cert and -tls-key are required for TLS: %w", oracall.ErrInvalidArgument)
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, errors.Errorf("load %s and %s: %w", certFile, keyFile, err)
+	}
+	conf := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if clientCAFile == "" {
+		return conf, nil
+	}
+	b, err := ioutil.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, errors.Errorf("read %s: %w", clientCAFile, err)
+	}
+	conf.ClientCAs = x509.NewCertPool()
+	if !conf.ClientCAs.AppendCertsFromPEM(b) {
+		return nil, errors.Errorf("no certificates in %s: %w", clientCAFile, oracall.ErrInvalidArgument)
+	}
+	conf.ClientAuth = tls.RequireAndVerifyClientCert
+	return conf, nil
+}
+
+// serveAuth returns the checkAuth of the served calls, requiring the bearer token (if it is not empty),
+// and a verified client certificate (if clientCert is true).
+func serveAuth(token string, clientCert bool) func(ctx context.Context, path string) error {
+	return func(ctx context.Context, path string) error {
+		if clientCert {
+			p, ok := peer.FromContext(ctx)
+			if !ok {
+				return errors.New("no peer")
+			}
+			if info, ok := p.AuthInfo.(credentials.TLSInfo); !ok || len(info.State.VerifiedChains) == 0 {
+				return errors.New("no verified client certificate")
+			}
+		}
+		if token == "" {
+			return nil
+		}
+		md, _ := metadata.FromIncomingContext(ctx)
+		for _, v := range md.Get("authorization") {
+			if len(v) > 7 && strings.EqualFold(v[:7], "bearer ") &&
+				subtle.ConstantTimeCompare([]byte(v[7:]), []byte(token)) == 1 {
+				return nil
+			}
+		}
+		return errors.New("missing or wrong bearer token")
+	}
+}
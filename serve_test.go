@@ -0,0 +1,82 @@
+/*
+Copyright 2017 Tamás Gulácsi
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"testing"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+func TestServeAuth(t *testing.T) {
+	withToken := func(v string) context.Context {
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", v))
+	}
+	withCert := func(ctx context.Context, verified bool) context.Context {
+		var state tls.ConnectionState
+		if verified {
+			state.VerifiedChains = [][]*x509.Certificate{{{}}}
+		}
+		return peer.NewContext(ctx, &peer.Peer{AuthInfo: credentials.TLSInfo{State: state}})
+	}
+
+	auth := serveAuth("s3cret", false)
+	for i, tc := range []struct {
+		ctx  context.Context
+		isOK bool
+	}{
+		{context.Background(), false},
+		{withToken("Bearer s3cret"), true},
+		{withToken("bearer s3cret"), true},
+		{withToken("Bearer s3cre"), false},
+		{withToken("s3cret"), false},
+	} {
+		if err := auth(tc.ctx, "/pkg.Pkg/GetX"); (err == nil) != tc.isOK {
+			t.Errorf("%d. got %v", i, err)
+		}
+	}
+
+	auth = serveAuth("", true)
+	if err := auth(withToken("Bearer s3cret"), "/pkg.Pkg/GetX"); err == nil {
+		t.Error("no certificate: got no error")
+	}
+	if err := auth(withCert(context.Background(), false), "/pkg.Pkg/GetX"); err == nil {
+		t.Error("unverified certificate: got no error")
+	}
+	if err := auth(withCert(context.Background(), true), "/pkg.Pkg/GetX"); err != nil {
+		t.Errorf("verified certificate: %+v", err)
+	}
+
+	auth = serveAuth("s3cret", true)
+	if err := auth(withCert(context.Background(), true), "/pkg.Pkg/GetX"); err == nil {
+		t.Error("certificate without the token: got no error")
+	}
+	if err := auth(withCert(withToken("Bearer s3cret"), true), "/pkg.Pkg/GetX"); err != nil {
+		t.Errorf("certificate and token: %+v", err)
+	}
+}
+
+func TestServerTLSConfig(t *testing.T) {
+	if _, err := serverTLSConfig("", "", "ca.pem"); err == nil {
+		t.Error("client CA without a server certificate: got no error")
+	}
+}